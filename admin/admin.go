@@ -0,0 +1,326 @@
+// Package admin provides an HTTP handler for inspecting and steering a
+// running kafkalight.KafkaRouter: its routes, assigned partitions and
+// offsets, pausing and resuming topics, seeking to a timestamp and closing
+// the router gracefully.
+//
+// The handler is meant to be mounted on an internal port. By default it only
+// serves read-only endpoints; control endpoints require an Authorizer that
+// permits ActionControl, such as BearerToken.
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/overtonx/kafkalight"
+)
+
+// DefaultCloseTimeout bounds how long POST /close waits for handlers to finish.
+const DefaultCloseTimeout = 30 * time.Second
+
+// Action classifies admin requests for authorisation.
+type Action string
+
+// Admin actions.
+const (
+	// ActionRead covers the endpoints that only report state.
+	ActionRead Action = "read"
+	// ActionControl covers pause, resume, seek and close.
+	ActionControl Action = "control"
+)
+
+// ErrUnauthorized is returned by authorizers for requests without valid
+// credentials; the handler responds 401 to it and 403 to other errors.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// ErrForbidden is returned by ReadOnly for control requests.
+var ErrForbidden = errors.New("forbidden")
+
+// ErrEmptyToken is returned by BearerToken for an empty token.
+var ErrEmptyToken = errors.New("admin: empty bearer token")
+
+// Authorizer decides whether r may perform action. A nil error permits the request.
+type Authorizer func(r *http.Request, action Action) error
+
+// ReadOnly permits read requests and rejects control requests. It is the
+// default authorizer.
+func ReadOnly(_ *http.Request, action Action) error {
+	if action != ActionRead {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// AllowAll permits every request. Use it only when the handler is protected
+// by other means, such as a network policy or an authenticating proxy.
+func AllowAll(*http.Request, Action) error {
+	return nil
+}
+
+// BearerToken returns an authorizer permitting requests carrying
+// "Authorization: Bearer <token>". It returns ErrEmptyToken if token is
+// empty, e.g. because the environment variable it was read from is not set,
+// since that would leave the handler unprotected.
+func BearerToken(token string) (Authorizer, error) {
+	if token == "" {
+		return nil, ErrEmptyToken
+	}
+	return func(r *http.Request, _ Action) error {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || got == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			return ErrUnauthorized
+		}
+		return nil
+	}, nil
+}
+
+type config struct {
+	authorize    Authorizer
+	closeTimeout time.Duration
+}
+
+// Option configures the admin handler.
+type Option func(*config)
+
+// WithAuthorizer sets the authorizer consulted for every request.
+func WithAuthorizer(a Authorizer) Option {
+	return func(c *config) {
+		c.authorize = a
+	}
+}
+
+// WithCloseTimeout sets how long POST /close waits for handlers to finish.
+func WithCloseTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.closeTimeout = d
+	}
+}
+
+// Route describes a registered route.
+type Route struct {
+	Topic string `json:"topic"`
+	// PayloadType is the Go type of typed routes, "" for raw routes.
+	PayloadType string   `json:"payload_type,omitempty"`
+	Middleware  []string `json:"middleware"`
+	Paused      bool     `json:"paused"`
+	// Timeout is the route handler timeout, e.g. "30s", "" if none.
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// Partition describes an assigned partition. Unknown offsets are -1.
+type Partition struct {
+	Topic         string `json:"topic"`
+	Partition     int32  `json:"partition"`
+	Committed     int64  `json:"committed"`
+	Position      int64  `json:"position"`
+	HighWatermark int64  `json:"high_watermark"`
+	Lag           int64  `json:"lag"`
+}
+
+// Offset is a partition offset reported by the seek endpoint.
+type Offset struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Offset    int64  `json:"offset"`
+}
+
+type handler struct {
+	router *kafkalight.KafkaRouter
+	cfg    *config
+}
+
+// New returns the admin handler for router. It serves:
+//
+//	GET  /routes                      registered routes, their middleware and pause state
+//	GET  /partitions                  assigned partitions with committed and current offsets
+//	POST /topics/{topic}/pause        pause the topic
+//	POST /topics/{topic}/resume       resume the topic
+//	POST /topics/{topic}/seek?time=T  seek the topic to T, RFC 3339 or Unix milliseconds
+//	POST /close                       close the router gracefully
+//
+// Mount it under a prefix with http.StripPrefix.
+func New(router *kafkalight.KafkaRouter, opts ...Option) http.Handler {
+	cfg := &config{
+		authorize:    ReadOnly,
+		closeTimeout: DefaultCloseTimeout,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	h := &handler{router: router, cfg: cfg}
+	mux := http.NewServeMux()
+	mux.Handle("GET /routes", h.guard(ActionRead, h.routes))
+	mux.Handle("GET /partitions", h.guard(ActionRead, h.partitions))
+	mux.Handle("POST /topics/{topic}/pause", h.guard(ActionControl, h.pause))
+	mux.Handle("POST /topics/{topic}/resume", h.guard(ActionControl, h.resume))
+	mux.Handle("POST /topics/{topic}/seek", h.guard(ActionControl, h.seek))
+	mux.Handle("POST /close", h.guard(ActionControl, h.close))
+	return mux
+}
+
+func (h *handler) guard(action Action, fn func(r *http.Request) (any, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := h.cfg.authorize(r, action); err != nil {
+			status := http.StatusForbidden
+			if errors.Is(err, ErrUnauthorized) {
+				status = http.StatusUnauthorized
+			}
+			writeJSON(w, status, errorBody(err))
+			return
+		}
+
+		body, err := fn(r)
+		if err != nil {
+			writeJSON(w, errorStatus(err), errorBody(err))
+			return
+		}
+		writeJSON(w, http.StatusOK, body)
+	})
+}
+
+func (h *handler) routes(*http.Request) (any, error) {
+	paused := make(map[string]bool)
+	for _, topic := range h.router.Paused() {
+		paused[topic] = true
+	}
+
+	infos := h.router.Routes()
+	routes := make([]Route, 0, len(infos))
+	for _, info := range infos {
+		route := Route{
+			Topic:      info.Topic,
+			Middleware: info.Middleware,
+			Paused:     paused[info.Topic],
+		}
+		if route.Middleware == nil {
+			route.Middleware = []string{}
+		}
+		if info.Timeout > 0 {
+			route.Timeout = info.Timeout.String()
+		}
+		if info.PayloadType != nil {
+			route.PayloadType = info.PayloadType.String()
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+func (h *handler) partitions(*http.Request) (any, error) {
+	offsets, err := h.router.Offsets()
+	if err != nil {
+		return nil, err
+	}
+
+	partitions := make([]Partition, 0, len(offsets))
+	for _, o := range offsets {
+		partitions = append(partitions, Partition{
+			Topic:         o.Topic,
+			Partition:     o.Partition,
+			Committed:     o.Committed,
+			Position:      o.Position,
+			HighWatermark: o.HighWatermark,
+			Lag:           o.Lag,
+		})
+	}
+	return partitions, nil
+}
+
+func (h *handler) pause(r *http.Request) (any, error) {
+	topic := r.PathValue("topic")
+	if err := h.router.Pause(topic); err != nil {
+		return nil, err
+	}
+	return map[string]string{"topic": topic, "status": "paused"}, nil
+}
+
+func (h *handler) resume(r *http.Request) (any, error) {
+	topic := r.PathValue("topic")
+	if err := h.router.Resume(topic); err != nil {
+		return nil, err
+	}
+	return map[string]string{"topic": topic, "status": "resumed"}, nil
+}
+
+func (h *handler) seek(r *http.Request) (any, error) {
+	t, err := parseTime(r.URL.Query().Get("time"))
+	if err != nil {
+		return nil, err
+	}
+
+	sought, err := h.router.SeekToTime(r.PathValue("topic"), t)
+	if err != nil {
+		return nil, err
+	}
+	offsets := make([]Offset, 0, len(sought))
+	for _, tp := range sought {
+		offsets = append(offsets, Offset{Topic: tp.Topic, Partition: tp.Partition, Offset: tp.Offset})
+	}
+	return offsets, nil
+}
+
+func (h *handler) close(r *http.Request) (any, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), h.cfg.closeTimeout)
+	defer cancel()
+
+	if err := h.router.Close(ctx); err != nil {
+		return nil, &conflictError{err: err}
+	}
+	return map[string]string{"status": "closed"}, nil
+}
+
+// badRequestError and conflictError select the response status of handler errors.
+type badRequestError struct{ err error }
+
+func (e *badRequestError) Error() string { return e.err.Error() }
+func (e *badRequestError) Unwrap() error { return e.err }
+
+type conflictError struct{ err error }
+
+func (e *conflictError) Error() string { return e.err.Error() }
+func (e *conflictError) Unwrap() error { return e.err }
+
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, &badRequestError{err: errors.New("missing time parameter")}
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	return time.Time{}, &badRequestError{err: errors.New("time must be an RFC 3339 timestamp or Unix milliseconds")}
+}
+
+func errorStatus(err error) int {
+	var badRequest *badRequestError
+	var conflict *conflictError
+	switch {
+	case errors.Is(err, kafkalight.ErrRouteNotFound):
+		return http.StatusNotFound
+	case errors.As(err, &badRequest):
+		return http.StatusBadRequest
+	case errors.As(err, &conflict):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func errorBody(err error) map[string]string {
+	return map[string]string{"error": err.Error()}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
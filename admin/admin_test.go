@@ -0,0 +1,145 @@
+package admin_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/overtonx/kafkalight"
+	"github.com/overtonx/kafkalight/admin"
+	"github.com/overtonx/kafkalight/kafkalighttest"
+	"github.com/overtonx/kafkalight/middleware"
+)
+
+func do(t *testing.T, h http.Handler, method, target string, out any) int {
+	t.Helper()
+
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if out != nil {
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), out), rec.Body.String())
+	}
+	return rec.Code
+}
+
+func TestAdmin(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	broker := kafkalighttest.NewBroker()
+	broker.CreateTopic("orders", 1)
+	for i, value := range []string{"a", "b"} {
+		msg := kafkalighttest.NewMessage("orders", "", value)
+		msg.Timestamp = start.Add(time.Duration(i) * time.Hour)
+		broker.MustProduce(t, msg)
+	}
+
+	var (
+		mu  sync.Mutex
+		got []string
+	)
+	group := broker.ConsumerGroup("group")
+	router := kafkalighttest.NewRouter(t, group)
+	router.Use(middleware.Recovery())
+	router.RegisterRoute("orders", func(_ context.Context, msg *kafkalight.Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, string(msg.Value))
+		return nil
+	})
+	authorize, err := admin.BearerToken("secret")
+	require.NoError(t, err)
+	h := admin.New(router, admin.WithAuthorizer(authorize))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/routes", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	kafkalighttest.Start(t, router)
+	group.WaitProcessed(t, 2)
+
+	require.Equal(t, http.StatusOK, do(t, h, http.MethodPost, "/topics/orders/pause", nil))
+	var routes []admin.Route
+	require.Equal(t, http.StatusOK, do(t, h, http.MethodGet, "/routes", &routes))
+	assert.Equal(t, []admin.Route{{Topic: "orders", Middleware: []string{"middleware.Recovery"}, Paused: true}}, routes)
+
+	broker.MustProduce(t, kafkalighttest.NewMessage("orders", "", "c"))
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 2, group.Processed(), "paused topics are not consumed")
+
+	require.Equal(t, http.StatusOK, do(t, h, http.MethodPost, "/topics/orders/resume", nil))
+	group.WaitProcessed(t, 3)
+
+	var partitions []admin.Partition
+	require.Equal(t, http.StatusOK, do(t, h, http.MethodGet, "/partitions", &partitions))
+	assert.Equal(t, []admin.Partition{{Topic: "orders", Committed: 3, Position: 3, HighWatermark: 3}}, partitions)
+
+	var offsets []admin.Offset
+	seek := "/topics/orders/seek?time=" + start.Add(30*time.Minute).Format(time.RFC3339)
+	require.Equal(t, http.StatusOK, do(t, h, http.MethodPost, seek, &offsets))
+	assert.Equal(t, []admin.Offset{{Topic: "orders", Offset: 1}}, offsets)
+	group.WaitProcessed(t, 5)
+
+	mu.Lock()
+	assert.Equal(t, []string{"a", "b", "c", "b", "c"}, got)
+	mu.Unlock()
+
+	assert.Equal(t, http.StatusNotFound, do(t, h, http.MethodPost, "/topics/missing/pause", nil))
+	assert.Equal(t, http.StatusBadRequest, do(t, h, http.MethodPost, "/topics/orders/seek?time=yesterday", nil))
+}
+
+func TestAdmin_ReadOnlyByDefault(t *testing.T) {
+	router := kafkalighttest.NewRouter(t, kafkalighttest.NewBroker().ConsumerGroup("group"))
+	router.RegisterRoute("orders", func(context.Context, *kafkalight.Message) error { return nil })
+	h := admin.New(router)
+
+	var routes []admin.Route
+	assert.Equal(t, http.StatusOK, do(t, h, http.MethodGet, "/routes", &routes))
+	assert.Len(t, routes, 1)
+	assert.Equal(t, http.StatusForbidden, do(t, h, http.MethodPost, "/topics/orders/pause", nil))
+	assert.Empty(t, router.Paused())
+}
+
+func TestAdmin_Close(t *testing.T) {
+	router := kafkalighttest.NewRouter(t, kafkalighttest.NewBroker().ConsumerGroup("group"))
+	router.RegisterRoute("orders", func(context.Context, *kafkalight.Message) error { return nil })
+	h := admin.New(router, admin.WithAuthorizer(admin.AllowAll))
+
+	done := make(chan error, 1)
+	go func() { done <- router.StartListening(context.Background()) }()
+	require.Eventually(t, func() bool { return router.Health().Started }, time.Second, 5*time.Millisecond)
+
+	assert.Equal(t, http.StatusOK, do(t, h, http.MethodPost, "/close", nil))
+	select {
+	case <-done:
+	case <-time.After(kafkalighttest.DefaultWaitTimeout):
+		t.Fatal("router did not stop listening")
+	}
+	assert.Equal(t, http.StatusConflict, do(t, h, http.MethodPost, "/close", nil))
+}
+
+func TestBearerToken(t *testing.T) {
+	_, err := admin.BearerToken("")
+	assert.ErrorIs(t, err, admin.ErrEmptyToken, "an empty token would leave the handler unprotected")
+
+	authorize, err := admin.BearerToken("secret")
+	require.NoError(t, err)
+	for header, want := range map[string]error{
+		"Bearer secret": nil,
+		"Bearer ":       admin.ErrUnauthorized,
+		"Bearer other":  admin.ErrUnauthorized,
+		"secret":        admin.ErrUnauthorized,
+		"":              admin.ErrUnauthorized,
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/close", nil)
+		r.Header.Set("Authorization", header)
+		assert.Equal(t, want, authorize(r, admin.ActionControl), header)
+	}
+}
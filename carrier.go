@@ -5,7 +5,8 @@ import "go.opentelemetry.io/otel/propagation"
 var _ propagation.TextMapCarrier = &MessageCarrier{}
 
 // MessageCarrier implements propagation.TextMapCarrier.
-// It is used to extract trace context from a message's headers.
+// It is used to extract trace context from a message's headers and to
+// inject it into the headers of outgoing messages.
 type MessageCarrier struct {
 	msg *Message
 }
@@ -25,13 +26,10 @@ func (mc *MessageCarrier) Get(key string) string {
 	return ""
 }
 
-// Set sets the value associated with the given key.
+// Set sets the value associated with the given key, replacing any existing
+// header with that key.
 func (mc *MessageCarrier) Set(key string, value string) {
-	header := Header{
-		Key:   key,
-		Value: []byte(value),
-	}
-	mc.msg.Headers = append(mc.msg.Headers, header)
+	mc.msg.SetHeader(key, []byte(value))
 }
 
 // Keys returns a slice of all keys in the carrier.
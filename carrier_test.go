@@ -19,6 +19,12 @@ func TestMessageCarrier(t *testing.T) {
 		assert.Equal(t, "", carrier.Get("baz"))
 	})
 
+	t.Run("Set replaces", func(t *testing.T) {
+		carrier.Set("foo", "baz")
+		assert.Equal(t, "baz", carrier.Get("foo"))
+		assert.Len(t, msg.Headers, 1)
+	})
+
 	t.Run("Keys", func(t *testing.T) {
 		carrier.Set("key1", "val1")
 		carrier.Set("key2", "val2")
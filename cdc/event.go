@@ -0,0 +1,229 @@
+// Package cdc decodes Debezium change event envelopes produced with the JSON
+// converter, with or without embedded schemas, and routes them to handlers by
+// operation.
+package cdc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ErrTombstone is returned by Decode for tombstone messages, which carry a
+// key and no value and follow delete events so that compaction can drop the
+// key.
+var ErrTombstone = errors.New("tombstone message")
+
+// Op is the kind of change described by an event.
+type Op string
+
+// Debezium operation codes.
+const (
+	OpCreate   Op = "c"
+	OpUpdate   Op = "u"
+	OpDelete   Op = "d"
+	OpSnapshot Op = "r" // read during an initial or incremental snapshot
+	OpTruncate Op = "t"
+	OpMessage  Op = "m"
+)
+
+// String returns the readable name of the operation.
+func (o Op) String() string {
+	switch o {
+	case OpCreate:
+		return "create"
+	case OpUpdate:
+		return "update"
+	case OpDelete:
+		return "delete"
+	case OpSnapshot:
+		return "snapshot"
+	case OpTruncate:
+		return "truncate"
+	case OpMessage:
+		return "message"
+	default:
+		return string(o)
+	}
+}
+
+// Source is the source metadata of a change event. Fields that are not common
+// to all connectors, such as lsn or binlog positions, are available in Raw.
+type Source struct {
+	Version   string
+	Connector string
+	Name      string
+	Timestamp time.Time
+	// Snapshot is "true", "last", "incremental" or "false" ("" if absent).
+	Snapshot string
+	DB       string
+	Schema   string
+	Table    string
+	Raw      json.RawMessage
+}
+
+// Transaction is the transaction metadata of a change event.
+type Transaction struct {
+	ID                  string `json:"id"`
+	TotalOrder          int64  `json:"total_order"`
+	DataCollectionOrder int64  `json:"data_collection_order"`
+}
+
+// ChangeEvent is a decoded Debezium change event. Before is nil for creates
+// and snapshot reads, After is nil for deletes.
+type ChangeEvent[T any] struct {
+	Op          Op
+	Before      *T
+	After       *T
+	Source      Source
+	Transaction *Transaction
+	Timestamp   time.Time
+}
+
+// Decode decodes a Debezium change event from a message value. It returns
+// ErrTombstone for empty values.
+func Decode[T any](value []byte) (*ChangeEvent[T], error) {
+	payload, err := unwrap(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var envelope struct {
+		Op          Op              `json:"op"`
+		Before      json.RawMessage `json:"before"`
+		After       json.RawMessage `json:"after"`
+		Source      json.RawMessage `json:"source"`
+		Transaction *Transaction    `json:"transaction"`
+		TsMs        int64           `json:"ts_ms"`
+	}
+	if err := json.Unmarshal(payload, &envelope); err != nil {
+		return nil, fmt.Errorf("decode envelope: %w", err)
+	}
+	if envelope.Op == "" {
+		return nil, errors.New("decode envelope: missing op")
+	}
+
+	evt := &ChangeEvent[T]{
+		Op:          envelope.Op,
+		Transaction: envelope.Transaction,
+		Timestamp:   fromMillis(envelope.TsMs),
+	}
+	if evt.Before, err = decodeImage[T](envelope.Before); err != nil {
+		return nil, fmt.Errorf("decode before: %w", err)
+	}
+	if evt.After, err = decodeImage[T](envelope.After); err != nil {
+		return nil, fmt.Errorf("decode after: %w", err)
+	}
+	if evt.Source, err = decodeSource(envelope.Source); err != nil {
+		return nil, fmt.Errorf("decode source: %w", err)
+	}
+	return evt, nil
+}
+
+// DecodeKey decodes a Debezium message key into v, stripping the schema
+// envelope if present. It is useful for tombstones, which carry only the key.
+func DecodeKey(key []byte, v any) error {
+	payload, err := unwrap(key)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(payload, v)
+}
+
+// unwrap returns the payload of a {"schema": ..., "payload": ...} envelope,
+// or data itself when schemas are disabled in the converter.
+func unwrap(data []byte) ([]byte, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, ErrTombstone
+	}
+
+	var envelope struct {
+		Schema  json.RawMessage `json:"schema"`
+		Payload json.RawMessage `json:"payload"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, err
+	}
+	if envelope.Schema == nil || envelope.Payload == nil {
+		return data, nil
+	}
+	if isNull(envelope.Payload) {
+		return nil, ErrTombstone
+	}
+	return envelope.Payload, nil
+}
+
+func decodeImage[T any](raw json.RawMessage) (*T, error) {
+	if isNull(raw) {
+		return nil, nil
+	}
+	image := new(T)
+	if err := json.Unmarshal(raw, image); err != nil {
+		return nil, err
+	}
+	return image, nil
+}
+
+func decodeSource(raw json.RawMessage) (Source, error) {
+	if isNull(raw) {
+		return Source{}, nil
+	}
+
+	var source struct {
+		Version   string          `json:"version"`
+		Connector string          `json:"connector"`
+		Name      string          `json:"name"`
+		TsMs      int64           `json:"ts_ms"`
+		Snapshot  json.RawMessage `json:"snapshot"`
+		DB        string          `json:"db"`
+		Schema    string          `json:"schema"`
+		Table     string          `json:"table"`
+	}
+	if err := json.Unmarshal(raw, &source); err != nil {
+		return Source{}, err
+	}
+
+	return Source{
+		Version:   source.Version,
+		Connector: source.Connector,
+		Name:      source.Name,
+		Timestamp: fromMillis(source.TsMs),
+		Snapshot:  snapshotValue(source.Snapshot),
+		DB:        source.DB,
+		Schema:    source.Schema,
+		Table:     source.Table,
+		Raw:       raw,
+	}, nil
+}
+
+// snapshotValue normalises the snapshot field, which older connectors emit as
+// a boolean and newer ones as a string.
+func snapshotValue(raw json.RawMessage) string {
+	if isNull(raw) {
+		return ""
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	var b bool
+	if err := json.Unmarshal(raw, &b); err == nil {
+		return strconv.FormatBool(b)
+	}
+	return string(raw)
+}
+
+func fromMillis(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms).UTC()
+}
+
+func isNull(raw json.RawMessage) bool {
+	trimmed := bytes.TrimSpace(raw)
+	return len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null"))
+}
@@ -0,0 +1,102 @@
+package cdc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type customer struct {
+	ID    int    `json:"id"`
+	Email string `json:"email"`
+}
+
+const updatePayload = `{
+	"before": {"id": 1, "email": "old@example.com"},
+	"after": {"id": 1, "email": "new@example.com"},
+	"source": {
+		"version": "2.5.0.Final", "connector": "postgresql", "name": "dbserver1",
+		"ts_ms": 1700000000000, "snapshot": "false", "db": "inventory",
+		"schema": "public", "table": "customers", "lsn": 24023128
+	},
+	"op": "u",
+	"ts_ms": 1700000000123,
+	"transaction": {"id": "571:24023128", "total_order": 2, "data_collection_order": 1}
+}`
+
+func TestDecode(t *testing.T) {
+	evt, err := Decode[customer]([]byte(updatePayload))
+	require.NoError(t, err)
+
+	assert.Equal(t, OpUpdate, evt.Op)
+	assert.Equal(t, "update", evt.Op.String())
+	assert.Equal(t, &customer{ID: 1, Email: "old@example.com"}, evt.Before)
+	assert.Equal(t, &customer{ID: 1, Email: "new@example.com"}, evt.After)
+	assert.Equal(t, time.UnixMilli(1700000000123).UTC(), evt.Timestamp)
+	assert.Equal(t, &Transaction{ID: "571:24023128", TotalOrder: 2, DataCollectionOrder: 1}, evt.Transaction)
+
+	assert.Equal(t, "postgresql", evt.Source.Connector)
+	assert.Equal(t, "dbserver1", evt.Source.Name)
+	assert.Equal(t, "inventory", evt.Source.DB)
+	assert.Equal(t, "public", evt.Source.Schema)
+	assert.Equal(t, "customers", evt.Source.Table)
+	assert.Equal(t, "false", evt.Source.Snapshot)
+	assert.Equal(t, time.UnixMilli(1700000000000).UTC(), evt.Source.Timestamp)
+	assert.Contains(t, string(evt.Source.Raw), `"lsn": 24023128`)
+}
+
+func TestDecodeSchemaEnvelope(t *testing.T) {
+	value := `{"schema": {"type": "struct", "optional": false}, "payload": {
+		"before": null, "after": {"id": 2, "email": "a@example.com"},
+		"source": {"connector": "mysql", "snapshot": true}, "op": "r", "ts_ms": 1
+	}}`
+
+	evt, err := Decode[customer]([]byte(value))
+	require.NoError(t, err)
+
+	assert.Equal(t, OpSnapshot, evt.Op)
+	assert.Nil(t, evt.Before)
+	assert.Equal(t, &customer{ID: 2, Email: "a@example.com"}, evt.After)
+	assert.Equal(t, "true", evt.Source.Snapshot)
+	assert.Nil(t, evt.Transaction)
+}
+
+func TestDecodeTombstone(t *testing.T) {
+	for name, value := range map[string]string{
+		"empty value":  "",
+		"null payload": `{"schema": null, "payload": null}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := Decode[customer]([]byte(value))
+			assert.ErrorIs(t, err, ErrTombstone)
+		})
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	for name, value := range map[string]string{
+		"not json":   `nope`,
+		"missing op": `{"after": {"id": 1}}`,
+		"bad image":  `{"op": "c", "after": {"id": "x"}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := Decode[customer]([]byte(value))
+			assert.Error(t, err)
+			assert.NotErrorIs(t, err, ErrTombstone)
+		})
+	}
+}
+
+func TestDecodeKey(t *testing.T) {
+	var key struct {
+		ID int `json:"id"`
+	}
+
+	require.NoError(t, DecodeKey([]byte(`{"schema": {"type": "struct"}, "payload": {"id": 7}}`), &key))
+	assert.Equal(t, 7, key.ID)
+
+	require.NoError(t, DecodeKey([]byte(`{"id": 8}`), &key))
+	assert.Equal(t, 8, key.ID)
+}
@@ -0,0 +1,115 @@
+package cdc
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+
+	"github.com/overtonx/kafkalight"
+)
+
+// ChangeHandler handles a change event decoded from msg.
+type ChangeHandler[T any] func(ctx context.Context, msg *kafkalight.Message, evt *ChangeEvent[T]) error
+
+// Handler adapts fn to a MessageHandler that decodes every change event into
+// ChangeEvent[T]. Tombstones are skipped. Decode failures are returned as
+// *kafkalight.DecodeError without calling fn.
+func Handler[T any](fn ChangeHandler[T]) kafkalight.MessageHandler {
+	return func(ctx context.Context, msg *kafkalight.Message) error {
+		evt, err := decodeMessage[T](msg)
+		if errors.Is(err, ErrTombstone) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return fn(ctx, msg, evt)
+	}
+}
+
+// Router dispatches change events to handlers registered per operation.
+// Events of operations without a handler, and tombstones without a tombstone
+// handler, are acknowledged without processing. Its Handle method is a
+// MessageHandler:
+//
+//	orders := cdc.NewRouter[Order]()
+//	orders.OnCreate(onOrderCreated)
+//	orders.OnDelete(onOrderDeleted)
+//	router.RegisterRoute("dbserver1.inventory.orders", orders.Handle)
+type Router[T any] struct {
+	mu        sync.RWMutex
+	handlers  map[Op]ChangeHandler[T]
+	tombstone kafkalight.MessageHandler
+}
+
+// NewRouter creates a Router without handlers.
+func NewRouter[T any]() *Router[T] {
+	return &Router[T]{handlers: make(map[Op]ChangeHandler[T])}
+}
+
+// On registers h for events of op, replacing any previous handler.
+func (r *Router[T]) On(op Op, h ChangeHandler[T]) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[op] = h
+}
+
+// OnCreate registers h for inserts.
+func (r *Router[T]) OnCreate(h ChangeHandler[T]) { r.On(OpCreate, h) }
+
+// OnUpdate registers h for updates.
+func (r *Router[T]) OnUpdate(h ChangeHandler[T]) { r.On(OpUpdate, h) }
+
+// OnDelete registers h for deletes.
+func (r *Router[T]) OnDelete(h ChangeHandler[T]) { r.On(OpDelete, h) }
+
+// OnSnapshot registers h for rows read during a snapshot.
+func (r *Router[T]) OnSnapshot(h ChangeHandler[T]) { r.On(OpSnapshot, h) }
+
+// OnTombstone registers h for tombstones. Use DecodeKey to read the key of
+// the deleted row.
+func (r *Router[T]) OnTombstone(h kafkalight.MessageHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tombstone = h
+}
+
+// Handle decodes msg and dispatches it to the handler for its operation.
+func (r *Router[T]) Handle(ctx context.Context, msg *kafkalight.Message) error {
+	evt, err := decodeMessage[T](msg)
+	if errors.Is(err, ErrTombstone) {
+		r.mu.RLock()
+		h := r.tombstone
+		r.mu.RUnlock()
+
+		if h == nil {
+			return nil
+		}
+		return h(ctx, msg)
+	}
+	if err != nil {
+		return err
+	}
+
+	r.mu.RLock()
+	h, ok := r.handlers[evt.Op]
+	r.mu.RUnlock()
+
+	if !ok {
+		return nil
+	}
+	return h(ctx, msg, evt)
+}
+
+func decodeMessage[T any](msg *kafkalight.Message) (*ChangeEvent[T], error) {
+	evt, err := Decode[T](msg.Value)
+	if err != nil && !errors.Is(err, ErrTombstone) {
+		return nil, &kafkalight.DecodeError{
+			TopicPartition: msg.TopicPartition,
+			Type:           reflect.TypeFor[ChangeEvent[T]](),
+			Err:            err,
+		}
+	}
+	return evt, err
+}
@@ -0,0 +1,98 @@
+package cdc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/overtonx/kafkalight"
+)
+
+func newMessage(value string) *kafkalight.Message {
+	key, _ := kafkalight.NewKey(`{"id": 1}`)
+	return &kafkalight.Message{
+		TopicPartition: kafkalight.TopicPartition{Topic: "dbserver1.public.customers", Partition: 0, Offset: 3},
+		Key:            *key,
+		Value:          []byte(value),
+	}
+}
+
+func TestRouter(t *testing.T) {
+	var calls []string
+	record := func(name string) ChangeHandler[customer] {
+		return func(ctx context.Context, msg *kafkalight.Message, evt *ChangeEvent[customer]) error {
+			calls = append(calls, name)
+			return nil
+		}
+	}
+
+	r := NewRouter[customer]()
+	r.OnCreate(record("create"))
+	r.OnUpdate(record("update"))
+	r.OnDelete(func(ctx context.Context, msg *kafkalight.Message, evt *ChangeEvent[customer]) error {
+		assert.Nil(t, evt.After)
+		assert.Equal(t, 1, evt.Before.ID)
+		calls = append(calls, "delete")
+		return nil
+	})
+	r.OnSnapshot(record("snapshot"))
+
+	ctx := context.Background()
+	require.NoError(t, r.Handle(ctx, newMessage(`{"op": "c", "after": {"id": 1}}`)))
+	require.NoError(t, r.Handle(ctx, newMessage(updatePayload)))
+	require.NoError(t, r.Handle(ctx, newMessage(`{"op": "r", "after": {"id": 1}}`)))
+	require.NoError(t, r.Handle(ctx, newMessage(`{"op": "d", "before": {"id": 1}}`)))
+	assert.Equal(t, []string{"create", "update", "snapshot", "delete"}, calls)
+
+	t.Run("unhandled operation and tombstone are skipped", func(t *testing.T) {
+		calls = nil
+		require.NoError(t, r.Handle(ctx, newMessage(`{"op": "t"}`)))
+		require.NoError(t, r.Handle(ctx, newMessage("")))
+		assert.Empty(t, calls)
+	})
+
+	t.Run("tombstone handler", func(t *testing.T) {
+		var deletedID int
+		r.OnTombstone(func(ctx context.Context, msg *kafkalight.Message) error {
+			var key struct {
+				ID int `json:"id"`
+			}
+			if err := DecodeKey(msg.Key.Bytes(), &key); err != nil {
+				return err
+			}
+			deletedID = key.ID
+			return nil
+		})
+
+		require.NoError(t, r.Handle(ctx, newMessage("")))
+		assert.Equal(t, 1, deletedID)
+	})
+
+	t.Run("decode error is permanent", func(t *testing.T) {
+		err := r.Handle(ctx, newMessage(`{"op": "c", "after": "oops"}`))
+
+		var decodeErr *kafkalight.DecodeError
+		require.ErrorAs(t, err, &decodeErr)
+		assert.Equal(t, int64(3), int64(decodeErr.TopicPartition.Offset))
+		assert.True(t, kafkalight.IsPermanent(err))
+	})
+}
+
+func TestHandler(t *testing.T) {
+	var ops []Op
+	handler := Handler(func(ctx context.Context, msg *kafkalight.Message, evt *ChangeEvent[customer]) error {
+		ops = append(ops, evt.Op)
+		return nil
+	})
+
+	ctx := context.Background()
+	require.NoError(t, handler(ctx, newMessage(`{"op": "c", "after": {"id": 1}}`)))
+	require.NoError(t, handler(ctx, newMessage(`{"op": "d", "before": {"id": 1}}`)))
+	require.NoError(t, handler(ctx, newMessage("")))
+	assert.Equal(t, []Op{OpCreate, OpDelete}, ops)
+
+	err := handler(ctx, newMessage(`[]`))
+	assert.True(t, kafkalight.IsPermanent(err))
+}
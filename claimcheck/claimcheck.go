@@ -0,0 +1,162 @@
+package claimcheck
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"go.uber.org/zap"
+
+	"github.com/overtonx/kafkalight"
+)
+
+const (
+	// HeaderClaimCheck carries the BlobStore key of an offloaded payload.
+	HeaderClaimCheck = "claim-check"
+	// HeaderClaimCheckSize carries the size of an offloaded payload in bytes.
+	HeaderClaimCheckSize = "claim-check-size"
+
+	// DefaultThreshold is the payload size above which Offload stores the
+	// payload, leaving room for headers below the broker default
+	// message.max.bytes of about 1 MiB.
+	DefaultThreshold = 900 << 10
+)
+
+type config struct {
+	threshold int
+	keyFunc   func(msg *kafkalight.Message) string
+	delete    bool
+	logger    *zap.Logger
+}
+
+// Option configures Offload and Fetch.
+type Option func(*config)
+
+// WithThreshold sets the payload size in bytes above which Offload stores
+// the payload. The default is DefaultThreshold.
+func WithThreshold(n int) Option {
+	return func(c *config) {
+		c.threshold = n
+	}
+}
+
+// WithKeyFunc sets the function that generates BlobStore keys for Offload.
+// By default keys are "<topic>/<random hex>".
+func WithKeyFunc(fn func(msg *kafkalight.Message) string) Option {
+	return func(c *config) {
+		c.keyFunc = fn
+	}
+}
+
+// WithDeleteAfterProcessing makes Fetch delete the blob once the handler has
+// processed the message successfully. Only use it when a message has a single
+// consumer group.
+func WithDeleteAfterProcessing() Option {
+	return func(c *config) {
+		c.delete = true
+	}
+}
+
+// WithLogger sets the logger that reports blobs Fetch failed to delete. By
+// default the logger of the handler context is used, see
+// kafkalight.LoggerFromContext.
+func WithLogger(logger *zap.Logger) Option {
+	return func(c *config) {
+		c.logger = logger
+	}
+}
+
+func newConfig(opts []Option) *config {
+	cfg := &config{threshold: DefaultThreshold, keyFunc: randomKey}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// Offload returns a producer middleware that stores values larger than the
+// threshold in store and sends the message with an empty value and a
+// claim-check header instead. It should be the innermost producer middleware,
+// so that the stored payload is already compressed or encrypted. The caller's
+// message is not modified apart from the partition and offset written back on
+// delivery.
+func Offload(store BlobStore, opts ...Option) kafkalight.ProducerMiddleware {
+	cfg := newConfig(opts)
+
+	return func(next kafkalight.Producer) kafkalight.Producer {
+		return kafkalight.ProducerFunc(func(ctx context.Context, msg *kafkalight.Message) error {
+			if len(msg.Value) <= cfg.threshold {
+				return next.Produce(ctx, msg)
+			}
+
+			key := cfg.keyFunc(msg)
+			if err := store.Put(ctx, key, msg.Value); err != nil {
+				return fmt.Errorf("store payload %s: %w", key, err)
+			}
+
+			out := *msg
+			out.Headers = append([]kafkalight.Header(nil), msg.Headers...)
+			out.Value = nil
+			out.SetHeader(HeaderClaimCheck, []byte(key))
+			out.SetHeader(HeaderClaimCheckSize, []byte(strconv.Itoa(len(msg.Value))))
+
+			err := next.Produce(ctx, &out)
+			msg.TopicPartition = out.TopicPartition
+			return err
+		})
+	}
+}
+
+// Fetch returns a middleware that loads the payload referenced by the
+// claim-check header into Message.Value and removes the claim-check headers.
+// Messages without the header pass through untouched. A missing blob is a
+// permanent error; other store errors are returned as is.
+func Fetch(store BlobStore, opts ...Option) kafkalight.Middleware {
+	cfg := newConfig(opts)
+
+	return func(next kafkalight.MessageHandler) kafkalight.MessageHandler {
+		return func(ctx context.Context, msg *kafkalight.Message) error {
+			key, ok := msg.Header(HeaderClaimCheck)
+			if !ok {
+				return next(ctx, msg)
+			}
+
+			value, err := store.Get(ctx, string(key))
+			if err != nil {
+				err = fmt.Errorf("fetch payload for %s[%d]@%d: %w",
+					msg.TopicPartition.Topic, msg.TopicPartition.Partition, msg.TopicPartition.Offset, err)
+				if errors.Is(err, ErrNotFound) {
+					return kafkalight.Permanent(err)
+				}
+				return err
+			}
+
+			msg.Value = value
+			msg.DelHeader(HeaderClaimCheck, HeaderClaimCheckSize)
+
+			if err := next(ctx, msg); err != nil {
+				return err
+			}
+
+			if cfg.delete {
+				if err := store.Delete(ctx, string(key)); err != nil {
+					logger := cfg.logger
+					if logger == nil {
+						logger = kafkalight.LoggerFromContext(ctx)
+					}
+					logger.Warn("claimcheck: failed to delete payload", zap.ByteString("claim_check", key), zap.Error(err))
+				}
+			}
+			return nil
+		}
+	}
+}
+
+func randomKey(msg *kafkalight.Message) string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return msg.TopicPartition.Topic + "/" + hex.EncodeToString(b[:])
+}
@@ -0,0 +1,108 @@
+package claimcheck
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/overtonx/kafkalight"
+)
+
+func offloadForTest(t *testing.T, store BlobStore, msg *kafkalight.Message, opts ...Option) *kafkalight.Message {
+	t.Helper()
+
+	var sent *kafkalight.Message
+	producer := Offload(store, opts...)(kafkalight.ProducerFunc(func(ctx context.Context, msg *kafkalight.Message) error {
+		sent = msg
+		return nil
+	}))
+	require.NoError(t, producer.Produce(context.Background(), msg))
+	return sent
+}
+
+func TestOffloadFetch(t *testing.T) {
+	store := NewMemoryStore()
+	payload := bytes.Repeat([]byte("x"), 2048)
+
+	original := &kafkalight.Message{
+		TopicPartition: kafkalight.TopicPartition{Topic: "reports"},
+		Value:          payload,
+		Headers:        []kafkalight.Header{{Key: "event-type", Value: []byte("report.generated")}},
+	}
+	sent := offloadForTest(t, store, original, WithThreshold(1024))
+
+	assert.Empty(t, sent.Value)
+	key, ok := sent.Header(HeaderClaimCheck)
+	require.True(t, ok)
+	assert.True(t, strings.HasPrefix(string(key), "reports/"))
+	size, _ := sent.Header(HeaderClaimCheckSize)
+	assert.Equal(t, "2048", string(size))
+	assert.Equal(t, 1, store.Len())
+	assert.Equal(t, payload, original.Value, "caller's message is not modified")
+
+	var received *kafkalight.Message
+	handler := Fetch(store)(func(ctx context.Context, msg *kafkalight.Message) error {
+		received = msg
+		return nil
+	})
+	require.NoError(t, handler(context.Background(), sent))
+
+	assert.Equal(t, payload, received.Value)
+	assert.Equal(t, []kafkalight.Header{{Key: "event-type", Value: []byte("report.generated")}}, received.Headers)
+	assert.Equal(t, 1, store.Len(), "blob is kept by default")
+}
+
+func TestOffloadSmallPayload(t *testing.T) {
+	store := NewMemoryStore()
+	sent := offloadForTest(t, store, &kafkalight.Message{Value: []byte("small")})
+
+	assert.Equal(t, []byte("small"), sent.Value)
+	assert.Empty(t, sent.Headers)
+	assert.Equal(t, 0, store.Len())
+}
+
+func TestOffloadKeyFunc(t *testing.T) {
+	store := NewMemoryStore()
+	sent := offloadForTest(t, store, &kafkalight.Message{Value: []byte("payload")},
+		WithThreshold(1), WithKeyFunc(func(msg *kafkalight.Message) string { return "fixed" }))
+
+	key, _ := sent.Header(HeaderClaimCheck)
+	assert.Equal(t, "fixed", string(key))
+}
+
+func TestFetchDeleteAfterProcessing(t *testing.T) {
+	store := NewMemoryStore()
+	newSent := func() *kafkalight.Message {
+		return offloadForTest(t, store, &kafkalight.Message{Value: []byte("payload")}, WithThreshold(1))
+	}
+
+	failing := Fetch(store, WithDeleteAfterProcessing())(func(ctx context.Context, msg *kafkalight.Message) error {
+		return errors.New("boom")
+	})
+	assert.Error(t, failing(context.Background(), newSent()))
+	assert.Equal(t, 1, store.Len(), "blob is kept when processing fails")
+
+	succeeding := Fetch(store, WithDeleteAfterProcessing())(func(ctx context.Context, msg *kafkalight.Message) error {
+		return nil
+	})
+	require.NoError(t, succeeding(context.Background(), newSent()))
+	assert.Equal(t, 1, store.Len(), "only the processed blob is deleted")
+}
+
+func TestFetchMissingBlob(t *testing.T) {
+	handler := Fetch(NewMemoryStore())(func(ctx context.Context, msg *kafkalight.Message) error {
+		t.Fatal("handler must not be called")
+		return nil
+	})
+
+	msg := &kafkalight.Message{Headers: []kafkalight.Header{{Key: HeaderClaimCheck, Value: []byte("gone")}}}
+	err := handler(context.Background(), msg)
+
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.True(t, kafkalight.IsPermanent(err))
+}
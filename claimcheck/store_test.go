@@ -0,0 +1,50 @@
+package claimcheck
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStores(t *testing.T) {
+	fileStore, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	for name, store := range map[string]BlobStore{
+		"memory": NewMemoryStore(),
+		"file":   fileStore,
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			_, err := store.Get(ctx, "orders/missing")
+			assert.ErrorIs(t, err, ErrNotFound)
+
+			require.NoError(t, store.Put(ctx, "orders/a", []byte("payload")))
+			data, err := store.Get(ctx, "orders/a")
+			require.NoError(t, err)
+			assert.Equal(t, []byte("payload"), data)
+
+			require.NoError(t, store.Put(ctx, "orders/a", []byte("replaced")))
+			data, err = store.Get(ctx, "orders/a")
+			require.NoError(t, err)
+			assert.Equal(t, []byte("replaced"), data)
+
+			require.NoError(t, store.Delete(ctx, "orders/a"))
+			require.NoError(t, store.Delete(ctx, "orders/a"))
+			_, err = store.Get(ctx, "orders/a")
+			assert.ErrorIs(t, err, ErrNotFound)
+		})
+	}
+}
+
+func TestFileStoreRejectsEscapingKeys(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	for _, key := range []string{"../outside", "/etc/passwd", ""} {
+		assert.Error(t, store.Put(context.Background(), key, []byte("x")), key)
+	}
+}
@@ -0,0 +1,125 @@
+// Package cloudevents converts kafkalight messages to and from CloudEvents
+// following the Kafka protocol binding, in binary mode (ce_* headers) and
+// structured mode (application/cloudevents+json), and adapts handlers to
+// receive events.
+package cloudevents
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/overtonx/kafkalight"
+)
+
+// SpecVersion is the CloudEvents specification version produced by this package.
+const SpecVersion = "1.0"
+
+// ErrInvalidEvent is returned for events missing required attributes.
+var ErrInvalidEvent = errors.New("invalid cloudevent")
+
+// Event is a CloudEvent. Extension attribute values are kept as strings.
+type Event struct {
+	ID              string
+	Source          string
+	SpecVersion     string
+	Type            string
+	Subject         string
+	Time            time.Time
+	DataContentType string
+	DataSchema      string
+	Extensions      map[string]string
+	Data            []byte
+}
+
+// New creates an event with the given attributes and the current time.
+func New(id, source, eventType string) *Event {
+	return &Event{
+		ID:          id,
+		Source:      source,
+		SpecVersion: SpecVersion,
+		Type:        eventType,
+		Time:        time.Now().UTC(),
+	}
+}
+
+// Validate checks that the required attributes are set.
+func (e *Event) Validate() error {
+	var missing []string
+	if e.ID == "" {
+		missing = append(missing, "id")
+	}
+	if e.Source == "" {
+		missing = append(missing, "source")
+	}
+	if e.SpecVersion == "" {
+		missing = append(missing, "specversion")
+	}
+	if e.Type == "" {
+		missing = append(missing, "type")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: missing %s", ErrInvalidEvent, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// SetExtension sets an extension attribute.
+func (e *Event) SetExtension(name, value string) {
+	if e.Extensions == nil {
+		e.Extensions = make(map[string]string)
+	}
+	e.Extensions[name] = value
+}
+
+// DataAs decodes the event data into v with the codec registered in
+// kafkalight.DefaultCodecs for the data content type, JSON by default.
+func (e *Event) DataAs(v any) error {
+	codec, err := e.codec()
+	if err != nil {
+		return err
+	}
+	return codec.Unmarshal(e.Data, v)
+}
+
+// SetData encodes v with the codec registered for contentType and sets it as
+// the event data.
+func (e *Event) SetData(v any, contentType string) error {
+	codec, ok := kafkalight.DefaultCodecs.Lookup(contentType)
+	if !ok {
+		return fmt.Errorf("%w: %s", kafkalight.ErrUnknownContentType, contentType)
+	}
+
+	data, err := codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	e.Data = data
+	e.DataContentType = codec.ContentType()
+	return nil
+}
+
+func (e *Event) codec() (kafkalight.Codec, error) {
+	if e.DataContentType == "" {
+		return kafkalight.JSONCodec{}, nil
+	}
+	if isJSON(e.DataContentType) {
+		if codec, ok := kafkalight.DefaultCodecs.Lookup(e.DataContentType); ok {
+			return codec, nil
+		}
+		return kafkalight.JSONCodec{}, nil
+	}
+
+	codec, ok := kafkalight.DefaultCodecs.Lookup(e.DataContentType)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", kafkalight.ErrUnknownContentType, e.DataContentType)
+	}
+	return codec, nil
+}
+
+// isJSON reports whether contentType is a JSON media type. Event data without
+// a content type is JSON.
+func isJSON(contentType string) bool {
+	return strings.TrimSpace(contentType) == "" || kafkalight.IsJSONContentType(contentType)
+}
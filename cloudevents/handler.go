@@ -0,0 +1,100 @@
+package cloudevents
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/overtonx/kafkalight"
+)
+
+// ErrUnhandledType is returned by TypeRouter for event types without a
+// handler when no fallback is set. It is permanent.
+var ErrUnhandledType = errors.New("no handler for cloudevent type")
+
+// EventHandler handles a CloudEvent read from msg.
+type EventHandler func(ctx context.Context, msg *kafkalight.Message, evt *Event) error
+
+// TypedEventHandler handles a CloudEvent whose data has been decoded into T.
+type TypedEventHandler[T any] func(ctx context.Context, evt *Event, data T) error
+
+// Handler adapts h to a MessageHandler. Messages that are not valid
+// CloudEvents are rejected with a permanent error without calling h.
+func Handler(h EventHandler) kafkalight.MessageHandler {
+	return func(ctx context.Context, msg *kafkalight.Message) error {
+		evt, err := FromMessage(msg)
+		if err != nil {
+			return kafkalight.Permanent(fmt.Errorf("%s[%d]@%d: %w",
+				msg.TopicPartition.Topic, msg.TopicPartition.Partition, msg.TopicPartition.Offset, err))
+		}
+		return h(ctx, msg, evt)
+	}
+}
+
+// Typed adapts fn to an EventHandler that decodes the event data into T with
+// the codec for its data content type, JSON by default. Decode failures are
+// returned as *kafkalight.DecodeError without calling fn.
+func Typed[T any](fn TypedEventHandler[T]) EventHandler {
+	dataType := reflect.TypeFor[T]()
+
+	return func(ctx context.Context, msg *kafkalight.Message, evt *Event) error {
+		var data T
+		target := any(&data)
+		if dataType.Kind() == reflect.Pointer {
+			data = reflect.New(dataType.Elem()).Interface().(T)
+			target = data
+		}
+		if err := evt.DataAs(target); err != nil {
+			return &kafkalight.DecodeError{TopicPartition: msg.TopicPartition, Type: dataType, Err: err}
+		}
+		return fn(ctx, evt, data)
+	}
+}
+
+// TypeRouter dispatches events to handlers registered by CloudEvents type.
+// Its HandleEvent method is an EventHandler:
+//
+//	types := cloudevents.NewTypeRouter()
+//	types.Handle("com.example.order.created", cloudevents.Typed(onOrderCreated))
+//	router.RegisterRoute("orders", cloudevents.Handler(types.HandleEvent))
+type TypeRouter struct {
+	mu       sync.RWMutex
+	handlers map[string]EventHandler
+	fallback EventHandler
+}
+
+// NewTypeRouter creates an empty TypeRouter.
+func NewTypeRouter() *TypeRouter {
+	return &TypeRouter{handlers: make(map[string]EventHandler)}
+}
+
+// Handle registers h for events of eventType, replacing any previous handler.
+func (r *TypeRouter) Handle(eventType string, h EventHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[eventType] = h
+}
+
+// Fallback sets the handler for event types without a registered handler.
+func (r *TypeRouter) Fallback(h EventHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fallback = h
+}
+
+// HandleEvent dispatches evt to the handler registered for its type.
+func (r *TypeRouter) HandleEvent(ctx context.Context, msg *kafkalight.Message, evt *Event) error {
+	r.mu.RLock()
+	h, ok := r.handlers[evt.Type]
+	if !ok {
+		h = r.fallback
+	}
+	r.mu.RUnlock()
+
+	if h == nil {
+		return kafkalight.Permanent(fmt.Errorf("%w: %s", ErrUnhandledType, evt.Type))
+	}
+	return h(ctx, msg, evt)
+}
@@ -0,0 +1,107 @@
+package cloudevents
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/overtonx/kafkalight"
+)
+
+type orderCreated struct {
+	ID int `json:"id"`
+}
+
+func TestHandler(t *testing.T) {
+	var got *Event
+	handler := Handler(func(ctx context.Context, msg *kafkalight.Message, evt *Event) error {
+		got = evt
+		return nil
+	})
+
+	msg, err := ToMessage("orders", newEvent(), ModeBinary)
+	require.NoError(t, err)
+
+	require.NoError(t, handler(context.Background(), msg))
+	assert.Equal(t, "evt-1", got.ID)
+	assert.Equal(t, "/orders", got.Source)
+	assert.Equal(t, "com.example.order.created", got.Type)
+	assert.Equal(t, "order/42", got.Subject)
+	assert.False(t, got.Time.IsZero())
+
+	err = handler(context.Background(), &kafkalight.Message{Value: []byte("plain")})
+	assert.ErrorIs(t, err, ErrInvalidEvent)
+	assert.True(t, kafkalight.IsPermanent(err))
+}
+
+func TestTyped(t *testing.T) {
+	var got orderCreated
+	handler := Handler(Typed(func(ctx context.Context, evt *Event, data orderCreated) error {
+		got = data
+		return nil
+	}))
+
+	msg, err := ToMessage("orders", newEvent(), ModeStructured)
+	require.NoError(t, err)
+	require.NoError(t, handler(context.Background(), msg))
+	assert.Equal(t, orderCreated{ID: 42}, got)
+
+	var gotPtr *orderCreated
+	ptrHandler := Handler(Typed(func(ctx context.Context, evt *Event, data *orderCreated) error {
+		gotPtr = data
+		return nil
+	}))
+	require.NoError(t, ptrHandler(context.Background(), msg))
+	assert.Equal(t, &orderCreated{ID: 42}, gotPtr)
+
+	evt := newEvent()
+	evt.Data = []byte(`{"id":"x"}`)
+	msg, err = ToMessage("orders", evt, ModeBinary)
+	require.NoError(t, err)
+
+	err = handler(context.Background(), msg)
+	var decodeErr *kafkalight.DecodeError
+	require.ErrorAs(t, err, &decodeErr)
+	assert.True(t, kafkalight.IsPermanent(err))
+}
+
+func TestTypeRouter(t *testing.T) {
+	var called []string
+	record := func(name string) EventHandler {
+		return func(ctx context.Context, msg *kafkalight.Message, evt *Event) error {
+			called = append(called, name+":"+evt.ID)
+			return nil
+		}
+	}
+
+	types := NewTypeRouter()
+	types.Handle("com.example.order.created", record("created"))
+	types.Handle("com.example.order.cancelled", func(ctx context.Context, msg *kafkalight.Message, evt *Event) error {
+		return errors.New("downstream unavailable")
+	})
+	handler := Handler(types.HandleEvent)
+
+	dispatch := func(eventType string) error {
+		msg, err := ToMessage("orders", New("evt-"+eventType, "/orders", eventType), ModeBinary)
+		require.NoError(t, err)
+		return handler(context.Background(), msg)
+	}
+
+	require.NoError(t, dispatch("com.example.order.created"))
+	assert.Equal(t, []string{"created:evt-com.example.order.created"}, called)
+
+	err := dispatch("com.example.order.cancelled")
+	assert.EqualError(t, err, "downstream unavailable")
+	assert.False(t, kafkalight.IsPermanent(err))
+
+	err = dispatch("com.example.order.shipped")
+	assert.ErrorIs(t, err, ErrUnhandledType)
+	assert.True(t, kafkalight.IsPermanent(err))
+
+	types.Fallback(record("fallback"))
+	require.NoError(t, dispatch("com.example.order.shipped"))
+	assert.Equal(t, "fallback:evt-com.example.order.shipped", called[len(called)-1])
+}
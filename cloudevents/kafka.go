@@ -0,0 +1,232 @@
+package cloudevents
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/overtonx/kafkalight"
+)
+
+const (
+	// ContentTypeStructured is the content type of structured mode messages.
+	ContentTypeStructured = "application/cloudevents+json"
+
+	headerPrefix = "ce_"
+
+	// partitionKeyExtension maps to the Kafka message key.
+	partitionKeyExtension = "partitionkey"
+)
+
+// Mode is the Kafka protocol binding content mode.
+type Mode int
+
+const (
+	// ModeBinary carries attributes in ce_* headers and the data as the message value.
+	ModeBinary Mode = iota
+	// ModeStructured carries the whole event as a JSON document in the message value.
+	ModeStructured
+)
+
+// FromMessage reads a CloudEvent from msg. Structured mode is detected by the
+// application/cloudevents+json content type, binary mode otherwise.
+func FromMessage(msg *kafkalight.Message) (*Event, error) {
+	var (
+		evt *Event
+		err error
+	)
+	if contentType, ok := msg.Header(kafkalight.HeaderContentType); ok && isStructured(string(contentType)) {
+		evt, err = decodeStructured(msg.Value)
+	} else {
+		evt, err = decodeBinary(msg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := evt.Validate(); err != nil {
+		return nil, err
+	}
+	return evt, nil
+}
+
+// ToMessage builds a message for topic carrying evt in the given mode.
+// The partitionkey extension, if set, becomes the message key.
+func ToMessage(topic string, evt *Event, mode Mode) (*kafkalight.Message, error) {
+	if err := evt.Validate(); err != nil {
+		return nil, err
+	}
+
+	msg := &kafkalight.Message{
+		TopicPartition: kafkalight.TopicPartition{Topic: topic, Partition: kafkalight.PartitionAny},
+	}
+	if partitionKey, ok := evt.Extensions[partitionKeyExtension]; ok {
+		key, _ := kafkalight.NewKey(partitionKey)
+		msg.Key = *key
+	}
+
+	switch mode {
+	case ModeStructured:
+		value, err := encodeStructured(evt)
+		if err != nil {
+			return nil, err
+		}
+		msg.Value = value
+		msg.SetHeader(kafkalight.HeaderContentType, []byte(ContentTypeStructured))
+	default:
+		encodeBinary(msg, evt)
+	}
+	return msg, nil
+}
+
+func isStructured(contentType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0]))
+	return mediaType == ContentTypeStructured
+}
+
+func decodeBinary(msg *kafkalight.Message) (*Event, error) {
+	evt := &Event{Data: msg.Value}
+	for _, h := range msg.Headers {
+		if h.Key == kafkalight.HeaderContentType {
+			evt.DataContentType = string(h.Value)
+			continue
+		}
+		if !strings.HasPrefix(h.Key, headerPrefix) {
+			continue
+		}
+		if err := evt.setAttribute(strings.TrimPrefix(h.Key, headerPrefix), string(h.Value)); err != nil {
+			return nil, err
+		}
+	}
+	return evt, nil
+}
+
+func encodeBinary(msg *kafkalight.Message, evt *Event) {
+	set := func(name, value string) {
+		if value != "" {
+			msg.SetHeader(headerPrefix+name, []byte(value))
+		}
+	}
+	set("specversion", evt.SpecVersion)
+	set("id", evt.ID)
+	set("source", evt.Source)
+	set("type", evt.Type)
+	set("subject", evt.Subject)
+	set("dataschema", evt.DataSchema)
+	if !evt.Time.IsZero() {
+		set("time", evt.Time.Format(time.RFC3339Nano))
+	}
+	for name, value := range evt.Extensions {
+		set(name, value)
+	}
+	if evt.DataContentType != "" {
+		msg.SetHeader(kafkalight.HeaderContentType, []byte(evt.DataContentType))
+	}
+	msg.Value = evt.Data
+}
+
+func decodeStructured(value []byte) (*Event, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(value, &doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEvent, err)
+	}
+
+	evt := &Event{}
+	for name, raw := range doc {
+		switch name {
+		case "data":
+			evt.Data = raw
+		case "data_base64":
+			var encoded string
+			if err := json.Unmarshal(raw, &encoded); err != nil {
+				return nil, fmt.Errorf("%w: data_base64: %v", ErrInvalidEvent, err)
+			}
+			data, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				return nil, fmt.Errorf("%w: data_base64: %v", ErrInvalidEvent, err)
+			}
+			evt.Data = data
+		default:
+			var s string
+			if err := json.Unmarshal(raw, &s); err != nil {
+				// Non-string extension values are kept as their JSON text.
+				s = string(raw)
+			}
+			if err := evt.setAttribute(name, s); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Non-JSON data in the "data" member is a JSON string holding the payload.
+	if _, ok := doc["data"]; ok && !isJSON(evt.DataContentType) {
+		var s string
+		if err := json.Unmarshal(evt.Data, &s); err == nil {
+			evt.Data = []byte(s)
+		}
+	}
+	return evt, nil
+}
+
+func encodeStructured(evt *Event) ([]byte, error) {
+	doc := map[string]any{
+		"specversion": evt.SpecVersion,
+		"id":          evt.ID,
+		"source":      evt.Source,
+		"type":        evt.Type,
+	}
+	optional := map[string]string{
+		"subject":         evt.Subject,
+		"datacontenttype": evt.DataContentType,
+		"dataschema":      evt.DataSchema,
+	}
+	if !evt.Time.IsZero() {
+		optional["time"] = evt.Time.Format(time.RFC3339Nano)
+	}
+	for name, value := range optional {
+		if value != "" {
+			doc[name] = value
+		}
+	}
+	for name, value := range evt.Extensions {
+		doc[name] = value
+	}
+
+	if evt.Data != nil {
+		if isJSON(evt.DataContentType) && json.Valid(evt.Data) {
+			doc["data"] = json.RawMessage(evt.Data)
+		} else {
+			doc["data_base64"] = base64.StdEncoding.EncodeToString(evt.Data)
+		}
+	}
+	return json.Marshal(doc)
+}
+
+func (e *Event) setAttribute(name, value string) error {
+	switch name {
+	case "id":
+		e.ID = value
+	case "source":
+		e.Source = value
+	case "specversion":
+		e.SpecVersion = value
+	case "type":
+		e.Type = value
+	case "subject":
+		e.Subject = value
+	case "datacontenttype":
+		e.DataContentType = value
+	case "dataschema":
+		e.DataSchema = value
+	case "time":
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return fmt.Errorf("%w: time: %v", ErrInvalidEvent, err)
+		}
+		e.Time = t
+	default:
+		e.SetExtension(name, value)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package cloudevents
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/overtonx/kafkalight"
+)
+
+func newEvent() *Event {
+	evt := New("evt-1", "/orders", "com.example.order.created")
+	evt.Subject = "order/42"
+	evt.Time = time.Date(2026, 3, 1, 12, 30, 0, 0, time.UTC)
+	evt.DataContentType = kafkalight.ContentTypeJSON
+	evt.Data = []byte(`{"id":42}`)
+	evt.SetExtension("tenant", "acme")
+	return evt
+}
+
+func TestBinaryMode(t *testing.T) {
+	evt := newEvent()
+	evt.SetExtension("partitionkey", "order-42")
+
+	msg, err := ToMessage("orders", evt, ModeBinary)
+	require.NoError(t, err)
+
+	assert.Equal(t, []byte(`{"id":42}`), msg.Value)
+	assert.Equal(t, []byte("order-42"), msg.Key.Bytes())
+	for key, want := range map[string]string{
+		"ce_specversion": "1.0",
+		"ce_id":          "evt-1",
+		"ce_source":      "/orders",
+		"ce_type":        "com.example.order.created",
+		"ce_subject":     "order/42",
+		"ce_time":        "2026-03-01T12:30:00Z",
+		"ce_tenant":      "acme",
+		"content-type":   kafkalight.ContentTypeJSON,
+	} {
+		value, ok := msg.Header(key)
+		require.True(t, ok, key)
+		assert.Equal(t, want, string(value), key)
+	}
+
+	got, err := FromMessage(msg)
+	require.NoError(t, err)
+	assert.Equal(t, evt, got)
+}
+
+func TestStructuredMode(t *testing.T) {
+	evt := newEvent()
+
+	msg, err := ToMessage("orders", evt, ModeStructured)
+	require.NoError(t, err)
+
+	contentType, _ := msg.Header(kafkalight.HeaderContentType)
+	assert.Equal(t, ContentTypeStructured, string(contentType))
+	assert.Nil(t, msg.Key.Bytes())
+
+	var doc map[string]any
+	require.NoError(t, json.Unmarshal(msg.Value, &doc))
+	assert.Equal(t, "evt-1", doc["id"])
+	assert.Equal(t, "acme", doc["tenant"])
+	assert.Equal(t, map[string]any{"id": float64(42)}, doc["data"])
+
+	got, err := FromMessage(msg)
+	require.NoError(t, err)
+	assert.Equal(t, evt, got)
+}
+
+func TestStructuredModeBinaryData(t *testing.T) {
+	evt := newEvent()
+	evt.DataContentType = kafkalight.ContentTypeRaw
+	evt.Data = []byte{0x00, 0xff}
+
+	msg, err := ToMessage("orders", evt, ModeStructured)
+	require.NoError(t, err)
+	assert.Contains(t, string(msg.Value), `"data_base64":"AP8="`)
+
+	got, err := FromMessage(msg)
+	require.NoError(t, err)
+	assert.Equal(t, evt.Data, got.Data)
+}
+
+func TestStructuredModeStringData(t *testing.T) {
+	msg := &kafkalight.Message{
+		Value: []byte(`{"specversion":"1.0","id":"1","source":"s","type":"t","datacontenttype":"text/plain","data":"hello","count":3}`),
+		Headers: []kafkalight.Header{
+			{Key: kafkalight.HeaderContentType, Value: []byte("application/cloudevents+json; charset=utf-8")},
+		},
+	}
+
+	evt, err := FromMessage(msg)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("hello"), evt.Data)
+	assert.Equal(t, "3", evt.Extensions["count"])
+}
+
+func TestFromMessageInvalid(t *testing.T) {
+	t.Run("missing attributes", func(t *testing.T) {
+		msg := &kafkalight.Message{Headers: []kafkalight.Header{{Key: "ce_id", Value: []byte("1")}}}
+
+		_, err := FromMessage(msg)
+		assert.ErrorIs(t, err, ErrInvalidEvent)
+		assert.ErrorContains(t, err, "source, specversion, type")
+	})
+
+	t.Run("bad time", func(t *testing.T) {
+		msg := &kafkalight.Message{Headers: []kafkalight.Header{{Key: "ce_time", Value: []byte("yesterday")}}}
+
+		_, err := FromMessage(msg)
+		assert.ErrorIs(t, err, ErrInvalidEvent)
+	})
+
+	t.Run("malformed structured event", func(t *testing.T) {
+		msg := &kafkalight.Message{
+			Value:   []byte(`not json`),
+			Headers: []kafkalight.Header{{Key: kafkalight.HeaderContentType, Value: []byte(ContentTypeStructured)}},
+		}
+
+		_, err := FromMessage(msg)
+		assert.ErrorIs(t, err, ErrInvalidEvent)
+	})
+}
@@ -0,0 +1,207 @@
+package kafkalight
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// HeaderContentType is the message header that carries the payload content type.
+const HeaderContentType = "content-type"
+
+// Content types of the built-in codecs.
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeMsgPack  = "application/x-msgpack"
+	ContentTypeRaw      = "application/octet-stream"
+)
+
+// ErrUnknownContentType is returned when no codec is registered for a content type.
+var ErrUnknownContentType = errors.New("unknown content type")
+
+// Codec encodes and decodes message payloads of a single content type.
+type Codec interface {
+	// ContentType returns the media type the codec handles, e.g. "application/json".
+	ContentType() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// ContextCodec is a Codec whose encoding and decoding may block on I/O, such
+// as fetching a schema from a registry. Typed, Message.BindContext and
+// Message.EncodeContext call its context variants, so the deadline and
+// cancellation of the handler or producer apply.
+type ContextCodec interface {
+	Codec
+	MarshalContext(ctx context.Context, v any) ([]byte, error)
+	UnmarshalContext(ctx context.Context, data []byte, v any) error
+}
+
+// marshalContext encodes v with codec, passing ctx if codec is a ContextCodec.
+func marshalContext(ctx context.Context, codec Codec, v any) ([]byte, error) {
+	if c, ok := codec.(ContextCodec); ok {
+		return c.MarshalContext(ctx, v)
+	}
+	return codec.Marshal(v)
+}
+
+// unmarshalContext decodes data with codec, passing ctx if codec is a
+// ContextCodec.
+func unmarshalContext(ctx context.Context, codec Codec, data []byte, v any) error {
+	if c, ok := codec.(ContextCodec); ok {
+		return c.UnmarshalContext(ctx, data, v)
+	}
+	return codec.Unmarshal(data, v)
+}
+
+// CodecRegistry maps content types to codecs.
+type CodecRegistry struct {
+	mu     sync.RWMutex
+	codecs map[string]Codec
+}
+
+// DefaultCodecs is the registry used by Message.Bind and Message.Encode.
+// It contains the JSON, Protobuf, MessagePack and raw bytes codecs.
+var DefaultCodecs = NewCodecRegistry(JSONCodec{}, ProtobufCodec{}, MsgPackCodec{}, RawCodec{})
+
+// NewCodecRegistry creates a registry holding the given codecs.
+func NewCodecRegistry(codecs ...Codec) *CodecRegistry {
+	r := &CodecRegistry{codecs: make(map[string]Codec)}
+	for _, c := range codecs {
+		r.Register(c)
+	}
+	return r
+}
+
+// Register adds c to the registry, replacing any codec registered for the same content type.
+func (r *CodecRegistry) Register(c Codec) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.codecs[normalizeContentType(c.ContentType())] = c
+}
+
+// Lookup returns the codec for contentType. Media type parameters such as
+// "; charset=utf-8" are ignored.
+func (r *CodecRegistry) Lookup(contentType string) (Codec, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c, ok := r.codecs[normalizeContentType(contentType)]
+	return c, ok
+}
+
+func normalizeContentType(contentType string) string {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mediaType
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+// IsJSONContentType reports whether contentType is a JSON media type, either
+// */json or a structured syntax suffix +json such as
+// application/cloudevents+json. Media type parameters are ignored.
+func IsJSONContentType(contentType string) bool {
+	mediaType := normalizeContentType(contentType)
+	return strings.HasSuffix(mediaType, "/json") || strings.HasSuffix(mediaType, "+json")
+}
+
+var (
+	_ Codec = JSONCodec{}
+	_ Codec = ProtobufCodec{}
+	_ Codec = MsgPackCodec{}
+	_ Codec = RawCodec{}
+)
+
+// JSONCodec encodes JSON payloads with encoding/json.
+type JSONCodec struct{}
+
+func (JSONCodec) ContentType() string {
+	return ContentTypeJSON
+}
+
+func (JSONCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// ProtobufCodec encodes values implementing proto.Message.
+type ProtobufCodec struct{}
+
+func (ProtobufCodec) ContentType() string {
+	return ContentTypeProtobuf
+}
+
+func (ProtobufCodec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("protobuf codec: %T does not implement proto.Message", v)
+	}
+	return proto.Marshal(m)
+}
+
+func (ProtobufCodec) Unmarshal(data []byte, v any) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("protobuf codec: %T does not implement proto.Message", v)
+	}
+	return proto.Unmarshal(data, m)
+}
+
+// MsgPackCodec encodes MessagePack payloads.
+type MsgPackCodec struct{}
+
+func (MsgPackCodec) ContentType() string {
+	return ContentTypeMsgPack
+}
+
+func (MsgPackCodec) Marshal(v any) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (MsgPackCodec) Unmarshal(data []byte, v any) error {
+	return msgpack.Unmarshal(data, v)
+}
+
+// RawCodec passes payloads through unchanged. It marshals []byte and string
+// values and unmarshals into *[]byte and *string.
+type RawCodec struct{}
+
+func (RawCodec) ContentType() string {
+	return ContentTypeRaw
+}
+
+func (RawCodec) Marshal(v any) ([]byte, error) {
+	switch val := v.(type) {
+	case []byte:
+		return val, nil
+	case string:
+		return []byte(val), nil
+	default:
+		return nil, fmt.Errorf("raw codec: cannot marshal %T", v)
+	}
+}
+
+func (RawCodec) Unmarshal(data []byte, v any) error {
+	switch val := v.(type) {
+	case *[]byte:
+		*val = append((*val)[:0], data...)
+		return nil
+	case *string:
+		*val = string(data)
+		return nil
+	default:
+		return fmt.Errorf("raw codec: cannot unmarshal into %T", v)
+	}
+}
@@ -0,0 +1,94 @@
+package kafkalight
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestCodecRegistry(t *testing.T) {
+	registry := NewCodecRegistry(JSONCodec{})
+
+	t.Run("lookup ignores parameters and case", func(t *testing.T) {
+		codec, ok := registry.Lookup("Application/JSON; charset=utf-8")
+		require.True(t, ok)
+		assert.Equal(t, ContentTypeJSON, codec.ContentType())
+	})
+
+	t.Run("unknown content type", func(t *testing.T) {
+		_, ok := registry.Lookup(ContentTypeMsgPack)
+		assert.False(t, ok)
+	})
+
+	t.Run("register", func(t *testing.T) {
+		registry.Register(MsgPackCodec{})
+		_, ok := registry.Lookup(ContentTypeMsgPack)
+		assert.True(t, ok)
+	})
+
+	t.Run("default codecs", func(t *testing.T) {
+		for _, ct := range []string{ContentTypeJSON, ContentTypeProtobuf, ContentTypeMsgPack, ContentTypeRaw} {
+			_, ok := DefaultCodecs.Lookup(ct)
+			assert.True(t, ok, ct)
+		}
+	})
+}
+
+func TestCodecs_RoundTrip(t *testing.T) {
+	type payload struct {
+		Foo string `json:"foo" msgpack:"foo"`
+	}
+
+	t.Run("json", func(t *testing.T) {
+		data, err := JSONCodec{}.Marshal(payload{Foo: "bar"})
+		require.NoError(t, err)
+
+		var got payload
+		require.NoError(t, JSONCodec{}.Unmarshal(data, &got))
+		assert.Equal(t, "bar", got.Foo)
+	})
+
+	t.Run("msgpack", func(t *testing.T) {
+		data, err := MsgPackCodec{}.Marshal(payload{Foo: "bar"})
+		require.NoError(t, err)
+
+		var got payload
+		require.NoError(t, MsgPackCodec{}.Unmarshal(data, &got))
+		assert.Equal(t, "bar", got.Foo)
+	})
+
+	t.Run("protobuf", func(t *testing.T) {
+		data, err := ProtobufCodec{}.Marshal(wrapperspb.String("bar"))
+		require.NoError(t, err)
+
+		got := &wrapperspb.StringValue{}
+		require.NoError(t, ProtobufCodec{}.Unmarshal(data, got))
+		assert.True(t, proto.Equal(wrapperspb.String("bar"), got))
+	})
+
+	t.Run("protobuf rejects non proto values", func(t *testing.T) {
+		_, err := ProtobufCodec{}.Marshal(payload{})
+		assert.Error(t, err)
+		assert.Error(t, ProtobufCodec{}.Unmarshal(nil, &payload{}))
+	})
+
+	t.Run("raw", func(t *testing.T) {
+		data, err := RawCodec{}.Marshal("bar")
+		require.NoError(t, err)
+
+		var b []byte
+		require.NoError(t, RawCodec{}.Unmarshal(data, &b))
+		assert.Equal(t, []byte("bar"), b)
+
+		var s string
+		require.NoError(t, RawCodec{}.Unmarshal(data, &s))
+		assert.Equal(t, "bar", s)
+
+		_, err = RawCodec{}.Marshal(42)
+		assert.Error(t, err)
+		assert.Error(t, RawCodec{}.Unmarshal(data, &payload{}))
+	})
+}
@@ -0,0 +1,141 @@
+package kafkalight
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+type commitScopeKey struct{}
+
+// commitScope identifies the message being handled for DeferCommit.
+type commitScope struct {
+	tracker   *offsetTracker
+	topic     string
+	partition int32
+	offset    int64
+	// stopped is set by TimeoutHandler once it gave up on the handler.
+	stopped atomic.Bool
+}
+
+// DeferCommit keeps the router from committing the offset of the message
+// being handled, and any later offset of its partition, until release is
+// called. Middleware that buffers messages across handler calls, such as
+// chunk reassembly, uses it so that buffered messages are read again after a
+// restart. Offsets of later messages that were processed in the meantime are
+// committed together once all holds of the partition are released.
+//
+// ok is false, and release a no-op, when commits are not managed by the
+// router: with enable.auto.commit or outside StartListening, e.g. in Dispatch,
+// and in handlers that TimeoutHandler gave up on.
+// release may be called more than once and from any goroutine.
+func DeferCommit(ctx context.Context) (release func(), ok bool) {
+	scope, ok := ctx.Value(commitScopeKey{}).(*commitScope)
+	if !ok || scope.stopped.Load() {
+		return func() {}, false
+	}
+	return scope.tracker.hold(scope.topic, scope.partition, scope.offset), true
+}
+
+func withCommitScope(ctx context.Context, tracker *offsetTracker, msg *kafka.Message) context.Context {
+	return context.WithValue(ctx, commitScopeKey{}, &commitScope{
+		tracker:   tracker,
+		topic:     *msg.TopicPartition.Topic,
+		partition: msg.TopicPartition.Partition,
+		offset:    int64(msg.TopicPartition.Offset),
+	})
+}
+
+// stopCommitScope makes DeferCommit a no-op in ctx and the contexts derived
+// from it.
+func stopCommitScope(ctx context.Context) {
+	if scope, ok := ctx.Value(commitScopeKey{}).(*commitScope); ok {
+		scope.stopped.Store(true)
+	}
+}
+
+type partitionKey struct {
+	topic     string
+	partition int32
+}
+
+// offsetTracker keeps the offsets held by DeferCommit per partition.
+type offsetTracker struct {
+	mu   sync.Mutex
+	held map[partitionKey]map[int64]int
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{held: make(map[partitionKey]map[int64]int)}
+}
+
+func (t *offsetTracker) hold(topic string, partition int32, offset int64) func() {
+	key := partitionKey{topic: topic, partition: partition}
+
+	t.mu.Lock()
+	if t.held[key] == nil {
+		t.held[key] = make(map[int64]int)
+	}
+	t.held[key][offset]++
+	t.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+
+			offsets := t.held[key]
+			if offsets[offset]--; offsets[offset] <= 0 {
+				delete(offsets, offset)
+			}
+			if len(offsets) == 0 {
+				delete(t.held, key)
+			}
+		})
+	}
+}
+
+// lowest returns the lowest held offset of the partition, if any.
+func (t *offsetTracker) lowest(topic string, partition int32) (int64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	offsets, ok := t.held[partitionKey{topic: topic, partition: partition}]
+	if !ok {
+		return 0, false
+	}
+
+	first := true
+	var lowest int64
+	for offset := range offsets {
+		if first || offset < lowest {
+			lowest, first = offset, false
+		}
+	}
+	return lowest, true
+}
+
+// commit commits the offset following msg, or the lowest offset held by
+// DeferCommit in its partition.
+func (r *KafkaRouter) commit(msg *kafka.Message) error {
+	var (
+		committed []kafka.TopicPartition
+		err       error
+	)
+	if offset, held := r.offsets.lowest(*msg.TopicPartition.Topic, msg.TopicPartition.Partition); held {
+		tp := msg.TopicPartition
+		tp.Offset = kafka.Offset(offset)
+		committed, err = r.consumer.CommitOffsets([]kafka.TopicPartition{tp})
+	} else {
+		committed, err = r.consumer.CommitMessage(msg)
+	}
+
+	if err == nil {
+		r.health.committed()
+	}
+	r.onCommit(committed, err)
+	return err
+}
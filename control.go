@@ -0,0 +1,198 @@
+package kafkalight
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// controlQueryTimeout bounds the broker queries made by SeekToTime.
+const controlQueryTimeout = 5 * time.Second
+
+// Offsets queries the consumer for the committed offset, position and high
+// watermark of each assigned partition, ordered by topic and partition.
+// Unlike Lag it does not require the lag monitor.
+func (r *KafkaRouter) Offsets() ([]PartitionLag, error) {
+	return r.measureLag(nil)
+}
+
+// Pause stops fetching messages from the assigned partitions of topic. The
+// topic stays paused across rebalances until Resume is called. Pausing a
+// router that is not started takes effect once its partitions are assigned.
+func (r *KafkaRouter) Pause(topic string) error {
+	return r.setPaused(topic, true)
+}
+
+// Resume resumes fetching messages from the partitions of a paused topic.
+func (r *KafkaRouter) Resume(topic string) error {
+	return r.setPaused(topic, false)
+}
+
+// Paused returns the paused topics in registration order.
+func (r *KafkaRouter) Paused() []string {
+	r.mu.RLock()
+	topics := r.topics
+	r.mu.RUnlock()
+
+	r.pausedMu.Lock()
+	defer r.pausedMu.Unlock()
+
+	var paused []string
+	for _, topic := range topics {
+		if r.paused[topic] {
+			paused = append(paused, topic)
+		}
+	}
+	return paused
+}
+
+func (r *KafkaRouter) setPaused(topic string, paused bool) error {
+	r.mu.RLock()
+	_, exists := r.routes[topic]
+	started := r.started
+	r.mu.RUnlock()
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrRouteNotFound, topic)
+	}
+
+	// The rebalance callback may run while r.mu is held by StartListening,
+	// so the paused topics have their own lock.
+	r.pausedMu.Lock()
+	defer r.pausedMu.Unlock()
+	if paused {
+		r.paused[topic] = true
+	} else {
+		delete(r.paused, topic)
+	}
+	if !started {
+		return nil
+	}
+
+	partitions, err := r.assignedPartitions(topic)
+	if err != nil || len(partitions) == 0 {
+		return err
+	}
+	if paused {
+		err = r.consumer.Pause(partitions)
+	} else {
+		err = r.consumer.Resume(partitions)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to pause %s: %w", topic, err)
+	}
+	return nil
+}
+
+// SeekToTime moves the assigned partitions of topic to the earliest offset
+// whose timestamp is at or after t, or to the end of partitions without such
+// a message. It returns the offsets sought. Messages before the new
+// positions that were not yet processed are skipped, and messages after them
+// are processed again.
+func (r *KafkaRouter) SeekToTime(topic string, t time.Time) ([]TopicPartition, error) {
+	r.mu.RLock()
+	_, exists := r.routes[topic]
+	r.mu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrRouteNotFound, topic)
+	}
+
+	partitions, err := r.assignedPartitions(topic)
+	if err != nil {
+		return nil, err
+	}
+	if len(partitions) == 0 {
+		return []TopicPartition{}, nil
+	}
+
+	for i := range partitions {
+		partitions[i].Offset = kafka.Offset(t.UnixMilli())
+	}
+	offsets, err := r.consumer.OffsetsForTimes(partitions, int(controlQueryTimeout.Milliseconds()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up offsets of %s: %w", topic, err)
+	}
+	for i, tp := range offsets {
+		if tp.Error != nil {
+			return nil, fmt.Errorf("failed to look up offset of %s[%d]: %w", topic, tp.Partition, tp.Error)
+		}
+		if tp.Offset < 0 {
+			offsets[i].Offset = kafka.OffsetEnd
+		}
+	}
+
+	sought, err := r.consumer.SeekPartitions(offsets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to seek %s: %w", topic, err)
+	}
+	for _, tp := range sought {
+		if tp.Error != nil {
+			return nil, fmt.Errorf("failed to seek %s[%d]: %w", topic, tp.Partition, tp.Error)
+		}
+	}
+	return convertTopicPartitions(offsets), nil
+}
+
+// assignedPartitions returns the partitions of topic assigned to the consumer.
+func (r *KafkaRouter) assignedPartitions(topic string) ([]kafka.TopicPartition, error) {
+	assignment, err := r.consumer.Assignment()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get assignment: %w", err)
+	}
+	return slices.DeleteFunc(assignment, func(tp kafka.TopicPartition) bool {
+		return tp.Topic == nil || *tp.Topic != topic
+	}), nil
+}
+
+// pauseAssigned pauses the newly assigned partitions of paused topics. c is
+// nil for consumers other than *kafka.Consumer, which apply the assignment
+// before calling the rebalance callback.
+func (r *KafkaRouter) pauseAssigned(c *kafka.Consumer, assigned []kafka.TopicPartition) error {
+	r.pausedMu.Lock()
+	var paused []kafka.TopicPartition
+	for _, tp := range assigned {
+		if tp.Topic != nil && r.paused[*tp.Topic] {
+			paused = append(paused, tp)
+		}
+	}
+	r.pausedMu.Unlock()
+	if len(paused) == 0 {
+		return nil
+	}
+
+	// librdkafka only applies the assignment after the callback returns, so
+	// it is applied here to be able to pause it.
+	if c != nil {
+		var err error
+		if c.GetRebalanceProtocol() == "COOPERATIVE" {
+			err = c.IncrementalAssign(assigned)
+		} else {
+			err = c.Assign(assigned)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return r.consumer.Pause(paused)
+}
+
+var closureSuffix = regexp.MustCompile(`(\.func\d+)+$`)
+
+// middlewareName returns the name of the function that created mw, such as
+// "middleware.Logger".
+func middlewareName(mw Middleware) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(mw).Pointer())
+	if fn == nil {
+		return "unknown"
+	}
+	name := fn.Name()
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	return closureSuffix.ReplaceAllString(name, "")
+}
@@ -0,0 +1,100 @@
+package kafkalight
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// PermanentError marks a failure that will not go away when the message is
+// delivered again, such as a malformed payload.
+//
+// With WithCommitOnPermanentError, in manual commit mode the router commits
+// the offset of a message whose handler returned a permanent error, so the
+// message is not redelivered after a restart.
+type PermanentError struct {
+	Err error
+}
+
+// Permanent marks err as permanent. It returns nil if err is nil.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent implements the permanent error class.
+func (e *PermanentError) Permanent() bool {
+	return true
+}
+
+// IsPermanent reports whether err belongs to the permanent error class.
+//
+// Errors classify themselves by implementing interface{ Permanent() bool }.
+// The outermost error in the chain that does so decides, which lets a
+// wrapper such as DecodeError defer to a more specific cause. Errors that do
+// not classify themselves are not permanent.
+func IsPermanent(err error) bool {
+	permanent, _ := permanence(err)
+	return permanent
+}
+
+// permanence returns the classification of the outermost classified error in
+// the chain of err and whether such an error was found.
+func permanence(err error) (permanent, classified bool) {
+	for err != nil {
+		if p, ok := err.(interface{ Permanent() bool }); ok {
+			return p.Permanent(), true
+		}
+		switch x := err.(type) {
+		case interface{ Unwrap() error }:
+			err = x.Unwrap()
+		case interface{ Unwrap() []error }:
+			for _, e := range x.Unwrap() {
+				p, ok := permanence(e)
+				if p {
+					return true, true
+				}
+				classified = classified || ok
+			}
+			return false, classified
+		default:
+			return false, false
+		}
+	}
+	return false, false
+}
+
+// DecodeError reports that a message payload could not be decoded.
+// It is a permanent error unless its cause classifies itself otherwise, e.g.
+// a schema registry that could not be reached.
+type DecodeError struct {
+	TopicPartition TopicPartition
+	Type           reflect.Type
+	Err            error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("failed to decode %v payload from %s[%d]@%d: %v",
+		e.Type, e.TopicPartition.Topic, e.TopicPartition.Partition, e.TopicPartition.Offset, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent implements the permanent error class.
+func (e *DecodeError) Permanent() bool {
+	if permanent, classified := permanence(e.Err); classified {
+		return permanent
+	}
+	return true
+}
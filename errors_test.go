@@ -0,0 +1,52 @@
+package kafkalight
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type transientError struct {
+	cause error
+}
+
+func (e transientError) Error() string   { return "transient" }
+func (e transientError) Unwrap() error   { return e.cause }
+func (e transientError) Permanent() bool { return false }
+
+func TestIsPermanent(t *testing.T) {
+	base := errors.New("boom")
+
+	testCases := []struct {
+		name   string
+		err    error
+		expect bool
+	}{
+		{name: "nil", err: nil, expect: false},
+		{name: "plain error", err: base, expect: false},
+		{name: "permanent", err: Permanent(base), expect: true},
+		{name: "wrapped permanent", err: fmt.Errorf("handler: %w", Permanent(base)), expect: true},
+		{name: "decode error", err: &DecodeError{Err: base}, expect: true},
+		{name: "joined", err: errors.Join(base, Permanent(base)), expect: true},
+		{name: "decode error with transient cause", err: &DecodeError{Err: transientError{}}, expect: false},
+		{name: "outermost classification wins", err: transientError{cause: Permanent(base)}, expect: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expect, IsPermanent(tc.err))
+		})
+	}
+
+	t.Run("permanent of nil is nil", func(t *testing.T) {
+		assert.NoError(t, Permanent(nil))
+	})
+
+	t.Run("permanent keeps the cause", func(t *testing.T) {
+		err := Permanent(base)
+		assert.ErrorIs(t, err, base)
+		assert.Equal(t, "boom", err.Error())
+	})
+}
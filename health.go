@@ -0,0 +1,308 @@
+package kafkalight
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// Health probe defaults.
+const (
+	DefaultMaxPollInterval    = time.Minute
+	DefaultMaxHandlerDuration = 5 * time.Minute
+	DefaultMaxPollErrors      = 5
+)
+
+// Health is a snapshot of the router state, as returned by KafkaRouter.Health.
+type Health struct {
+	// Started reports whether StartListening is running.
+	Started bool `json:"started"`
+	// Subscribed reports whether the consumer is subscribed to the route
+	// topics: from the successful subscription in StartListening until Close
+	// closes the consumer. It stays true across rebalances and after
+	// StartListening returned because its context was done, as the consumer
+	// keeps its group membership until it is closed.
+	Subscribed bool `json:"subscribed"`
+	// AssignedPartitions are the partitions currently assigned to the router.
+	AssignedPartitions []TopicPartition `json:"assigned_partitions"`
+	// LastPoll is the time of the last successful read from the consumer,
+	// including reads that timed out without a message.
+	LastPoll time.Time `json:"last_poll"`
+	// LastCommit is the time of the last successful offset commit made by the
+	// router. With enable.auto.commit, the default, librdkafka commits in the
+	// background and LastCommit stays zero.
+	LastCommit time.Time `json:"last_commit"`
+	// ConsecutivePollErrors counts the read errors since the last successful read.
+	ConsecutivePollErrors int `json:"consecutive_poll_errors"`
+	// LastPollError is the last read error, if any.
+	LastPollError string `json:"last_poll_error,omitempty"`
+	// LongestInFlight is how long the oldest running handler has been running.
+	LongestInFlight time.Duration `json:"longest_in_flight"`
+	// AbandonedHandlers counts the handlers TimeoutHandler gave up on that
+	// are still running.
+	AbandonedHandlers int `json:"abandoned_handlers"`
+	// LongestAbandoned is how long the oldest abandoned handler has been
+	// running, since it was started.
+	LongestAbandoned time.Duration `json:"longest_abandoned"`
+}
+
+type healthState struct {
+	mu                    sync.Mutex
+	listening             bool
+	subscribed            bool
+	assigned              map[partitionKey]struct{}
+	lastPoll              time.Time
+	lastCommit            time.Time
+	consecutivePollErrors int
+	lastPollError         error
+	handlerStarted        time.Time
+	abandonedStarted      []time.Time
+}
+
+// Health returns the current state of the router.
+func (r *KafkaRouter) Health() Health {
+	h := &r.health
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	health := Health{
+		Started:               h.listening,
+		Subscribed:            h.subscribed,
+		AssignedPartitions:    make([]TopicPartition, 0, len(h.assigned)),
+		LastPoll:              h.lastPoll,
+		LastCommit:            h.lastCommit,
+		ConsecutivePollErrors: h.consecutivePollErrors,
+	}
+	if h.lastPollError != nil {
+		health.LastPollError = h.lastPollError.Error()
+	}
+	if !h.handlerStarted.IsZero() {
+		health.LongestInFlight = time.Since(h.handlerStarted)
+	}
+	health.AbandonedHandlers = len(h.abandonedStarted)
+	if len(h.abandonedStarted) > 0 {
+		health.LongestAbandoned = time.Since(slices.MinFunc(h.abandonedStarted, time.Time.Compare))
+	}
+	for key := range h.assigned {
+		health.AssignedPartitions = append(health.AssignedPartitions, TopicPartition{Topic: key.topic, Partition: key.partition})
+	}
+	slices.SortFunc(health.AssignedPartitions, func(a, b TopicPartition) int {
+		return cmp.Or(cmp.Compare(a.Topic, b.Topic), cmp.Compare(a.Partition, b.Partition))
+	})
+	return health
+}
+
+// setListening records that StartListening entered its loop (true) or
+// returned (false).
+func (h *healthState) setListening(listening bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.listening = listening
+}
+
+// setSubscribed records that the consumer subscribed to the route topics
+// (true) or was closed (false).
+func (h *healthState) setSubscribed(subscribed bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subscribed = subscribed
+}
+
+func (h *healthState) polled(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var kafkaErr kafka.Error
+	if err == nil || (errors.As(err, &kafkaErr) && kafkaErr.Code() == kafka.ErrTimedOut) {
+		h.lastPoll = time.Now()
+		h.consecutivePollErrors = 0
+		return
+	}
+	h.consecutivePollErrors++
+	h.lastPollError = err
+}
+
+func (h *healthState) committed() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastCommit = time.Now()
+}
+
+func (h *healthState) handling(started time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.handlerStarted = started
+}
+
+// abandoned records a handler started at started that TimeoutHandler gave
+// up on (running) or that finished after that (!running).
+func (h *healthState) abandoned(started time.Time, running bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if running {
+		h.abandonedStarted = append(h.abandonedStarted, started)
+		return
+	}
+	if i := slices.IndexFunc(h.abandonedStarted, started.Equal); i >= 0 {
+		h.abandonedStarted = slices.Delete(h.abandonedStarted, i, i+1)
+	}
+}
+
+func (h *healthState) rebalanced(event RebalanceEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.assigned == nil {
+		h.assigned = make(map[partitionKey]struct{})
+	}
+	for _, tp := range event.Partitions {
+		key := partitionKey{topic: tp.Topic, partition: tp.Partition}
+		if event.Type == PartitionsAssigned {
+			h.assigned[key] = struct{}{}
+		} else {
+			delete(h.assigned, key)
+		}
+	}
+}
+
+type healthConfig struct {
+	maxPollInterval    time.Duration
+	maxHandlerDuration time.Duration
+	maxPollErrors      int
+	requireAssignment  bool
+}
+
+// HealthOption configures the thresholds of LivenessHandler and ReadinessHandler.
+type HealthOption func(*healthConfig)
+
+// WithMaxPollInterval sets how long ago the last successful poll of a started
+// router may be before it is reported as not live. The default is
+// DefaultMaxPollInterval.
+func WithMaxPollInterval(d time.Duration) HealthOption {
+	return func(c *healthConfig) {
+		c.maxPollInterval = d
+	}
+}
+
+// WithMaxHandlerDuration sets how long a handler may run before the router
+// is reported as not live. It applies to handlers TimeoutHandler gave up on
+// as well, measured from their start. The default is
+// DefaultMaxHandlerDuration.
+func WithMaxHandlerDuration(d time.Duration) HealthOption {
+	return func(c *healthConfig) {
+		c.maxHandlerDuration = d
+	}
+}
+
+// WithMaxPollErrors sets the number of consecutive poll errors from which the
+// router is reported as not ready. The default is DefaultMaxPollErrors.
+func WithMaxPollErrors(n int) HealthOption {
+	return func(c *healthConfig) {
+		c.maxPollErrors = n
+	}
+}
+
+// WithRequireAssignment makes the router not ready while it has no assigned
+// partitions. It is off by default, because group members beyond the number
+// of partitions legitimately stay idle.
+func WithRequireAssignment() HealthOption {
+	return func(c *healthConfig) {
+		c.requireAssignment = true
+	}
+}
+
+func newHealthConfig(opts []HealthOption) *healthConfig {
+	cfg := &healthConfig{
+		maxPollInterval:    DefaultMaxPollInterval,
+		maxHandlerDuration: DefaultMaxHandlerDuration,
+		maxPollErrors:      DefaultMaxPollErrors,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// liveness returns the reasons the router should be restarted: a started
+// router that has stopped polling or is stuck in a handler.
+func (h Health) liveness(cfg *healthConfig) []string {
+	var problems []string
+	if h.Started && !h.LastPoll.IsZero() && cfg.maxPollInterval > 0 && time.Since(h.LastPoll) > cfg.maxPollInterval {
+		problems = append(problems, fmt.Sprintf("last successful poll %s ago", time.Since(h.LastPoll).Round(time.Second)))
+	}
+	if cfg.maxHandlerDuration > 0 && h.LongestInFlight > cfg.maxHandlerDuration {
+		problems = append(problems, fmt.Sprintf("handler running for %s", h.LongestInFlight.Round(time.Second)))
+	}
+	if cfg.maxHandlerDuration > 0 && h.LongestAbandoned > cfg.maxHandlerDuration {
+		problems = append(problems, fmt.Sprintf("abandoned handler running for %s", h.LongestAbandoned.Round(time.Second)))
+	}
+	return problems
+}
+
+// readiness returns the reasons the router is not ready to consume.
+func (h Health) readiness(cfg *healthConfig) []string {
+	problems := h.liveness(cfg)
+	if !h.Started {
+		problems = append(problems, "router not started")
+	}
+	if !h.Subscribed {
+		problems = append(problems, "consumer not subscribed")
+	}
+	if cfg.maxPollErrors > 0 && h.ConsecutivePollErrors >= cfg.maxPollErrors {
+		problems = append(problems, fmt.Sprintf("%d consecutive poll errors: %s", h.ConsecutivePollErrors, h.LastPollError))
+	}
+	if cfg.requireAssignment && len(h.AssignedPartitions) == 0 {
+		problems = append(problems, "no partitions assigned")
+	}
+	return problems
+}
+
+// LivenessHandler returns an http.Handler for liveness probes. It responds
+// 503 when a started router has not polled within the max poll interval or a
+// handler has been running longer than the max handler duration, and 200
+// otherwise. The body is the JSON encoded Health with the status and the
+// failed checks.
+func (r *KafkaRouter) LivenessHandler(opts ...HealthOption) http.Handler {
+	cfg := newHealthConfig(opts)
+	return healthHandler(r, func(h Health) []string { return h.liveness(cfg) })
+}
+
+// ReadinessHandler returns an http.Handler for readiness probes. In addition
+// to the liveness checks it requires the router to be started and
+// subscribed, with fewer consecutive poll errors than the maximum and, with
+// WithRequireAssignment, at least one assigned partition.
+func (r *KafkaRouter) ReadinessHandler(opts ...HealthOption) http.Handler {
+	cfg := newHealthConfig(opts)
+	return healthHandler(r, func(h Health) []string { return h.readiness(cfg) })
+}
+
+func healthHandler(r *KafkaRouter, check func(Health) []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		health := r.Health()
+		problems := check(health)
+
+		body := struct {
+			Status   string   `json:"status"`
+			Problems []string `json:"problems,omitempty"`
+			Health
+		}{Status: "ok", Problems: problems, Health: health}
+
+		status := http.StatusOK
+		if len(problems) > 0 {
+			body.Status = "fail"
+			status = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(body)
+	})
+}
@@ -0,0 +1,56 @@
+package kafkalight
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthState_Polled(t *testing.T) {
+	var h healthState
+	h.polled(errors.New("broker down"))
+	h.polled(errors.New("broker down"))
+	assert.Equal(t, 2, h.consecutivePollErrors)
+	assert.True(t, h.lastPoll.IsZero())
+
+	h.polled(kafka.NewError(kafka.ErrTimedOut, "timed out", false))
+	assert.Zero(t, h.consecutivePollErrors, "timeouts are successful polls")
+	assert.False(t, h.lastPoll.IsZero())
+}
+
+func TestHealth_Checks(t *testing.T) {
+	cfg := newHealthConfig([]HealthOption{
+		WithMaxPollInterval(time.Minute),
+		WithMaxHandlerDuration(time.Minute),
+		WithMaxPollErrors(3),
+	})
+
+	healthy := Health{Started: true, Subscribed: true, LastPoll: time.Now()}
+	assert.Empty(t, healthy.liveness(cfg))
+	assert.Empty(t, healthy.readiness(cfg))
+	assert.NotEmpty(t, healthy.readiness(newHealthConfig([]HealthOption{WithRequireAssignment()})))
+
+	assert.Empty(t, Health{}.liveness(cfg), "a router that is not started is live")
+	assert.Len(t, Health{}.readiness(cfg), 2)
+
+	stale := healthy
+	stale.LastPoll = time.Now().Add(-2 * time.Minute)
+	assert.Len(t, stale.liveness(cfg), 1)
+
+	stuck := healthy
+	stuck.LongestInFlight = 2 * time.Minute
+	assert.Len(t, stuck.liveness(cfg), 1)
+
+	abandoned := healthy
+	abandoned.AbandonedHandlers = 1
+	abandoned.LongestAbandoned = 6 * time.Minute
+	assert.Len(t, abandoned.liveness(cfg), 1, "a handler abandoned by TimeoutHandler can still be stuck")
+
+	failing := healthy
+	failing.ConsecutivePollErrors = 3
+	assert.Empty(t, failing.liveness(cfg))
+	assert.Len(t, failing.readiness(cfg), 1)
+}
@@ -0,0 +1,119 @@
+package kafkalight
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// RebalanceType tells whether partitions were assigned or revoked.
+type RebalanceType int
+
+// Rebalance types.
+const (
+	PartitionsAssigned RebalanceType = iota
+	PartitionsRevoked
+)
+
+func (t RebalanceType) String() string {
+	if t == PartitionsRevoked {
+		return "revoked"
+	}
+	return "assigned"
+}
+
+// RebalanceEvent describes a change of the router's partition assignment.
+type RebalanceEvent struct {
+	Type       RebalanceType
+	Partitions []TopicPartition
+}
+
+// Hooks receives router events that happen outside message handlers, e.g.
+// for metrics. Nil fields are ignored. Hooks are called from the listener
+// goroutine and from the rebalance callback and should return quickly.
+type Hooks struct {
+	// OnCommit is called after every offset commit made by the router, with
+	// the committed offsets (the next offsets to read) or the commit error.
+	OnCommit func(offsets []TopicPartition, err error)
+	// OnPollError is called when reading a message fails. Read timeouts are
+	// not reported.
+	OnPollError func(err error)
+	// OnRebalance is called when partitions are assigned to or revoked from
+	// the router.
+	OnRebalance func(event RebalanceEvent)
+}
+
+// WithHooks registers router hooks. It may be used more than once; hooks are
+// called in registration order.
+func WithHooks(h Hooks) Option {
+	return func(r *KafkaRouter) {
+		r.hooks = append(r.hooks, h)
+	}
+}
+
+func (r *KafkaRouter) onCommit(offsets []kafka.TopicPartition, err error) {
+	var committed []TopicPartition
+	for _, h := range r.hooks {
+		if h.OnCommit == nil {
+			continue
+		}
+		if committed == nil && err == nil {
+			committed = convertTopicPartitions(offsets)
+		}
+		h.OnCommit(committed, err)
+	}
+}
+
+func (r *KafkaRouter) onPollError(err error) {
+	var kafkaErr kafka.Error
+	if errors.As(err, &kafkaErr) && kafkaErr.Code() == kafka.ErrTimedOut {
+		return
+	}
+	for _, h := range r.hooks {
+		if h.OnPollError != nil {
+			h.OnPollError(err)
+		}
+	}
+}
+
+// rebalance is the rebalance callback passed to SubscribeTopics. Partitions
+// are assigned or revoked by the consumer itself once the callback returns.
+func (r *KafkaRouter) rebalance(c *kafka.Consumer, ev kafka.Event) error {
+	var event RebalanceEvent
+	switch e := ev.(type) {
+	case kafka.AssignedPartitions:
+		event = RebalanceEvent{Type: PartitionsAssigned, Partitions: convertTopicPartitions(e.Partitions)}
+		if err := r.pauseAssigned(c, e.Partitions); err != nil {
+			r.errorHandler(fmt.Errorf("failed to pause assigned partitions: %w", err))
+		}
+	case kafka.RevokedPartitions:
+		event = RebalanceEvent{Type: PartitionsRevoked, Partitions: convertTopicPartitions(e.Partitions)}
+	default:
+		return nil
+	}
+
+	r.health.rebalanced(event)
+	for _, h := range r.hooks {
+		if h.OnRebalance != nil {
+			h.OnRebalance(event)
+		}
+	}
+	return nil
+}
+
+func convertTopicPartitions(tps []kafka.TopicPartition) []TopicPartition {
+	converted := make([]TopicPartition, 0, len(tps))
+	for _, tp := range tps {
+		var topic string
+		if tp.Topic != nil {
+			topic = *tp.Topic
+		}
+		converted = append(converted, TopicPartition{
+			Topic:     topic,
+			Partition: tp.Partition,
+			Offset:    int64(tp.Offset),
+		})
+	}
+	return converted
+}
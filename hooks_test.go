@@ -0,0 +1,38 @@
+package kafkalight
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouter_onPollError(t *testing.T) {
+	var reported []error
+	r := &KafkaRouter{}
+	WithHooks(Hooks{OnPollError: func(err error) { reported = append(reported, err) }})(r)
+
+	r.onPollError(kafka.NewError(kafka.ErrTimedOut, "timed out", false))
+	r.onPollError(errors.New("broker down"))
+
+	assert.Len(t, reported, 1)
+	assert.EqualError(t, reported[0], "broker down")
+}
+
+func TestRouter_rebalance(t *testing.T) {
+	var events []RebalanceEvent
+	r := &KafkaRouter{}
+	WithHooks(Hooks{OnRebalance: func(e RebalanceEvent) { events = append(events, e) }})(r)
+
+	topic := "orders"
+	partitions := []kafka.TopicPartition{{Topic: &topic, Partition: 2, Offset: kafka.OffsetInvalid}}
+	assert.NoError(t, r.rebalance(nil, kafka.AssignedPartitions{Partitions: partitions}))
+	assert.NoError(t, r.rebalance(nil, kafka.RevokedPartitions{Partitions: partitions}))
+	assert.NoError(t, r.rebalance(nil, kafka.PartitionEOF{}))
+
+	assert.Equal(t, []RebalanceEvent{
+		{Type: PartitionsAssigned, Partitions: []TopicPartition{{Topic: "orders", Partition: 2, Offset: int64(kafka.OffsetInvalid)}}},
+		{Type: PartitionsRevoked, Partitions: []TopicPartition{{Topic: "orders", Partition: 2, Offset: int64(kafka.OffsetInvalid)}}},
+	}, events)
+}
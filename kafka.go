@@ -2,35 +2,72 @@ package kafkalight
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
 	"go.uber.org/zap"
+
+	"github.com/overtonx/kafkalight/redact"
 )
 
 const (
 	defaultReadTimeout = time.Second * 10
 )
 
+// ErrRouteNotFound is returned by Dispatch when no handler is registered for the message topic.
+var ErrRouteNotFound = errors.New("route not found")
+
 type MessageHandler func(ctx context.Context, msg *Message) error
 type Middleware func(MessageHandler) MessageHandler
+
+// Consumer is the subset of *kafka.Consumer used by KafkaRouter.
+// It allows the router to be driven by an alternative implementation,
+// such as the in-memory broker from the kafkalighttest package.
+type Consumer interface {
+	SubscribeTopics(topics []string, rebalanceCb kafka.RebalanceCb) error
+	ReadMessage(timeout time.Duration) (*kafka.Message, error)
+	CommitMessage(m *kafka.Message) ([]kafka.TopicPartition, error)
+	CommitOffsets(offsets []kafka.TopicPartition) ([]kafka.TopicPartition, error)
+	Assignment() ([]kafka.TopicPartition, error)
+	Committed(partitions []kafka.TopicPartition, timeoutMs int) ([]kafka.TopicPartition, error)
+	Position(partitions []kafka.TopicPartition) ([]kafka.TopicPartition, error)
+	QueryWatermarkOffsets(topic string, partition int32, timeoutMs int) (low, high int64, err error)
+	GetWatermarkOffsets(topic string, partition int32) (low, high int64, err error)
+	Pause(partitions []kafka.TopicPartition) error
+	Resume(partitions []kafka.TopicPartition) error
+	OffsetsForTimes(times []kafka.TopicPartition, timeoutMs int) ([]kafka.TopicPartition, error)
+	SeekPartitions(partitions []kafka.TopicPartition) ([]kafka.TopicPartition, error)
+	Close() error
+}
+
 type KafkaRouter struct {
 	mu               sync.RWMutex
 	wg               sync.WaitGroup
 	started          bool
 	doneCh           chan struct{}
 	listenerDone     chan struct{}
-	routes           map[string]MessageHandler
+	routes           map[string]*route
 	middlewares      []Middleware
+	pausedMu         sync.Mutex
+	paused           map[string]bool
 	topics           []string
 	errorHandler     ErrorHandler
 	readTimeout      time.Duration
 	logger           *zap.Logger
-	consumer         *kafka.Consumer
+	consumer         Consumer
 	consumerConfig   *kafka.ConfigMap
 	enableAutoCommit bool
+	commitPermanent  bool
+	offsets          *offsetTracker
+	abandoned        *abandonedHandlers
+	hooks            []Hooks
+	lag              *lagMonitor
+	health           healthState
+	logBaggage       []string
+	redaction        *redact.Policy
 }
 
 func NewRouter(opts ...Option) (*KafkaRouter, error) {
@@ -44,11 +81,14 @@ func NewRouter(opts ...Option) (*KafkaRouter, error) {
 		started:        false,
 		doneCh:         make(chan struct{}),
 		listenerDone:   make(chan struct{}),
-		routes:         make(map[string]MessageHandler),
+		routes:         make(map[string]*route),
+		paused:         make(map[string]bool),
 		readTimeout:    defaultReadTimeout,
 		logger:         zap.NewNop(),
 		consumerConfig: defaultConfig,
+		offsets:        newOffsetTracker(),
 	}
+	router.abandoned = &abandonedHandlers{wg: &router.wg, health: &router.health, max: defaultMaxAbandonedHandlers}
 
 	for _, opt := range opts {
 		opt(router)
@@ -56,11 +96,13 @@ func NewRouter(opts ...Option) (*KafkaRouter, error) {
 
 	router.enableAutoCommit = isAutoCommitEnabled(router.consumerConfig)
 
-	c, err := kafka.NewConsumer(router.consumerConfig)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create consumer: %w", err)
+	if router.consumer == nil {
+		c, err := kafka.NewConsumer(router.consumerConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create consumer: %w", err)
+		}
+		router.consumer = c
 	}
-	router.consumer = c
 	router.errorHandler = errorHandler(router.logger)
 
 	return router, nil
@@ -75,19 +117,46 @@ func (r *KafkaRouter) Use(middleware ...Middleware) {
 
 // RegisterRoute registers a message handler for a specific topic.
 // Middlewares are applied to the handler in reverse order to create an onion-like wrapping.
+// The handler timeout of the route, if any, is applied inside them.
 // Note: routes should be registered before calling StartListening.
-func (r *KafkaRouter) RegisterRoute(topic string, handler MessageHandler) {
+func (r *KafkaRouter) RegisterRoute(topic string, handler MessageHandler, opts ...RouteOption) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	rt := &route{topic: topic}
+	for _, opt := range opts {
+		opt(rt)
+	}
+
+	if rt.timeout > 0 {
+		handler = TimeoutHandler(handler, rt.timeout)
+	}
 	for i := len(r.middlewares) - 1; i >= 0; i-- {
 		handler = r.middlewares[i](handler)
 	}
+	rt.handler = handler
+	for _, mw := range r.middlewares {
+		rt.middleware = append(rt.middleware, middlewareName(mw))
+	}
 
 	if _, exists := r.routes[topic]; !exists {
 		r.topics = append(r.topics, topic)
 	}
-	r.routes[topic] = handler
+	r.routes[topic] = rt
+}
+
+// Dispatch runs msg through the handler registered for its topic, middlewares included.
+// It neither reads from nor commits to Kafka, which makes it suitable for
+// replaying recorded messages and for tests.
+func (r *KafkaRouter) Dispatch(ctx context.Context, msg *Message) error {
+	r.mu.RLock()
+	rt, exists := r.routes[msg.TopicPartition.Topic]
+	r.mu.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrRouteNotFound, msg.TopicPartition.Topic)
+	}
+	return rt.handle(r.messageContext(ctx, msg), msg)
 }
 
 func (r *KafkaRouter) StartListening(ctx context.Context) error {
@@ -97,14 +166,19 @@ func (r *KafkaRouter) StartListening(ctx context.Context) error {
 		return fmt.Errorf("router already started")
 	}
 
-	if err := r.consumer.SubscribeTopics(r.topics, nil); err != nil {
+	if err := r.consumer.SubscribeTopics(r.topics, r.rebalance); err != nil {
 		r.mu.Unlock()
 		return fmt.Errorf("failed to subscribe to topics: %w", err)
 	}
 
+	r.health.setSubscribed(true)
+
 	r.started = true
+	r.health.setListening(true)
+	r.startLagMonitor(ctx)
 	r.mu.Unlock()
 	defer close(r.listenerDone)
+	defer r.health.setListening(false)
 
 	r.logger.Info("router started")
 	for {
@@ -119,7 +193,9 @@ func (r *KafkaRouter) StartListening(ctx context.Context) error {
 		}
 
 		msg, err := r.consumer.ReadMessage(r.readTimeout)
+		r.health.polled(err)
 		if err != nil {
+			r.onPollError(err)
 			r.errorHandler(err)
 			continue
 		}
@@ -136,7 +212,7 @@ func (r *KafkaRouter) StartListening(ctx context.Context) error {
 		}
 
 		r.mu.RLock()
-		handler, exists := r.routes[*msg.TopicPartition.Topic]
+		rt, exists := r.routes[*msg.TopicPartition.Topic]
 		r.mu.RUnlock()
 
 		if !exists {
@@ -147,14 +223,23 @@ func (r *KafkaRouter) StartListening(ctx context.Context) error {
 		r.wg.Add(1)
 		func() {
 			defer r.wg.Done()
-			handlerCtx, cancel := context.WithCancel(ctx)
+			handlerCtx, cancel := context.WithCancel(r.messageContext(ctx, kafkaMsg))
 			defer cancel()
-			if err := handler(handlerCtx, kafkaMsg); err != nil {
-				r.errorHandler(fmt.Errorf("error handling message: %v", err))
-				return
+			handlerCtx = withAbandonedHandlers(handlerCtx, r.abandoned)
+			if !r.enableAutoCommit {
+				handlerCtx = withCommitScope(handlerCtx, r.offsets, msg)
+			}
+			r.health.handling(time.Now())
+			err := rt.handle(handlerCtx, kafkaMsg)
+			r.health.handling(time.Time{})
+			if err != nil {
+				r.errorHandler(fmt.Errorf("error handling message: %w", err))
+				if !r.commitPermanent || !IsPermanent(err) {
+					return
+				}
 			}
 			if !r.enableAutoCommit {
-				if _, err := r.consumer.CommitMessage(msg); err != nil {
+				if err := r.commit(msg); err != nil {
 					r.errorHandler(fmt.Errorf("error committing message offset: %v", err))
 				}
 			}
@@ -185,8 +270,11 @@ func (r *KafkaRouter) Close(ctx context.Context) error {
 	}
 	r.started = false
 	close(r.doneCh)
+	r.health.setListening(false)
 	r.mu.Unlock()
 
+	r.waitLagMonitor()
+
 	r.logger.Info("shutting down, waiting for message handlers to finish")
 
 	waitCh := make(chan struct{})
@@ -203,6 +291,7 @@ func (r *KafkaRouter) Close(ctx context.Context) error {
 	}
 
 	r.logger.Info("closing kafka consumer")
+	r.health.setSubscribed(false)
 	if err := r.consumer.Close(); err != nil {
 		return err
 	}
@@ -0,0 +1,472 @@
+package kafkalight_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/overtonx/kafkalight"
+	"github.com/overtonx/kafkalight/kafkalighttest"
+)
+
+type order struct {
+	ID int `json:"id"`
+}
+
+func TestRouter_DoesNotCommitPermanentFailuresByDefault(t *testing.T) {
+	broker := kafkalighttest.NewBroker()
+	broker.CreateTopic("orders", 1)
+	broker.MustProduce(t,
+		kafkalighttest.NewMessage("orders", "", `{"id":1}`),
+		kafkalighttest.NewMessage("orders", "", `not json`),
+	)
+
+	group := broker.ConsumerGroup("group")
+	router := kafkalighttest.NewRouter(t, group)
+	kafkalight.RegisterTyped(router, "orders", func(context.Context, *kafkalight.Message, order) error {
+		return nil
+	}, nil)
+	kafkalighttest.Start(t, router)
+
+	group.WaitProcessed(t, 2)
+
+	group.AssertCommitted(t, kafkalight.TopicPartition{Topic: "orders", Partition: 0}, 1)
+}
+
+func TestRouter_CommitsPermanentFailures(t *testing.T) {
+	broker := kafkalighttest.NewBroker()
+	broker.CreateTopic("orders", 1)
+	broker.MustProduce(t,
+		kafkalighttest.NewMessage("orders", "", `{"id":1}`),
+		kafkalighttest.NewMessage("orders", "", `not json`),
+	)
+	broker.CreateTopic("payments", 1)
+	broker.MustProduce(t, kafkalighttest.NewMessage("payments", "", `retry me`))
+
+	group := broker.ConsumerGroup("group")
+	router := kafkalighttest.NewRouter(t, group, kafkalight.WithCommitOnPermanentError())
+	kafkalight.RegisterTyped(router, "orders", func(context.Context, *kafkalight.Message, order) error {
+		return nil
+	}, nil)
+	router.RegisterRoute("payments", func(context.Context, *kafkalight.Message) error {
+		return errors.New("transient failure")
+	})
+	kafkalighttest.Start(t, router)
+
+	group.WaitProcessed(t, 3)
+
+	group.AssertCommitted(t, kafkalight.TopicPartition{Topic: "orders", Partition: 0}, 2)
+	_, committed := group.Committed(kafkalight.TopicPartition{Topic: "payments", Partition: 0})
+	assert.False(t, committed, "transient failures are not committed")
+}
+
+func TestRouter_Routes(t *testing.T) {
+	router := kafkalighttest.NewRouter(t, kafkalighttest.NewBroker().ConsumerGroup("group"))
+	kafkalight.RegisterTyped(router, "orders", func(context.Context, *kafkalight.Message, *order) error {
+		return nil
+	}, nil)
+	router.RegisterRoute("raw", func(context.Context, *kafkalight.Message) error { return nil })
+
+	routes := router.Routes()
+	require.Len(t, routes, 2)
+	assert.Equal(t, "orders", routes[0].Topic)
+	assert.Equal(t, reflect.TypeOf(&order{}), routes[0].PayloadType)
+	assert.Equal(t, "raw", routes[1].Topic)
+	assert.Nil(t, routes[1].PayloadType)
+}
+
+func TestRouter_DefaultCodec(t *testing.T) {
+	router := kafkalighttest.NewRouter(t, kafkalighttest.NewBroker().ConsumerGroup("group"))
+
+	var got []string
+	kafkalight.RegisterTyped(router, "raw", func(_ context.Context, _ *kafkalight.Message, payload string) error {
+		got = append(got, payload)
+		return nil
+	}, nil, kafkalight.WithDefaultCodec(kafkalight.RawCodec{}))
+
+	require.NoError(t, router.Dispatch(context.Background(), kafkalighttest.NewMessage("raw", "", "plain text")))
+
+	jsonMsg := kafkalighttest.NewMessage("raw", "", "")
+	require.NoError(t, jsonMsg.Encode("encoded", kafkalight.ContentTypeJSON))
+	require.NoError(t, router.Dispatch(context.Background(), jsonMsg))
+
+	assert.Equal(t, []string{"plain text", "encoded"}, got)
+}
+
+func TestRouter_DeferCommit(t *testing.T) {
+	broker := kafkalighttest.NewBroker()
+	broker.CreateTopic("jobs", 1)
+	broker.MustProduce(t,
+		kafkalighttest.NewMessage("jobs", "", "hold"),
+		kafkalighttest.NewMessage("jobs", "", "a"),
+		kafkalighttest.NewMessage("jobs", "", "b"),
+	)
+
+	released := make(chan func(), 1)
+	group := broker.ConsumerGroup("group")
+	router := kafkalighttest.NewRouter(t, group)
+	router.RegisterRoute("jobs", func(ctx context.Context, msg *kafkalight.Message) error {
+		if string(msg.Value) == "hold" {
+			release, ok := kafkalight.DeferCommit(ctx)
+			assert.True(t, ok)
+			released <- release
+		}
+		return nil
+	})
+	kafkalighttest.Start(t, router)
+
+	tp := kafkalight.TopicPartition{Topic: "jobs", Partition: 0}
+	group.WaitProcessed(t, 3)
+	group.AssertCommitted(t, tp, 0)
+
+	release := <-released
+	release()
+	release()
+	broker.MustProduce(t, kafkalighttest.NewMessage("jobs", "", "c"))
+	group.WaitProcessed(t, 4)
+	group.AssertCommitted(t, tp, 4)
+
+	_, ok := kafkalight.DeferCommit(context.Background())
+	assert.False(t, ok, "outside the router commits are not deferred")
+}
+
+func TestRouter_Hooks(t *testing.T) {
+	broker := kafkalighttest.NewBroker()
+	broker.CreateTopic("orders", 1)
+	broker.MustProduce(t, kafkalighttest.NewMessage("orders", "", "a"))
+
+	var (
+		mu         sync.Mutex
+		commits    [][]kafkalight.TopicPartition
+		rebalances []kafkalight.RebalanceEvent
+	)
+	hooks := kafkalight.Hooks{
+		OnCommit: func(offsets []kafkalight.TopicPartition, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			assert.NoError(t, err)
+			commits = append(commits, offsets)
+		},
+		OnRebalance: func(event kafkalight.RebalanceEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			rebalances = append(rebalances, event)
+		},
+	}
+
+	group := broker.ConsumerGroup("group")
+	router := kafkalighttest.NewRouter(t, group, kafkalight.WithHooks(hooks), kafkalight.WithHooks(kafkalight.Hooks{}))
+	router.RegisterRoute("orders", func(context.Context, *kafkalight.Message) error { return nil })
+	kafkalighttest.Start(t, router)
+	group.WaitProcessed(t, 1)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, [][]kafkalight.TopicPartition{{{Topic: "orders", Partition: 0, Offset: 1}}}, commits)
+	require.Len(t, rebalances, 1)
+	assert.Equal(t, kafkalight.PartitionsAssigned, rebalances[0].Type)
+	assert.Equal(t, "assigned", rebalances[0].Type.String())
+	assert.Equal(t, "orders", rebalances[0].Partitions[0].Topic)
+}
+
+func TestRouter_LagMonitor(t *testing.T) {
+	broker := kafkalighttest.NewBroker()
+	broker.CreateTopic("orders", 1)
+	for i := 0; i < 5; i++ {
+		broker.MustProduce(t, kafkalighttest.NewMessage("orders", "", "order"))
+	}
+
+	type crossing struct {
+		lag      int64
+		exceeded bool
+	}
+	var (
+		mu        sync.Mutex
+		crossings []crossing
+		checks    int
+	)
+	release := make(chan struct{})
+	group := broker.ConsumerGroup("group")
+	router := kafkalighttest.NewRouter(t, group, kafkalight.WithLagMonitor(10*time.Millisecond,
+		kafkalight.WithLagThreshold("orders", 2),
+		kafkalight.OnLagThreshold(func(lag kafkalight.PartitionLag, exceeded bool) {
+			mu.Lock()
+			defer mu.Unlock()
+			crossings = append(crossings, crossing{lag: lag.Lag, exceeded: exceeded})
+		}),
+		kafkalight.OnLag(func([]kafkalight.PartitionLag) {
+			mu.Lock()
+			defer mu.Unlock()
+			checks++
+		}),
+	))
+	router.RegisterRoute("orders", func(ctx context.Context, msg *kafkalight.Message) error {
+		<-release
+		return nil
+	})
+	assert.Nil(t, router.Lag(), "no lag before the first check")
+	kafkalighttest.Start(t, router)
+
+	require.Eventually(t, func() bool {
+		lag := router.Lag()
+		return len(lag) == 1 && lag[0].Position == 1
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, kafkalight.PartitionLag{
+		Topic: "orders", Partition: 0, Committed: -1, Position: 1, HighWatermark: 5, Lag: 4,
+	}, router.Lag()[0])
+
+	close(release)
+	group.WaitProcessed(t, 5)
+	require.Eventually(t, func() bool {
+		lag := router.Lag()
+		return len(lag) == 1 && lag[0].Lag == 0
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int64(5), router.Lag()[0].Committed)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, crossings, 2)
+	assert.True(t, crossings[0].exceeded)
+	assert.Greater(t, crossings[0].lag, int64(2))
+	assert.False(t, crossings[1].exceeded)
+	assert.LessOrEqual(t, crossings[1].lag, int64(2))
+	assert.Greater(t, checks, 1)
+}
+
+// countingWatermarks counts broker watermark queries and optionally hides the
+// cached watermarks.
+type countingWatermarks struct {
+	*kafkalighttest.Consumer
+	uncached bool
+	queries  atomic.Int32
+}
+
+func (c *countingWatermarks) GetWatermarkOffsets(topic string, partition int32) (int64, int64, error) {
+	if c.uncached {
+		return int64(kafka.OffsetInvalid), int64(kafka.OffsetInvalid), nil
+	}
+	return c.Consumer.GetWatermarkOffsets(topic, partition)
+}
+
+func (c *countingWatermarks) QueryWatermarkOffsets(topic string, partition int32, timeoutMs int) (int64, int64, error) {
+	c.queries.Add(1)
+	return c.Consumer.QueryWatermarkOffsets(topic, partition, timeoutMs)
+}
+
+func TestRouter_LagUsesCachedWatermarks(t *testing.T) {
+	for _, uncached := range []bool{false, true} {
+		broker := kafkalighttest.NewBroker()
+		broker.CreateTopic("orders", 1)
+		for i := 0; i < 3; i++ {
+			broker.MustProduce(t, kafkalighttest.NewMessage("orders", "", "order"))
+		}
+		group := broker.ConsumerGroup("group")
+		consumer := &countingWatermarks{Consumer: group.Consumer(), uncached: uncached}
+		router := kafkalighttest.NewRouter(t, group, kafkalight.WithConsumer(consumer), kafkalight.WithLagMonitor(time.Millisecond))
+		router.RegisterRoute("orders", func(context.Context, *kafkalight.Message) error { return nil })
+		kafkalighttest.Start(t, router)
+		group.WaitProcessed(t, 3)
+
+		require.Eventually(t, func() bool {
+			lag := router.Lag()
+			return len(lag) == 1 && lag[0].Committed == 3
+		}, time.Second, time.Millisecond)
+		queries := consumer.queries.Load()
+		time.Sleep(20 * time.Millisecond)
+
+		assert.Equal(t, int64(3), router.Lag()[0].HighWatermark)
+		if uncached {
+			assert.Greater(t, consumer.queries.Load(), queries, "unknown watermarks are queried")
+		} else {
+			assert.Equal(t, queries, consumer.queries.Load(), "cached watermarks are not queried")
+		}
+	}
+}
+
+// blockingWatermarks blocks the first watermark lookup until released and
+// records lookups made after the consumer was closed.
+type blockingWatermarks struct {
+	*kafkalighttest.Consumer
+	entered, release chan struct{}
+	once             sync.Once
+	closed           atomic.Bool
+	usedAfterClose   atomic.Bool
+}
+
+func (c *blockingWatermarks) block() {
+	c.once.Do(func() {
+		close(c.entered)
+		<-c.release
+	})
+	if c.closed.Load() {
+		c.usedAfterClose.Store(true)
+	}
+}
+
+func (c *blockingWatermarks) GetWatermarkOffsets(topic string, partition int32) (int64, int64, error) {
+	c.block()
+	return c.Consumer.GetWatermarkOffsets(topic, partition)
+}
+
+func (c *blockingWatermarks) QueryWatermarkOffsets(topic string, partition int32, timeoutMs int) (int64, int64, error) {
+	c.block()
+	return c.Consumer.QueryWatermarkOffsets(topic, partition, timeoutMs)
+}
+
+func (c *blockingWatermarks) Committed(partitions []kafka.TopicPartition, timeoutMs int) ([]kafka.TopicPartition, error) {
+	if c.closed.Load() {
+		c.usedAfterClose.Store(true)
+	}
+	return c.Consumer.Committed(partitions, timeoutMs)
+}
+
+func (c *blockingWatermarks) Close() error {
+	c.closed.Store(true)
+	return c.Consumer.Close()
+}
+
+func TestRouter_CloseWaitsForLagMonitor(t *testing.T) {
+	broker := kafkalighttest.NewBroker()
+	broker.CreateTopic("orders", 2)
+	group := broker.ConsumerGroup("group")
+	consumer := &blockingWatermarks{
+		Consumer: group.Consumer(),
+		entered:  make(chan struct{}),
+		release:  make(chan struct{}),
+	}
+	router := kafkalighttest.NewRouter(t, group, kafkalight.WithConsumer(consumer), kafkalight.WithLagMonitor(time.Millisecond))
+	router.RegisterRoute("orders", func(context.Context, *kafkalight.Message) error { return nil })
+
+	go func() { _ = router.StartListening(context.Background()) }()
+	<-consumer.entered
+
+	closed := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+		closed <- router.Close(ctx)
+	}()
+
+	select {
+	case <-closed:
+		t.Fatal("Close returned while the lag monitor was querying the consumer")
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.False(t, consumer.closed.Load())
+
+	close(consumer.release)
+	require.NoError(t, <-closed)
+	assert.True(t, consumer.closed.Load())
+	assert.False(t, consumer.usedAfterClose.Load(), "the monitor stops between queries")
+}
+
+func TestRouter_Health(t *testing.T) {
+	broker := kafkalighttest.NewBroker()
+	broker.CreateTopic("orders", 1)
+	broker.MustProduce(t, kafkalighttest.NewMessage("orders", "", "a"), kafkalighttest.NewMessage("orders", "", "b"))
+
+	release := make(chan struct{})
+	group := broker.ConsumerGroup("group")
+	router := kafkalighttest.NewRouter(t, group)
+	router.RegisterRoute("orders", func(context.Context, *kafkalight.Message) error {
+		<-release
+		return nil
+	})
+
+	ready := router.ReadinessHandler(kafkalight.WithRequireAssignment())
+	live := router.LivenessHandler(kafkalight.WithMaxHandlerDuration(50 * time.Millisecond))
+	probe := func(h http.Handler) (int, map[string]any) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		var body map[string]any
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		return rec.Code, body
+	}
+
+	code, body := probe(ready)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "fail", body["status"])
+	assert.False(t, router.Health().Started)
+
+	kafkalighttest.Start(t, router)
+
+	require.Eventually(t, func() bool {
+		return router.Health().LongestInFlight > 50*time.Millisecond
+	}, time.Second, 5*time.Millisecond)
+	code, _ = probe(live)
+	assert.Equal(t, http.StatusServiceUnavailable, code, "a stuck handler fails liveness")
+
+	close(release)
+	group.WaitProcessed(t, 2)
+
+	health := router.Health()
+	assert.True(t, health.Started)
+	assert.True(t, health.Subscribed)
+	assert.Equal(t, []kafkalight.TopicPartition{{Topic: "orders", Partition: 0}}, health.AssignedPartitions)
+	assert.False(t, health.LastPoll.IsZero())
+	assert.False(t, health.LastCommit.IsZero())
+	assert.Zero(t, health.ConsecutivePollErrors)
+
+	code, body = probe(ready)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok", body["status"])
+	code, _ = probe(live)
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestRouter_HealthAfterListenerStops(t *testing.T) {
+	group := kafkalighttest.NewBroker().ConsumerGroup("group")
+	router := kafkalighttest.NewRouter(t, group)
+	router.RegisterRoute("orders", func(context.Context, *kafkalight.Message) error { return nil })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		_ = router.StartListening(ctx)
+	}()
+	require.Eventually(t, func() bool { return router.Health().Subscribed }, time.Second, 5*time.Millisecond)
+
+	cancel()
+	<-stopped
+	health := router.Health()
+	assert.False(t, health.Started, "a listener that returned is not started")
+	assert.True(t, health.Subscribed, "the consumer stays subscribed until it is closed")
+
+	closeCtx, closeCancel := context.WithTimeout(context.Background(), time.Second)
+	defer closeCancel()
+	require.NoError(t, router.Close(closeCtx))
+	assert.False(t, router.Health().Subscribed)
+}
+
+func TestRouter_PauseBeforeStart(t *testing.T) {
+	broker := kafkalighttest.NewBroker()
+	broker.CreateTopic("orders", 2)
+	broker.MustProduce(t, kafkalighttest.NewMessage("orders", "a", "a"), kafkalighttest.NewMessage("orders", "b", "b"))
+
+	group := broker.ConsumerGroup("group")
+	router := kafkalighttest.NewRouter(t, group)
+	router.RegisterRoute("orders", func(context.Context, *kafkalight.Message) error { return nil })
+	assert.ErrorIs(t, router.Pause("missing"), kafkalight.ErrRouteNotFound)
+	require.NoError(t, router.Pause("orders"))
+	assert.Equal(t, []string{"orders"}, router.Paused())
+
+	kafkalighttest.Start(t, router)
+	time.Sleep(50 * time.Millisecond)
+	assert.Zero(t, group.Processed(), "partitions of paused topics are paused on assignment")
+
+	require.NoError(t, router.Resume("orders"))
+	assert.Empty(t, router.Paused())
+	group.WaitProcessed(t, 2)
+}
@@ -0,0 +1,241 @@
+// Package kafkalighttest provides an in-memory Kafka stand-in for testing
+// kafkalight routers and producers without a broker or a mock cluster.
+//
+// A Broker keeps an append-only log per topic partition. Consumer groups read
+// from it through a fake consumer that implements kafkalight.Consumer, so a
+// real KafkaRouter with its middleware, routing and commits runs unchanged.
+package kafkalighttest
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/overtonx/kafkalight"
+)
+
+// DefaultWaitTimeout bounds how long the Wait* helpers block before failing the test.
+var DefaultWaitTimeout = 5 * time.Second
+
+var _ kafkalight.Producer = &Broker{}
+
+type record struct {
+	key       []byte
+	value     []byte
+	headers   []kafkalight.Header
+	timestamp time.Time
+}
+
+type partitionKey struct {
+	topic     string
+	partition int32
+}
+
+// Broker is an in-memory topic/partition log.
+// It implements kafkalight.Producer, so it can be handed to code that
+// publishes messages (for example to a dead letter topic).
+type Broker struct {
+	mu      sync.Mutex
+	topics  map[string][][]record
+	groups  map[string]*ConsumerGroup
+	changed chan struct{}
+	rr      map[string]int32
+}
+
+// NewBroker creates an empty Broker.
+func NewBroker() *Broker {
+	return &Broker{
+		topics:  make(map[string][][]record),
+		groups:  make(map[string]*ConsumerGroup),
+		changed: make(chan struct{}),
+		rr:      make(map[string]int32),
+	}
+}
+
+// NewMessage builds a message for the given topic. The partition is left to
+// the broker, which picks it from the key hash (or round-robin for empty keys).
+func NewMessage(topic, key, value string, headers ...kafkalight.Header) *kafkalight.Message {
+	k, _ := kafkalight.NewKey(key)
+	return &kafkalight.Message{
+		TopicPartition: kafkalight.TopicPartition{
+			Topic:     topic,
+			Partition: kafkalight.PartitionAny,
+		},
+		Key:     *k,
+		Value:   []byte(value),
+		Headers: headers,
+	}
+}
+
+// CreateTopic creates a topic with the given number of partitions.
+// Creating an existing topic is a no-op.
+func (b *Broker) CreateTopic(topic string, partitions int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, exists := b.topics[topic]; exists {
+		return
+	}
+	b.topics[topic] = make([][]record, partitions)
+	b.notifyLocked()
+}
+
+// Produce appends msg to its topic, creating the topic with a single
+// partition if it does not exist yet. The assigned partition and offset are
+// written back to msg.
+func (b *Broker) Produce(_ context.Context, msg *kafkalight.Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	topic := msg.TopicPartition.Topic
+	if topic == "" {
+		return fmt.Errorf("kafkalighttest: message has no topic")
+	}
+	if _, exists := b.topics[topic]; !exists {
+		b.topics[topic] = make([][]record, 1)
+	}
+	partitions := b.topics[topic]
+
+	partition := msg.TopicPartition.Partition
+	if partition < 0 {
+		partition = b.pickPartitionLocked(topic, msg.Key.Bytes(), int32(len(partitions)))
+	}
+	if int(partition) >= len(partitions) {
+		return fmt.Errorf("kafkalighttest: partition %d out of range for topic %s", partition, topic)
+	}
+
+	ts := msg.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	partitions[partition] = append(partitions[partition], record{
+		key:       cloneBytes(msg.Key.Bytes()),
+		value:     cloneBytes(msg.Value),
+		headers:   cloneHeaders(msg.Headers),
+		timestamp: ts,
+	})
+
+	msg.TopicPartition.Partition = partition
+	msg.TopicPartition.Offset = int64(len(partitions[partition]) - 1)
+	b.notifyLocked()
+	return nil
+}
+
+// MustProduce produces msgs and fails the test on error.
+func (b *Broker) MustProduce(t testing.TB, msgs ...*kafkalight.Message) {
+	t.Helper()
+
+	for _, msg := range msgs {
+		if err := b.Produce(context.Background(), msg); err != nil {
+			t.Fatalf("kafkalighttest: produce: %v", err)
+		}
+	}
+}
+
+// Messages returns every message stored in the topic, ordered by partition and offset.
+func (b *Broker) Messages(topic string) []*kafkalight.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var msgs []*kafkalight.Message
+	for p, records := range b.topics[topic] {
+		for offset, rec := range records {
+			msgs = append(msgs, rec.message(topic, int32(p), int64(offset)))
+		}
+	}
+	return msgs
+}
+
+// ConsumerGroup returns the consumer group with the given id, creating it if needed.
+func (b *Broker) ConsumerGroup(id string) *ConsumerGroup {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	g, exists := b.groups[id]
+	if !exists {
+		g = &ConsumerGroup{
+			broker:    b,
+			id:        id,
+			committed: make(map[partitionKey]int64),
+		}
+		b.groups[id] = g
+	}
+	return g
+}
+
+func (b *Broker) pickPartitionLocked(topic string, key []byte, n int32) int32 {
+	if len(key) == 0 {
+		p := b.rr[topic] % n
+		b.rr[topic]++
+		return p
+	}
+	h := fnv.New32a()
+	_, _ = h.Write(key)
+	return int32(h.Sum32() % uint32(n))
+}
+
+// notifyLocked wakes up everyone waiting for a state change.
+func (b *Broker) notifyLocked() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// waitLocked releases the lock until the broker state changes or the timer fires.
+// It reports false if the timer fired.
+func (b *Broker) waitLocked(timer <-chan time.Time) bool {
+	changed := b.changed
+	b.mu.Unlock()
+	defer b.mu.Lock()
+
+	select {
+	case <-changed:
+		return true
+	case <-timer:
+		return false
+	}
+}
+
+func (r record) message(topic string, partition int32, offset int64) *kafkalight.Message {
+	k, _ := kafkalight.NewKey(cloneBytes(r.key))
+	return &kafkalight.Message{
+		TopicPartition: kafkalight.TopicPartition{
+			Topic:     topic,
+			Partition: partition,
+			Offset:    offset,
+		},
+		Key:       *k,
+		Value:     cloneBytes(r.value),
+		Headers:   cloneHeaders(r.headers),
+		Timestamp: r.timestamp,
+	}
+}
+
+func cloneBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte(nil), b...)
+}
+
+func cloneHeaders(headers []kafkalight.Header) []kafkalight.Header {
+	if headers == nil {
+		return nil
+	}
+	out := make([]kafkalight.Header, len(headers))
+	for i, h := range headers {
+		out[i] = kafkalight.Header{Key: h.Key, Value: cloneBytes(h.Value)}
+	}
+	return out
+}
+
+func cloneMessage(msg *kafkalight.Message) *kafkalight.Message {
+	c := *msg
+	k, _ := kafkalight.NewKey(cloneBytes(msg.Key.Bytes()))
+	c.Key = *k
+	c.Value = cloneBytes(msg.Value)
+	c.Headers = cloneHeaders(msg.Headers)
+	return &c
+}
@@ -0,0 +1,126 @@
+package kafkalighttest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/overtonx/kafkalight"
+)
+
+func TestBroker_Produce(t *testing.T) {
+	broker := NewBroker()
+	broker.CreateTopic("orders", 3)
+
+	t.Run("same key goes to the same partition", func(t *testing.T) {
+		first := NewMessage("orders", "customer-1", "a")
+		second := NewMessage("orders", "customer-1", "b")
+		broker.MustProduce(t, first, second)
+
+		assert.Equal(t, first.TopicPartition.Partition, second.TopicPartition.Partition)
+		assert.Equal(t, first.TopicPartition.Offset+1, second.TopicPartition.Offset)
+	})
+
+	t.Run("explicit partition", func(t *testing.T) {
+		msg := NewMessage("orders", "", "c")
+		msg.TopicPartition.Partition = 2
+		broker.MustProduce(t, msg)
+
+		assert.Equal(t, int32(2), msg.TopicPartition.Partition)
+	})
+
+	t.Run("partition out of range", func(t *testing.T) {
+		msg := NewMessage("orders", "", "d")
+		msg.TopicPartition.Partition = 3
+
+		assert.Error(t, broker.Produce(context.Background(), msg))
+	})
+
+	t.Run("unknown topic is created", func(t *testing.T) {
+		broker.MustProduce(t, NewMessage("events", "k", "v"))
+
+		msgs := broker.Messages("events")
+		require.Len(t, msgs, 1)
+		assert.Equal(t, "v", string(msgs[0].Value))
+		assert.Equal(t, "k", msgs[0].Key.String())
+	})
+}
+
+func TestRouter_CommitsOnlyOnSuccess(t *testing.T) {
+	broker := NewBroker()
+	broker.CreateTopic("orders", 1)
+	broker.MustProduce(t,
+		NewMessage("orders", "k1", "msg-success"),
+		NewMessage("orders", "k2", "msg-fail"),
+	)
+
+	group := broker.ConsumerGroup("group")
+	router := NewRouter(t, group)
+
+	var processed []string
+	router.RegisterRoute("orders", func(_ context.Context, msg *kafkalight.Message) error {
+		processed = append(processed, string(msg.Value))
+		if string(msg.Value) == "msg-fail" {
+			return errors.New("intentional failure")
+		}
+		return nil
+	})
+	Start(t, router)
+
+	group.WaitProcessed(t, 2)
+
+	assert.Equal(t, []string{"msg-success", "msg-fail"}, processed)
+	group.AssertCommitted(t, kafkalight.TopicPartition{Topic: "orders", Partition: 0}, 1)
+}
+
+func TestConsumer_ResumesFromCommittedOffset(t *testing.T) {
+	broker := NewBroker()
+	broker.MustProduce(t, NewMessage("orders", "", "first"), NewMessage("orders", "", "second"))
+	group := broker.ConsumerGroup("group")
+
+	first := group.Consumer()
+	require.NoError(t, first.SubscribeTopics([]string{"orders"}, nil))
+	msg, err := first.ReadMessage(0)
+	require.NoError(t, err)
+	assert.Equal(t, "first", string(msg.Value))
+	_, err = first.CommitMessage(msg)
+	require.NoError(t, err)
+	require.NoError(t, first.Close())
+	assert.Equal(t, 1, group.Processed())
+
+	second := group.Consumer()
+	require.NoError(t, second.SubscribeTopics([]string{"orders"}, nil))
+	msg, err = second.ReadMessage(0)
+	require.NoError(t, err)
+	assert.Equal(t, "second", string(msg.Value))
+
+	_, err = second.ReadMessage(0)
+	assert.Error(t, err, "no more messages")
+}
+
+func TestRecordingProducer(t *testing.T) {
+	broker := NewBroker()
+	producer := NewRecordingProducer(broker)
+
+	dlq := NewMessage("orders.dlq", "k", "payload", kafkalight.Header{Key: "error", Value: []byte("boom")})
+	require.NoError(t, producer.Produce(context.Background(), dlq))
+	require.NoError(t, producer.Produce(context.Background(), NewMessage("orders.retry", "k", "payload")))
+
+	recorded := producer.MessagesTo("orders.dlq")
+	require.Len(t, recorded, 1)
+	assert.Equal(t, "payload", string(recorded[0].Value))
+	assert.Equal(t, []kafkalight.Header{{Key: "error", Value: []byte("boom")}}, recorded[0].Headers)
+	assert.Len(t, producer.Messages(), 2)
+	assert.Len(t, broker.Messages("orders.dlq"), 1, "messages are forwarded to the broker")
+
+	expectedErr := errors.New("broker down")
+	producer.FailWith(expectedErr)
+	assert.ErrorIs(t, producer.Produce(context.Background(), NewMessage("orders.dlq", "", "")), expectedErr)
+	assert.Len(t, producer.Messages(), 2)
+
+	producer.Reset()
+	assert.Empty(t, producer.Messages())
+}
@@ -0,0 +1,500 @@
+package kafkalighttest
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+
+	"github.com/overtonx/kafkalight"
+)
+
+// ConsumerGroup holds the committed offsets of a group and tracks how many
+// messages its consumers have processed.
+type ConsumerGroup struct {
+	broker    *Broker
+	id        string
+	committed map[partitionKey]int64
+	processed int
+}
+
+// ID returns the group id.
+func (g *ConsumerGroup) ID() string {
+	return g.id
+}
+
+// Consumer returns a new member of the group. Every member is assigned all
+// partitions of the topics it subscribes to, so a group is expected to have
+// a single active consumer. Partitions without a committed offset are read
+// from the beginning.
+func (g *ConsumerGroup) Consumer() *Consumer {
+	return &Consumer{
+		group:      g,
+		positions:  make(map[partitionKey]int64),
+		watermarks: make(map[partitionKey]int64),
+		assigned:   make(map[partitionKey]bool),
+		paused:     make(map[partitionKey]bool),
+	}
+}
+
+// Committed returns the committed offset for the partition.
+func (g *ConsumerGroup) Committed(tp kafkalight.TopicPartition) (int64, bool) {
+	g.broker.mu.Lock()
+	defer g.broker.mu.Unlock()
+
+	offset, ok := g.committed[partitionKey{topic: tp.Topic, partition: tp.Partition}]
+	return offset, ok
+}
+
+// AssertCommitted reports a test error unless the committed offset for the
+// partition equals offset. tp.Offset is ignored.
+func (g *ConsumerGroup) AssertCommitted(t testing.TB, tp kafkalight.TopicPartition, offset int64) bool {
+	t.Helper()
+
+	committed, ok := g.Committed(tp)
+	if !ok {
+		t.Errorf("kafkalighttest: group %s has no committed offset for %s[%d], want %d", g.id, tp.Topic, tp.Partition, offset)
+		return false
+	}
+	if committed != offset {
+		t.Errorf("kafkalighttest: group %s committed offset for %s[%d] is %d, want %d", g.id, tp.Topic, tp.Partition, committed, offset)
+		return false
+	}
+	return true
+}
+
+// Processed returns the number of messages the group's consumers have finished processing.
+func (g *ConsumerGroup) Processed() int {
+	g.broker.mu.Lock()
+	defer g.broker.mu.Unlock()
+
+	return g.processed
+}
+
+// WaitProcessed blocks until the group's consumers have processed at least n
+// messages in total, failing the test after DefaultWaitTimeout.
+//
+// A message counts as processed once the router asks for the next one (or
+// closes the consumer), which happens after its handler and commit returned.
+func (g *ConsumerGroup) WaitProcessed(t testing.TB, n int) {
+	t.Helper()
+
+	timer := time.NewTimer(DefaultWaitTimeout)
+	defer timer.Stop()
+
+	g.broker.mu.Lock()
+	defer g.broker.mu.Unlock()
+
+	for g.processed < n {
+		if !g.broker.waitLocked(timer.C) {
+			t.Fatalf("kafkalighttest: timeout waiting for group %s to process %d messages, processed %d", g.id, n, g.processed)
+			return
+		}
+	}
+}
+
+var _ kafkalight.Consumer = &Consumer{}
+
+// Consumer is a fake group member implementing kafkalight.Consumer.
+type Consumer struct {
+	group       *ConsumerGroup
+	topics      []string
+	rebalanceCb kafka.RebalanceCb
+	assigned    map[partitionKey]bool
+	paused      map[partitionKey]bool
+	positions   map[partitionKey]int64
+	watermarks  map[partitionKey]int64
+	cursor      int
+	pending     bool
+	closed      bool
+}
+
+// SubscribeTopics subscribes the consumer to topics. The rebalance callback
+// is called with a nil *kafka.Consumer: with kafka.AssignedPartitions for the
+// partitions of the topics as they are created, and with
+// kafka.RevokedPartitions for all of them on Close.
+func (c *Consumer) SubscribeTopics(topics []string, rebalanceCb kafka.RebalanceCb) error {
+	b := c.group.broker
+	b.mu.Lock()
+	if c.closed {
+		b.mu.Unlock()
+		return kafka.NewError(kafka.ErrState, "consumer closed", true)
+	}
+	c.topics = append([]string(nil), topics...)
+	c.rebalanceCb = rebalanceCb
+	b.mu.Unlock()
+
+	c.syncAssignment()
+	return nil
+}
+
+// ReadMessage returns the next message from the assigned partitions, waiting
+// up to timeout (forever if negative) for one to be produced.
+func (c *Consumer) ReadMessage(timeout time.Duration) (*kafka.Message, error) {
+	c.syncAssignment()
+
+	b := c.group.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c.markProcessedLocked()
+
+	var timer <-chan time.Time
+	if timeout >= 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		timer = t.C
+	}
+
+	for {
+		if c.closed {
+			return nil, kafka.NewError(kafka.ErrState, "consumer closed", true)
+		}
+		if msg := c.nextLocked(); msg != nil {
+			c.pending = true
+			return msg, nil
+		}
+		if !b.waitLocked(timer) {
+			return nil, kafka.NewError(kafka.ErrTimedOut, "timed out", false)
+		}
+	}
+}
+
+// CommitMessage commits the offset following m for the group.
+func (c *Consumer) CommitMessage(m *kafka.Message) ([]kafka.TopicPartition, error) {
+	b := c.group.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if c.closed {
+		return nil, kafka.NewError(kafka.ErrState, "consumer closed", true)
+	}
+
+	tp := m.TopicPartition
+	tp.Offset = m.TopicPartition.Offset + 1
+	c.group.committed[partitionKey{topic: *tp.Topic, partition: tp.Partition}] = int64(tp.Offset)
+	b.notifyLocked()
+	return []kafka.TopicPartition{tp}, nil
+}
+
+// CommitOffsets commits the given offsets for the group.
+func (c *Consumer) CommitOffsets(offsets []kafka.TopicPartition) ([]kafka.TopicPartition, error) {
+	b := c.group.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if c.closed {
+		return nil, kafka.NewError(kafka.ErrState, "consumer closed", true)
+	}
+
+	for _, tp := range offsets {
+		c.group.committed[partitionKey{topic: *tp.Topic, partition: tp.Partition}] = int64(tp.Offset)
+	}
+	b.notifyLocked()
+	return offsets, nil
+}
+
+// Assignment returns the partitions assigned to the consumer.
+func (c *Consumer) Assignment() ([]kafka.TopicPartition, error) {
+	b := c.group.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if c.closed {
+		return nil, kafka.NewError(kafka.ErrState, "consumer closed", true)
+	}
+
+	assignment := make([]kafka.TopicPartition, 0, len(c.assigned))
+	for tp := range c.assigned {
+		assignment = append(assignment, tp.kafkaTopicPartition())
+	}
+	sortTopicPartitions(assignment)
+	return assignment, nil
+}
+
+// Committed returns the group's committed offsets for partitions, with
+// kafka.OffsetInvalid for partitions without one.
+func (c *Consumer) Committed(partitions []kafka.TopicPartition, _ int) ([]kafka.TopicPartition, error) {
+	b := c.group.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if c.closed {
+		return nil, kafka.NewError(kafka.ErrState, "consumer closed", true)
+	}
+
+	offsets := make([]kafka.TopicPartition, 0, len(partitions))
+	for _, tp := range partitions {
+		tp.Offset = kafka.OffsetInvalid
+		if offset, ok := c.group.committed[partitionKey{topic: *tp.Topic, partition: tp.Partition}]; ok {
+			tp.Offset = kafka.Offset(offset)
+		}
+		offsets = append(offsets, tp)
+	}
+	return offsets, nil
+}
+
+// Position returns the offsets of the next messages the consumer will read
+// from partitions, with kafka.OffsetInvalid for partitions it has not read yet.
+func (c *Consumer) Position(partitions []kafka.TopicPartition) ([]kafka.TopicPartition, error) {
+	b := c.group.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if c.closed {
+		return nil, kafka.NewError(kafka.ErrState, "consumer closed", true)
+	}
+
+	offsets := make([]kafka.TopicPartition, 0, len(partitions))
+	for _, tp := range partitions {
+		tp.Offset = kafka.OffsetInvalid
+		if position, ok := c.positions[partitionKey{topic: *tp.Topic, partition: tp.Partition}]; ok {
+			tp.Offset = kafka.Offset(position)
+		}
+		offsets = append(offsets, tp)
+	}
+	return offsets, nil
+}
+
+// QueryWatermarkOffsets returns 0 and the number of messages in the partition.
+func (c *Consumer) QueryWatermarkOffsets(topic string, partition int32, _ int) (low, high int64, err error) {
+	b := c.group.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	partitions := b.topics[topic]
+	if partition < 0 || int(partition) >= len(partitions) {
+		return 0, 0, kafka.NewError(kafka.ErrUnknownPartition, fmt.Sprintf("unknown partition %s[%d]", topic, partition), false)
+	}
+	return 0, int64(len(partitions[partition])), nil
+}
+
+// GetWatermarkOffsets returns 0 and the number of messages the partition had
+// when the consumer last read from it, like the watermarks librdkafka caches
+// from fetch responses. Before the first read both are kafka.OffsetInvalid.
+func (c *Consumer) GetWatermarkOffsets(topic string, partition int32) (low, high int64, err error) {
+	b := c.group.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	partitions := b.topics[topic]
+	if partition < 0 || int(partition) >= len(partitions) {
+		return 0, 0, kafka.NewError(kafka.ErrUnknownPartition, fmt.Sprintf("unknown partition %s[%d]", topic, partition), false)
+	}
+	high, ok := c.watermarks[partitionKey{topic: topic, partition: partition}]
+	if !ok {
+		return int64(kafka.OffsetInvalid), int64(kafka.OffsetInvalid), nil
+	}
+	return 0, high, nil
+}
+
+// Pause stops delivering messages from partitions until they are resumed.
+func (c *Consumer) Pause(partitions []kafka.TopicPartition) error {
+	return c.setPaused(partitions, true)
+}
+
+// Resume resumes delivering messages from paused partitions.
+func (c *Consumer) Resume(partitions []kafka.TopicPartition) error {
+	return c.setPaused(partitions, false)
+}
+
+func (c *Consumer) setPaused(partitions []kafka.TopicPartition, paused bool) error {
+	b := c.group.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if c.closed {
+		return kafka.NewError(kafka.ErrState, "consumer closed", true)
+	}
+
+	for _, tp := range partitions {
+		key := partitionKey{topic: *tp.Topic, partition: tp.Partition}
+		if paused {
+			c.paused[key] = true
+		} else {
+			delete(c.paused, key)
+		}
+	}
+	b.notifyLocked()
+	return nil
+}
+
+// OffsetsForTimes returns, for each partition, the offset of the first
+// message whose timestamp is at or after the timestamp in milliseconds given
+// as its offset, or kafka.OffsetEnd if there is none.
+func (c *Consumer) OffsetsForTimes(times []kafka.TopicPartition, _ int) ([]kafka.TopicPartition, error) {
+	b := c.group.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	offsets := make([]kafka.TopicPartition, 0, len(times))
+	for _, tp := range times {
+		partitions := b.topics[*tp.Topic]
+		if tp.Partition < 0 || int(tp.Partition) >= len(partitions) {
+			return nil, kafka.NewError(kafka.ErrUnknownPartition, fmt.Sprintf("unknown partition %s[%d]", *tp.Topic, tp.Partition), false)
+		}
+
+		ts := time.UnixMilli(int64(tp.Offset))
+		tp.Offset = kafka.OffsetEnd
+		for offset, r := range partitions[tp.Partition] {
+			if !r.timestamp.Before(ts) {
+				tp.Offset = kafka.Offset(offset)
+				break
+			}
+		}
+		offsets = append(offsets, tp)
+	}
+	return offsets, nil
+}
+
+// SeekPartitions sets the offsets of the next messages read from partitions.
+// kafka.OffsetBeginning and kafka.OffsetEnd are supported.
+func (c *Consumer) SeekPartitions(partitions []kafka.TopicPartition) ([]kafka.TopicPartition, error) {
+	b := c.group.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if c.closed {
+		return nil, kafka.NewError(kafka.ErrState, "consumer closed", true)
+	}
+
+	for _, tp := range partitions {
+		key := partitionKey{topic: *tp.Topic, partition: tp.Partition}
+		switch tp.Offset {
+		case kafka.OffsetBeginning:
+			c.positions[key] = 0
+		case kafka.OffsetEnd:
+			c.positions[key] = int64(len(b.topics[key.topic][key.partition]))
+		default:
+			c.positions[key] = int64(tp.Offset)
+		}
+	}
+	b.notifyLocked()
+	return partitions, nil
+}
+
+// Close closes the consumer. The message delivered last counts as processed.
+func (c *Consumer) Close() error {
+	b := c.group.broker
+	b.mu.Lock()
+	if c.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	c.markProcessedLocked()
+	c.closed = true
+	b.notifyLocked()
+
+	var revoked []kafka.TopicPartition
+	for tp := range c.assigned {
+		revoked = append(revoked, tp.kafkaTopicPartition())
+	}
+	clear(c.assigned)
+	sortTopicPartitions(revoked)
+	cb := c.rebalanceCb
+	b.mu.Unlock()
+
+	if cb != nil && len(revoked) > 0 {
+		_ = cb(nil, kafka.RevokedPartitions{Partitions: revoked})
+	}
+	return nil
+}
+
+// syncAssignment reports partitions created since the last call to the
+// rebalance callback. The callback is called without holding the broker lock.
+func (c *Consumer) syncAssignment() {
+	b := c.group.broker
+	b.mu.Lock()
+	var added []kafka.TopicPartition
+	for _, topic := range c.topics {
+		for p := range b.topics[topic] {
+			tp := partitionKey{topic: topic, partition: int32(p)}
+			if !c.assigned[tp] && !c.closed {
+				c.assigned[tp] = true
+				added = append(added, tp.kafkaTopicPartition())
+			}
+		}
+	}
+	cb := c.rebalanceCb
+	b.mu.Unlock()
+
+	if cb != nil && len(added) > 0 {
+		_ = cb(nil, kafka.AssignedPartitions{Partitions: added})
+	}
+}
+
+func (c *Consumer) markProcessedLocked() {
+	if !c.pending {
+		return
+	}
+	c.pending = false
+	c.group.processed++
+	c.group.broker.notifyLocked()
+}
+
+// nextLocked returns the next unread message, visiting partitions round-robin.
+func (c *Consumer) nextLocked() *kafka.Message {
+	var assigned []partitionKey
+	for _, topic := range c.topics {
+		for p := range c.group.broker.topics[topic] {
+			assigned = append(assigned, partitionKey{topic: topic, partition: int32(p)})
+		}
+	}
+
+	for i := 0; i < len(assigned); i++ {
+		tp := assigned[(c.cursor+i)%len(assigned)]
+		if c.paused[tp] {
+			continue
+		}
+		position, ok := c.positions[tp]
+		if !ok {
+			position = c.group.committed[tp]
+		}
+
+		records := c.group.broker.topics[tp.topic][tp.partition]
+		c.watermarks[tp] = int64(len(records))
+		if position >= int64(len(records)) {
+			continue
+		}
+
+		c.positions[tp] = position + 1
+		c.cursor = (c.cursor + i + 1) % len(assigned)
+		return records[position].kafkaMessage(tp.topic, tp.partition, position)
+	}
+	return nil
+}
+
+func sortTopicPartitions(tps []kafka.TopicPartition) {
+	slices.SortFunc(tps, func(a, b kafka.TopicPartition) int {
+		if c := strings.Compare(*a.Topic, *b.Topic); c != 0 {
+			return c
+		}
+		return int(a.Partition - b.Partition)
+	})
+}
+
+func (tp partitionKey) kafkaTopicPartition() kafka.TopicPartition {
+	topic := tp.topic
+	return kafka.TopicPartition{Topic: &topic, Partition: tp.partition, Offset: kafka.OffsetInvalid}
+}
+
+func (r record) kafkaMessage(topic string, partition int32, offset int64) *kafka.Message {
+	msg := &kafka.Message{
+		TopicPartition: kafka.TopicPartition{
+			Topic:     &topic,
+			Partition: partition,
+			Offset:    kafka.Offset(offset),
+		},
+		Key:           cloneBytes(r.key),
+		Value:         cloneBytes(r.value),
+		Timestamp:     r.timestamp,
+		TimestampType: kafka.TimestampCreateTime,
+	}
+	for _, h := range r.headers {
+		msg.Headers = append(msg.Headers, kafka.Header{Key: h.Key, Value: cloneBytes(h.Value)})
+	}
+	return msg
+}
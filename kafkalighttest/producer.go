@@ -0,0 +1,89 @@
+package kafkalighttest
+
+import (
+	"context"
+	"sync"
+
+	"github.com/overtonx/kafkalight"
+)
+
+var _ kafkalight.Producer = &RecordingProducer{}
+
+// RecordingProducer is a kafkalight.Producer that keeps a copy of every
+// message it is asked to produce. It is meant for asserting what a handler
+// publishes, e.g. to dead letter or retry topics.
+type RecordingProducer struct {
+	mu       sync.Mutex
+	next     kafkalight.Producer
+	err      error
+	messages []*kafkalight.Message
+}
+
+// NewRecordingProducer creates a RecordingProducer. If next is not nil,
+// recorded messages are forwarded to it, for example to a Broker so that
+// other routers can consume them.
+func NewRecordingProducer(next kafkalight.Producer) *RecordingProducer {
+	return &RecordingProducer{next: next}
+}
+
+// Produce records msg and forwards it to the next producer, if any.
+// If an error was set with FailWith, it is returned and nothing is recorded.
+func (p *RecordingProducer) Produce(ctx context.Context, msg *kafkalight.Message) error {
+	p.mu.Lock()
+	if p.err != nil {
+		err := p.err
+		p.mu.Unlock()
+		return err
+	}
+	p.mu.Unlock()
+
+	if p.next != nil {
+		if err := p.next.Produce(ctx, msg); err != nil {
+			return err
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.messages = append(p.messages, cloneMessage(msg))
+	return nil
+}
+
+// FailWith makes subsequent Produce calls return err. Pass nil to recover.
+func (p *RecordingProducer) FailWith(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.err = err
+}
+
+// Messages returns copies of all recorded messages in produce order.
+func (p *RecordingProducer) Messages() []*kafkalight.Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	msgs := make([]*kafkalight.Message, len(p.messages))
+	for i, msg := range p.messages {
+		msgs[i] = cloneMessage(msg)
+	}
+	return msgs
+}
+
+// MessagesTo returns copies of the recorded messages produced to topic.
+func (p *RecordingProducer) MessagesTo(topic string) []*kafkalight.Message {
+	var msgs []*kafkalight.Message
+	for _, msg := range p.Messages() {
+		if msg.TopicPartition.Topic == topic {
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs
+}
+
+// Reset forgets all recorded messages.
+func (p *RecordingProducer) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.messages = nil
+}
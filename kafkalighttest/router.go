@@ -0,0 +1,65 @@
+package kafkalighttest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+
+	"github.com/overtonx/kafkalight"
+)
+
+const defaultReadTimeout = 50 * time.Millisecond
+
+// NewRouter creates a KafkaRouter that consumes from a new member of group
+// with enable.auto.commit disabled, so commits made by the router can be
+// checked with ConsumerGroup.AssertCommitted. opts are applied last and may
+// override these defaults.
+func NewRouter(t testing.TB, group *ConsumerGroup, opts ...kafkalight.Option) *kafkalight.KafkaRouter {
+	t.Helper()
+
+	cfg := &kafka.ConfigMap{
+		"group.id":           group.ID(),
+		"enable.auto.commit": false,
+	}
+	defaults := []kafkalight.Option{
+		kafkalight.WithConsumer(group.Consumer()),
+		kafkalight.WithConsumerConfig(cfg),
+		kafkalight.WithReadTimeout(defaultReadTimeout),
+	}
+
+	router, err := kafkalight.NewRouter(append(defaults, opts...)...)
+	if err != nil {
+		t.Fatalf("kafkalighttest: new router: %v", err)
+	}
+	return router
+}
+
+// Start runs router.StartListening in the background and stops the router
+// when the test finishes.
+func Start(t testing.TB, router *kafkalight.KafkaRouter) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = router.StartListening(ctx)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(DefaultWaitTimeout):
+			t.Errorf("kafkalighttest: timeout waiting for router to stop listening")
+		}
+
+		closeCtx, closeCancel := context.WithTimeout(context.Background(), DefaultWaitTimeout)
+		defer closeCancel()
+		if err := router.Close(closeCtx); err != nil {
+			t.Errorf("kafkalighttest: close router: %v", err)
+		}
+	})
+}
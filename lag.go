@@ -0,0 +1,309 @@
+package kafkalight
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// lagQueryTimeout bounds each broker query made by the lag monitor. Close
+// waits for the monitor to stop, and the monitor checks for shutdown between
+// queries, so this also bounds how long a running check delays Close.
+const lagQueryTimeout = time.Second
+
+// errLagStopped is returned by measureLag when the router is closed between
+// two broker queries.
+var errLagStopped = errors.New("lag check stopped")
+
+// PartitionLag is the lag of an assigned partition. Offsets that are not
+// known, e.g. a partition without a committed offset, are -1.
+type PartitionLag struct {
+	Topic     string
+	Partition int32
+	// Committed is the committed offset of the consumer group.
+	Committed int64
+	// Position is the offset of the next message the router will read.
+	Position int64
+	// HighWatermark is the offset of the next message produced to the partition.
+	HighWatermark int64
+	// Lag is the number of messages between the committed offset (or the
+	// position, or the low watermark if neither is known) and the high watermark.
+	Lag int64
+}
+
+// LagOption configures the lag monitor enabled with WithLagMonitor.
+type LagOption func(*lagMonitor)
+
+// WithLagThreshold sets the lag threshold of topic. A threshold of 0 disables
+// threshold callbacks for the topic.
+func WithLagThreshold(topic string, threshold int64) LagOption {
+	return func(m *lagMonitor) {
+		m.thresholds[topic] = threshold
+	}
+}
+
+// WithDefaultLagThreshold sets the lag threshold of topics without their own.
+func WithDefaultLagThreshold(threshold int64) LagOption {
+	return func(m *lagMonitor) {
+		m.defaultThreshold = threshold
+	}
+}
+
+// OnLagThreshold registers a callback called when the lag of a partition
+// rises above its topic threshold (exceeded is true) and when it falls back
+// to or below it (exceeded is false).
+func OnLagThreshold(fn func(lag PartitionLag, exceeded bool)) LagOption {
+	return func(m *lagMonitor) {
+		m.onThreshold = append(m.onThreshold, fn)
+	}
+}
+
+// OnLag registers a callback called with the lag of all assigned partitions
+// after every check, e.g. to export it as metrics.
+func OnLag(fn func(lags []PartitionLag)) LagOption {
+	return func(m *lagMonitor) {
+		m.onLag = append(m.onLag, fn)
+	}
+}
+
+// WithLagMonitor makes the router compare the committed offsets and positions
+// of its assigned partitions with their high watermarks every interval while
+// it is listening. The result is available from KafkaRouter.Lag and the
+// OnLag and OnLagThreshold callbacks.
+func WithLagMonitor(interval time.Duration, opts ...LagOption) Option {
+	return func(r *KafkaRouter) {
+		m := &lagMonitor{
+			interval:   interval,
+			thresholds: make(map[string]int64),
+			exceeded:   make(map[partitionKey]bool),
+		}
+		for _, opt := range opts {
+			opt(m)
+		}
+		r.lag = m
+	}
+}
+
+type lagMonitor struct {
+	interval         time.Duration
+	thresholds       map[string]int64
+	defaultThreshold int64
+	onThreshold      []func(PartitionLag, bool)
+	onLag            []func([]PartitionLag)
+	done             chan struct{}
+
+	mu       sync.RWMutex
+	lags     []PartitionLag
+	exceeded map[partitionKey]bool
+}
+
+// Lag returns the lag of the assigned partitions measured by the last check
+// of the lag monitor, ordered by topic and partition. It returns nil if the
+// monitor is not enabled or has not run yet.
+func (r *KafkaRouter) Lag() []PartitionLag {
+	if r.lag == nil {
+		return nil
+	}
+
+	r.lag.mu.RLock()
+	defer r.lag.mu.RUnlock()
+	return slices.Clone(r.lag.lags)
+}
+
+// startLagMonitor runs the lag monitor until ctx is done or the router is
+// closed. It must be called with r.mu held.
+func (r *KafkaRouter) startLagMonitor(ctx context.Context) {
+	if r.lag == nil {
+		return
+	}
+
+	done := make(chan struct{})
+	r.lag.done = done
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(r.lag.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-r.doneCh:
+				return
+			case <-ticker.C:
+				r.checkLag(r.doneCh)
+			}
+		}
+	}()
+}
+
+// waitLagMonitor waits for the lag monitor to stop after r.doneCh is closed.
+// It does not give up when the Close context expires: the monitor uses the
+// consumer, which must not be closed while a broker query is running.
+func (r *KafkaRouter) waitLagMonitor() {
+	if r.lag == nil || r.lag.done == nil {
+		return
+	}
+	<-r.lag.done
+}
+
+func (r *KafkaRouter) checkLag(stop <-chan struct{}) {
+	lags, err := r.measureLag(stop)
+	if errors.Is(err, errLagStopped) {
+		return
+	}
+	if err != nil {
+		r.errorHandler(fmt.Errorf("lag monitor: %w", err))
+		return
+	}
+	r.lag.update(lags)
+}
+
+// measureLag queries the lag of the assigned partitions. It returns
+// errLagStopped as soon as stop is closed between two broker queries; a nil
+// stop never stops it.
+func (r *KafkaRouter) measureLag(stop <-chan struct{}) ([]PartitionLag, error) {
+	stopped := func() bool {
+		select {
+		case <-stop:
+			return true
+		default:
+			return false
+		}
+	}
+
+	assignment, err := r.consumer.Assignment()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get assignment: %w", err)
+	}
+	if len(assignment) == 0 {
+		return []PartitionLag{}, nil
+	}
+
+	timeoutMs := int(lagQueryTimeout.Milliseconds())
+	if stopped() {
+		return nil, errLagStopped
+	}
+	committed, err := r.consumer.Committed(assignment, timeoutMs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get committed offsets: %w", err)
+	}
+	if stopped() {
+		return nil, errLagStopped
+	}
+	positions, err := r.consumer.Position(assignment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get positions: %w", err)
+	}
+	committedOffsets := offsetsByPartition(committed)
+	positionOffsets := offsetsByPartition(positions)
+
+	lags := make([]PartitionLag, 0, len(assignment))
+	for _, tp := range assignment {
+		if stopped() {
+			return nil, errLagStopped
+		}
+		// The watermarks cached from fetch responses are enough for assigned
+		// partitions; the broker is only asked before the first fetch.
+		low, high, err := r.consumer.GetWatermarkOffsets(*tp.Topic, tp.Partition)
+		if err != nil || low < 0 || high < 0 {
+			low, high, err = r.consumer.QueryWatermarkOffsets(*tp.Topic, tp.Partition, timeoutMs)
+			if err != nil {
+				return nil, fmt.Errorf("failed to query watermarks of %s[%d]: %w", *tp.Topic, tp.Partition, err)
+			}
+		}
+
+		key := partitionKey{topic: *tp.Topic, partition: tp.Partition}
+		lag := PartitionLag{
+			Topic:         key.topic,
+			Partition:     key.partition,
+			Committed:     knownOffset(committedOffsets[key]),
+			Position:      knownOffset(positionOffsets[key]),
+			HighWatermark: high,
+		}
+
+		from := low
+		switch {
+		case lag.Committed >= 0:
+			from = lag.Committed
+		case lag.Position >= 0:
+			from = lag.Position
+		}
+		lag.Lag = max(high-from, 0)
+		lags = append(lags, lag)
+	}
+
+	slices.SortFunc(lags, func(a, b PartitionLag) int {
+		return cmp.Or(cmp.Compare(a.Topic, b.Topic), cmp.Compare(a.Partition, b.Partition))
+	})
+	return lags, nil
+}
+
+func (m *lagMonitor) update(lags []PartitionLag) {
+	type crossing struct {
+		lag      PartitionLag
+		exceeded bool
+	}
+	var crossings []crossing
+
+	m.mu.Lock()
+	m.lags = lags
+	seen := make(map[partitionKey]bool, len(lags))
+	for _, lag := range lags {
+		key := partitionKey{topic: lag.Topic, partition: lag.Partition}
+		seen[key] = true
+
+		threshold, ok := m.thresholds[lag.Topic]
+		if !ok {
+			threshold = m.defaultThreshold
+		}
+		if threshold <= 0 {
+			continue
+		}
+
+		exceeded := lag.Lag > threshold
+		if exceeded != m.exceeded[key] {
+			crossings = append(crossings, crossing{lag: lag, exceeded: exceeded})
+		}
+		m.exceeded[key] = exceeded
+	}
+	for key := range m.exceeded {
+		if !seen[key] {
+			delete(m.exceeded, key)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, fn := range m.onLag {
+		fn(slices.Clone(lags))
+	}
+	for _, c := range crossings {
+		for _, fn := range m.onThreshold {
+			fn(c.lag, c.exceeded)
+		}
+	}
+}
+
+func offsetsByPartition(tps []kafka.TopicPartition) map[partitionKey]kafka.Offset {
+	offsets := make(map[partitionKey]kafka.Offset, len(tps))
+	for _, tp := range tps {
+		if tp.Topic != nil {
+			offsets[partitionKey{topic: *tp.Topic, partition: tp.Partition}] = tp.Offset
+		}
+	}
+	return offsets
+}
+
+// knownOffset returns offset, or -1 for logical offsets such as OffsetInvalid.
+func knownOffset(offset kafka.Offset) int64 {
+	if offset < 0 {
+		return -1
+	}
+	return int64(offset)
+}
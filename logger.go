@@ -0,0 +1,192 @@
+package kafkalight
+
+import (
+	"context"
+	"slices"
+
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/overtonx/kafkalight/redact"
+)
+
+type loggerKey struct{}
+
+type redactionKey struct{}
+
+// MessageField is a field of the message logged by LoggerFromContext.
+type MessageField string
+
+const (
+	FieldTopic     MessageField = "topic"
+	FieldPartition MessageField = "partition"
+	FieldOffset    MessageField = "offset"
+	FieldKey       MessageField = "key"
+)
+
+// loggerScope is the logger stored in a context along with the message and
+// the baggage members to log. Their fields are only added to the logger when
+// LoggerFromContext is called, so messages whose handlers do not log cost
+// nothing.
+type loggerScope struct {
+	logger  *zap.Logger
+	msg     *Message
+	fields  []MessageField // nil logs all fields
+	baggage []string
+}
+
+// ContextWithLogger returns a copy of ctx carrying logger, which
+// LoggerFromContext returns enriched with the message, trace and baggage of
+// the context. The message and the baggage members configured with
+// WithLogBaggage are kept, so logger should not carry message fields itself.
+func ContextWithLogger(ctx context.Context, logger *zap.Logger) context.Context {
+	scope := scopeFromContext(ctx)
+	scope.logger = logger
+	return context.WithValue(ctx, loggerKey{}, scope)
+}
+
+// ContextWithMessage returns a copy of ctx whose logger logs the fields of
+// msg, see RedactedMessageFields. The router does this for every message it
+// dispatches.
+func ContextWithMessage(ctx context.Context, msg *Message) context.Context {
+	scope := scopeFromContext(ctx)
+	scope.msg = msg
+	return context.WithValue(ctx, loggerKey{}, scope)
+}
+
+// ContextWithMessageFields returns a copy of ctx whose logger logs only the
+// given fields of the message, or none if no fields are given.
+func ContextWithMessageFields(ctx context.Context, fields ...MessageField) context.Context {
+	scope := scopeFromContext(ctx)
+	scope.fields = append([]MessageField{}, fields...)
+	return context.WithValue(ctx, loggerKey{}, scope)
+}
+
+// scopeFromContext returns the logger scope of ctx, with zap.L() as the
+// logger if ctx has none.
+func scopeFromContext(ctx context.Context) loggerScope {
+	scope, ok := ctx.Value(loggerKey{}).(loggerScope)
+	if !ok {
+		scope.logger = zap.L()
+	}
+	return scope
+}
+
+// LoggerFromContext returns the logger of ctx. In handlers called by the
+// router it is the router logger with the topic, partition, offset and key of
+// the message, the key redacted by the policy of ctx. These fields, the
+// trace_id and span_id of the span in ctx and the baggage members configured
+// with WithLogBaggage are added on every call, so spans started by
+// middlewares such as middleware.Tracing are reflected. Without a logger in
+// ctx it returns zap.L() with the same fields.
+func LoggerFromContext(ctx context.Context) *zap.Logger {
+	scope := scopeFromContext(ctx)
+
+	var fields []zap.Field
+	if scope.msg != nil {
+		fields = messageFields(scope.msg, RedactionFromContext(ctx), scope.fields)
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		fields = append(fields,
+			zap.String("trace_id", sc.TraceID().String()),
+			zap.String("span_id", sc.SpanID().String()),
+		)
+	}
+	if len(scope.baggage) > 0 {
+		bag := baggage.FromContext(ctx)
+		for _, key := range scope.baggage {
+			if member := bag.Member(key); member.Key() != "" {
+				fields = append(fields, zap.String(key, member.Value()))
+			}
+		}
+	}
+	if len(fields) == 0 {
+		return scope.logger
+	}
+	return scope.logger.With(fields...)
+}
+
+// MessageFields returns the log fields identifying msg: topic, partition,
+// offset and, if present, key.
+func MessageFields(msg *Message) []zap.Field {
+	return RedactedMessageFields(msg, nil)
+}
+
+// RedactedMessageFields is like MessageFields with the key redacted by policy.
+func RedactedMessageFields(msg *Message, policy *redact.Policy) []zap.Field {
+	return messageFields(msg, policy, nil)
+}
+
+// messageFields returns the log fields of msg selected by only, or all of
+// them if only is nil.
+func messageFields(msg *Message, policy *redact.Policy, only []MessageField) []zap.Field {
+	selected := func(field MessageField) bool {
+		return only == nil || slices.Contains(only, field)
+	}
+
+	fields := make([]zap.Field, 0, 4)
+	if selected(FieldTopic) {
+		fields = append(fields, zap.String(string(FieldTopic), msg.TopicPartition.Topic))
+	}
+	if selected(FieldPartition) {
+		fields = append(fields, zap.Int32(string(FieldPartition), msg.TopicPartition.Partition))
+	}
+	if selected(FieldOffset) {
+		fields = append(fields, zap.Int64(string(FieldOffset), msg.TopicPartition.Offset))
+	}
+	if selected(FieldKey) && msg.Key.Exists() {
+		if key, ok := policy.Key(msg.Key.Bytes()); ok {
+			fields = append(fields, zap.ByteString(string(FieldKey), key))
+		}
+	}
+	return fields
+}
+
+// WithLogBaggage makes LoggerFromContext log the given OpenTelemetry baggage
+// members, such as tenant or request IDs. The router extracts the baggage
+// from the W3C baggage header of each message.
+func WithLogBaggage(members ...string) Option {
+	return func(r *KafkaRouter) {
+		r.logBaggage = append(r.logBaggage, members...)
+	}
+}
+
+// WithRedaction sets the redaction policy of the router. The router puts it
+// into the handler context, where LoggerFromContext and the middlewares of
+// this module that log or record message data pick it up, see
+// RedactionFromContext.
+func WithRedaction(policy *redact.Policy) Option {
+	return func(r *KafkaRouter) {
+		r.redaction = policy
+	}
+}
+
+// ContextWithRedaction returns a copy of ctx carrying policy.
+func ContextWithRedaction(ctx context.Context, policy *redact.Policy) context.Context {
+	return context.WithValue(ctx, redactionKey{}, policy)
+}
+
+// RedactionFromContext returns the redaction policy of ctx, or nil, which
+// redacts nothing, if there is none.
+func RedactionFromContext(ctx context.Context) *redact.Policy {
+	policy, _ := ctx.Value(redactionKey{}).(*redact.Policy)
+	return policy
+}
+
+// messageContext seeds ctx with the message logger, the redaction policy
+// and, if baggage members are logged, the baggage of msg.
+func (r *KafkaRouter) messageContext(ctx context.Context, msg *Message) context.Context {
+	if r.redaction != nil {
+		ctx = ContextWithRedaction(ctx, r.redaction)
+	}
+	if len(r.logBaggage) > 0 {
+		ctx = propagation.Baggage{}.Extract(ctx, NewMessageCarrier(msg))
+	}
+	return context.WithValue(ctx, loggerKey{}, loggerScope{
+		logger:  r.logger,
+		msg:     msg,
+		baggage: r.logBaggage,
+	})
+}
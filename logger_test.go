@@ -0,0 +1,97 @@
+package kafkalight_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/overtonx/kafkalight"
+	"github.com/overtonx/kafkalight/kafkalighttest"
+	"github.com/overtonx/kafkalight/redact"
+)
+
+func TestLoggerFromContext(t *testing.T) {
+	core, recorded := observer.New(zap.InfoLevel)
+	router := kafkalighttest.NewRouter(t, kafkalighttest.NewBroker().ConsumerGroup("group"),
+		kafkalight.WithLogger(zap.New(core)),
+		kafkalight.WithLogBaggage("tenant", "missing"),
+	)
+
+	tracer := sdktrace.NewTracerProvider().Tracer("test")
+	router.RegisterRoute("orders", func(ctx context.Context, msg *kafkalight.Message) error {
+		kafkalight.LoggerFromContext(ctx).Info("before span")
+		ctx, span := tracer.Start(ctx, "handle")
+		defer span.End()
+		kafkalight.LoggerFromContext(ctx).Info("in span")
+		return nil
+	})
+
+	member, err := baggage.NewMember("tenant", "acme")
+	require.NoError(t, err)
+	bag, err := baggage.New(member)
+	require.NoError(t, err)
+	msg := kafkalighttest.NewMessage("orders", "customer-1", "{}")
+	msg.TopicPartition.Offset = 42
+	propagation.Baggage{}.Inject(baggage.ContextWithBaggage(context.Background(), bag), kafkalight.NewMessageCarrier(msg))
+
+	require.NoError(t, router.Dispatch(context.Background(), msg))
+
+	logs := recorded.TakeAll()
+	require.Len(t, logs, 2)
+	fields := logs[0].ContextMap()
+	assert.Equal(t, "orders", fields["topic"])
+	assert.Equal(t, int64(42), fields["offset"])
+	assert.Equal(t, "customer-1", fields["key"])
+	assert.Equal(t, "acme", fields["tenant"])
+	assert.NotContains(t, fields, "missing")
+	assert.NotContains(t, fields, "trace_id")
+
+	fields = logs[1].ContextMap()
+	assert.Len(t, fields["trace_id"], 32)
+	assert.Len(t, fields["span_id"], 16)
+	assert.Equal(t, "acme", fields["tenant"])
+
+	assert.Same(t, zap.L(), kafkalight.LoggerFromContext(context.Background()))
+}
+
+func TestLoggerFromContext_Redaction(t *testing.T) {
+	core, recorded := observer.New(zap.InfoLevel)
+	router := kafkalighttest.NewRouter(t, kafkalighttest.NewBroker().ConsumerGroup("group"),
+		kafkalight.WithLogger(zap.New(core)),
+		kafkalight.WithRedaction(redact.New(redact.MessageKey(redact.Drop))),
+	)
+	router.RegisterRoute("orders", func(ctx context.Context, _ *kafkalight.Message) error {
+		kafkalight.LoggerFromContext(ctx).Info("handling")
+		return nil
+	})
+
+	require.NoError(t, router.Dispatch(context.Background(), kafkalighttest.NewMessage("orders", "customer-1", "{}")))
+
+	logs := recorded.TakeAll()
+	require.Len(t, logs, 1)
+	assert.Equal(t, "orders", logs[0].ContextMap()["topic"])
+	assert.NotContains(t, logs[0].ContextMap(), "key")
+}
+
+func TestContextWithLogger_KeepsMessage(t *testing.T) {
+	core, recorded := observer.New(zap.InfoLevel)
+	msg := kafkalighttest.NewMessage("orders", "customer-1", "{}")
+	ctx := kafkalight.ContextWithMessage(context.Background(), msg)
+	ctx = kafkalight.ContextWithLogger(ctx, zap.New(core))
+
+	kafkalight.LoggerFromContext(ctx).Info("handling")
+	kafkalight.LoggerFromContext(kafkalight.ContextWithRedaction(ctx, redact.New(redact.MessageKey(redact.Drop)))).Info("redacted")
+
+	logs := recorded.TakeAll()
+	require.Len(t, logs, 2)
+	assert.Equal(t, "orders", logs[0].ContextMap()["topic"])
+	assert.Equal(t, "customer-1", logs[0].ContextMap()["key"])
+	assert.NotContains(t, logs[1].ContextMap(), "key", "the message fields are redacted when logged")
+}
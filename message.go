@@ -1,9 +1,10 @@
 package kafkalight
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
@@ -34,6 +35,9 @@ type Message struct {
 	Timestamp      time.Time
 	TimestampType  TimestampType
 	Headers        []Header
+
+	// codec is the default codec of the route the message was dispatched to.
+	codec Codec
 }
 
 type Key struct {
@@ -62,8 +66,100 @@ func (k *Key) Exists() bool {
 	return string(k.data) != ""
 }
 
+// Header returns the value of the first header with the given key.
+func (m *Message) Header(key string) ([]byte, bool) {
+	for _, h := range m.Headers {
+		if h.Key == key {
+			return h.Value, true
+		}
+	}
+	return nil, false
+}
+
+// SetHeader sets the header key to value, replacing any existing headers with that key.
+func (m *Message) SetHeader(key string, value []byte) {
+	headers := m.Headers[:0]
+	replaced := false
+	for _, h := range m.Headers {
+		if h.Key != key {
+			headers = append(headers, h)
+			continue
+		}
+		if !replaced {
+			headers = append(headers, Header{Key: key, Value: value})
+			replaced = true
+		}
+	}
+	if !replaced {
+		headers = append(headers, Header{Key: key, Value: value})
+	}
+	m.Headers = headers
+}
+
+// DelHeader removes all headers with any of the given keys.
+func (m *Message) DelHeader(keys ...string) {
+	headers := m.Headers[:0]
+	for _, h := range m.Headers {
+		if !slices.Contains(keys, h.Key) {
+			headers = append(headers, h)
+		}
+	}
+	m.Headers = headers
+}
+
+// Codec returns the codec for the message payload: the codec registered in
+// DefaultCodecs for the content-type header, or else JSONCodec for JSON media
+// types such as application/cloudevents+json, or else the default codec of
+// the route (see WithDefaultCodec), or else JSONCodec. Unregistered content
+// types set by other producers therefore decode as they did before codecs
+// were selected by header.
+func (m *Message) Codec() Codec {
+	if contentType, ok := m.Header(HeaderContentType); ok {
+		if codec, found := DefaultCodecs.Lookup(string(contentType)); found {
+			return codec
+		}
+		if IsJSONContentType(string(contentType)) {
+			return JSONCodec{}
+		}
+	}
+	if m.codec != nil {
+		return m.codec
+	}
+	return JSONCodec{}
+}
+
+// Bind decodes the message value into v using the codec returned by Codec.
 func (m *Message) Bind(v interface{}) error {
-	return json.Unmarshal(m.Value, v)
+	return m.BindContext(context.Background(), v)
+}
+
+// BindContext is like Bind, but passes ctx to codecs implementing
+// ContextCodec. Use it in handlers so the handler context bounds decoding.
+func (m *Message) BindContext(ctx context.Context, v any) error {
+	return unmarshalContext(ctx, m.Codec(), m.Value, v)
+}
+
+// Encode sets the message value to v encoded with the codec registered in
+// DefaultCodecs for contentType, and sets the content-type header accordingly.
+func (m *Message) Encode(v any, contentType string) error {
+	return m.EncodeContext(context.Background(), v, contentType)
+}
+
+// EncodeContext is like Encode, but passes ctx to codecs implementing
+// ContextCodec.
+func (m *Message) EncodeContext(ctx context.Context, v any, contentType string) error {
+	codec, ok := DefaultCodecs.Lookup(contentType)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownContentType, contentType)
+	}
+
+	data, err := marshalContext(ctx, codec, v)
+	if err != nil {
+		return err
+	}
+	m.Value = data
+	m.SetHeader(HeaderContentType, []byte(codec.ContentType()))
+	return nil
 }
 
 func convertKafkaMessageToStruct(kafkaMsg *kafka.Message) (*Message, error) {
@@ -94,3 +190,28 @@ func convertKafkaMessageToStruct(kafkaMsg *kafka.Message) (*Message, error) {
 
 	return msg, nil
 }
+
+func convertStructToKafkaMessage(msg *Message) *kafka.Message {
+	topic := msg.TopicPartition.Topic
+	kafkaMsg := &kafka.Message{
+		TopicPartition: kafka.TopicPartition{
+			Topic:     &topic,
+			Partition: msg.TopicPartition.Partition,
+		},
+		Value:     msg.Value,
+		Timestamp: msg.Timestamp,
+	}
+
+	if msg.Key.Exists() {
+		kafkaMsg.Key = msg.Key.Bytes()
+	}
+
+	for _, header := range msg.Headers {
+		kafkaMsg.Headers = append(kafkaMsg.Headers, kafka.Header{
+			Key:   header.Key,
+			Value: header.Value,
+		})
+	}
+
+	return kafkaMsg
+}
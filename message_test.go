@@ -59,6 +59,98 @@ func TestMessage_Bind(t *testing.T) {
 		err := msg.Bind(&v)
 		assert.Error(t, err)
 	})
+
+	t.Run("codec from content-type header", func(t *testing.T) {
+		var v test
+		msg := &Message{codec: JSONCodec{}}
+		assert.NoError(t, msg.Encode(test{Foo: "bar"}, ContentTypeMsgPack))
+
+		err := msg.Bind(&v)
+		assert.NoError(t, err)
+		assert.Equal(t, "bar", v.Foo)
+	})
+
+	t.Run("route default codec", func(t *testing.T) {
+		var v string
+		msg := &Message{Value: []byte("plain text"), codec: RawCodec{}}
+		err := msg.Bind(&v)
+		assert.NoError(t, err)
+		assert.Equal(t, "plain text", v)
+	})
+
+	t.Run("unknown content type falls back to JSON", func(t *testing.T) {
+		var v test
+		msg := &Message{
+			Value:   []byte(`{"foo":"bar"}`),
+			Headers: []Header{{Key: HeaderContentType, Value: []byte("text/plain")}},
+		}
+		err := msg.Bind(&v)
+		assert.NoError(t, err)
+		assert.Equal(t, "bar", v.Foo)
+	})
+
+	t.Run("+json content type", func(t *testing.T) {
+		var v test
+		msg := &Message{
+			Value:   []byte(`{"foo":"bar"}`),
+			Headers: []Header{{Key: HeaderContentType, Value: []byte("application/vnd.acme.order+json; version=2")}},
+			codec:   RawCodec{},
+		}
+		assert.Equal(t, JSONCodec{}, msg.Codec(), "JSON media types take precedence over the route default codec")
+		assert.NoError(t, msg.Bind(&v))
+		assert.Equal(t, "bar", v.Foo)
+	})
+
+	t.Run("unknown content type uses the route default codec", func(t *testing.T) {
+		var v string
+		msg := &Message{
+			Value:   []byte("a,b"),
+			Headers: []Header{{Key: HeaderContentType, Value: []byte("text/csv")}},
+			codec:   RawCodec{},
+		}
+		assert.NoError(t, msg.Bind(&v))
+		assert.Equal(t, "a,b", v)
+	})
+}
+
+func TestMessage_Encode(t *testing.T) {
+	msg := &Message{}
+
+	assert.NoError(t, msg.Encode(map[string]string{"foo": "bar"}, ContentTypeJSON))
+	assert.JSONEq(t, `{"foo":"bar"}`, string(msg.Value))
+	contentType, _ := msg.Header(HeaderContentType)
+	assert.Equal(t, ContentTypeJSON, string(contentType))
+
+	assert.NoError(t, msg.Encode("raw", ContentTypeRaw))
+	assert.Equal(t, "raw", string(msg.Value))
+	assert.Len(t, msg.Headers, 1, "content-type header is replaced")
+
+	assert.ErrorIs(t, msg.Encode("x", "text/csv"), ErrUnknownContentType)
+}
+
+func TestMessage_Headers(t *testing.T) {
+	msg := &Message{Headers: []Header{
+		{Key: "a", Value: []byte("1")},
+		{Key: "b", Value: []byte("2")},
+		{Key: "a", Value: []byte("3")},
+	}}
+
+	value, ok := msg.Header("a")
+	assert.True(t, ok)
+	assert.Equal(t, "1", string(value))
+
+	_, ok = msg.Header("c")
+	assert.False(t, ok)
+
+	msg.SetHeader("a", []byte("4"))
+	assert.Equal(t, []Header{{Key: "a", Value: []byte("4")}, {Key: "b", Value: []byte("2")}}, msg.Headers)
+
+	msg.SetHeader("c", []byte("5"))
+	assert.Equal(t, Header{Key: "c", Value: []byte("5")}, msg.Headers[2])
+
+	msg.Headers = append(msg.Headers, Header{Key: "a", Value: []byte("6")})
+	msg.DelHeader("a", "c", "missing")
+	assert.Equal(t, []Header{{Key: "b", Value: []byte("2")}}, msg.Headers)
 }
 
 func TestConvertKafkaMessageToStruct(t *testing.T) {
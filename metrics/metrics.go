@@ -0,0 +1,253 @@
+// Package metrics exposes Prometheus metrics for kafkalight routers. A
+// Metrics value is a prometheus.Collector that is fed by a message
+// middleware and by router hooks:
+//
+//	m := metrics.New()
+//	prometheus.MustRegister(m)
+//
+//	router, err := kafkalight.NewRouter(
+//		kafkalight.WithHooks(m.Hooks()),
+//		kafkalight.WithLagMonitor(30*time.Second, kafkalight.OnLag(m.ObserveLag)),
+//	)
+//	router.Use(m.Middleware())
+package metrics
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/overtonx/kafkalight"
+)
+
+// Status label values of the processed messages counter.
+const (
+	StatusSuccess        = "success"
+	StatusError          = "error"
+	StatusPermanentError = "permanent_error"
+)
+
+// Status label values of the commits counter.
+const (
+	CommitSuccess = "success"
+	CommitFailure = "failure"
+)
+
+type config struct {
+	namespace   string
+	constLabels prometheus.Labels
+	buckets     []float64
+}
+
+// Option configures Metrics.
+type Option func(*config)
+
+// WithNamespace sets the metric namespace, "kafkalight" by default.
+func WithNamespace(namespace string) Option {
+	return func(c *config) {
+		c.namespace = namespace
+	}
+}
+
+// WithConstLabels adds constant labels, e.g. the consumer group, to all metrics.
+func WithConstLabels(labels prometheus.Labels) Option {
+	return func(c *config) {
+		c.constLabels = labels
+	}
+}
+
+// WithBuckets sets the buckets of the handler duration histogram in seconds.
+// The default is prometheus.DefBuckets.
+func WithBuckets(buckets []float64) Option {
+	return func(c *config) {
+		c.buckets = buckets
+	}
+}
+
+// Metrics collects kafkalight metrics.
+type Metrics struct {
+	processed   *prometheus.CounterVec
+	duration    *prometheus.HistogramVec
+	inFlight    *prometheus.GaugeVec
+	commits     *prometheus.CounterVec
+	pollErrors  prometheus.Counter
+	rebalances  *prometheus.CounterVec
+	assignedVec *prometheus.GaugeVec
+	lag         *prometheus.GaugeVec
+
+	mu       sync.Mutex
+	assigned map[string]map[int32]struct{}
+}
+
+var _ prometheus.Collector = &Metrics{}
+
+// New creates Metrics. Register it with a prometheus.Registerer to export it.
+func New(opts ...Option) *Metrics {
+	cfg := &config{namespace: "kafkalight", buckets: prometheus.DefBuckets}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return &Metrics{
+		processed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   cfg.namespace,
+			Name:        "messages_processed_total",
+			Help:        "Messages processed by handlers, by topic and status.",
+			ConstLabels: cfg.constLabels,
+		}, []string{"topic", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   cfg.namespace,
+			Name:        "handler_duration_seconds",
+			Help:        "Duration of message handlers, by topic.",
+			ConstLabels: cfg.constLabels,
+			Buckets:     cfg.buckets,
+		}, []string{"topic"}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   cfg.namespace,
+			Name:        "handlers_in_flight",
+			Help:        "Messages currently being handled, by topic.",
+			ConstLabels: cfg.constLabels,
+		}, []string{"topic"}),
+		commits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   cfg.namespace,
+			Name:        "commits_total",
+			Help:        "Offset commits made by the router, by status.",
+			ConstLabels: cfg.constLabels,
+		}, []string{"status"}),
+		pollErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   cfg.namespace,
+			Name:        "poll_errors_total",
+			Help:        "Errors reading messages from the consumer, excluding timeouts.",
+			ConstLabels: cfg.constLabels,
+		}),
+		rebalances: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   cfg.namespace,
+			Name:        "rebalances_total",
+			Help:        "Partition assignment changes, by type (assigned or revoked).",
+			ConstLabels: cfg.constLabels,
+		}, []string{"type"}),
+		assignedVec: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   cfg.namespace,
+			Name:        "assigned_partitions",
+			Help:        "Partitions currently assigned to the router, by topic.",
+			ConstLabels: cfg.constLabels,
+		}, []string{"topic"}),
+		lag: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   cfg.namespace,
+			Name:        "consumer_lag",
+			Help:        "Messages between the committed offset and the high watermark, by topic and partition.",
+			ConstLabels: cfg.constLabels,
+		}, []string{"topic", "partition"}),
+		assigned: make(map[string]map[int32]struct{}),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range m.collectors() {
+		c.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range m.collectors() {
+		c.Collect(ch)
+	}
+}
+
+func (m *Metrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.processed, m.duration, m.inFlight, m.commits, m.pollErrors, m.rebalances, m.assignedVec, m.lag,
+	}
+}
+
+// Middleware returns a middleware that counts processed messages by status,
+// observes handler durations and tracks handlers in flight.
+func (m *Metrics) Middleware() kafkalight.Middleware {
+	return func(next kafkalight.MessageHandler) kafkalight.MessageHandler {
+		return func(ctx context.Context, msg *kafkalight.Message) error {
+			topic := msg.TopicPartition.Topic
+			inFlight := m.inFlight.WithLabelValues(topic)
+			inFlight.Inc()
+			defer inFlight.Dec()
+
+			start := time.Now()
+			err := next(ctx, msg)
+			m.duration.WithLabelValues(topic).Observe(time.Since(start).Seconds())
+			m.processed.WithLabelValues(topic, status(err)).Inc()
+			return err
+		}
+	}
+}
+
+// Hooks returns router hooks that count commits, poll errors and rebalances
+// and track assigned partitions.
+func (m *Metrics) Hooks() kafkalight.Hooks {
+	return kafkalight.Hooks{
+		OnCommit: func(_ []kafkalight.TopicPartition, err error) {
+			if err != nil {
+				m.commits.WithLabelValues(CommitFailure).Inc()
+				return
+			}
+			m.commits.WithLabelValues(CommitSuccess).Inc()
+		},
+		OnPollError: func(error) {
+			m.pollErrors.Inc()
+		},
+		OnRebalance: m.rebalance,
+	}
+}
+
+func (m *Metrics) rebalance(event kafkalight.RebalanceEvent) {
+	m.rebalances.WithLabelValues(event.Type.String()).Inc()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	changed := make(map[string]struct{})
+	for _, tp := range event.Partitions {
+		partitions, ok := m.assigned[tp.Topic]
+		if !ok {
+			partitions = make(map[int32]struct{})
+			m.assigned[tp.Topic] = partitions
+		}
+		if event.Type == kafkalight.PartitionsAssigned {
+			partitions[tp.Partition] = struct{}{}
+		} else {
+			delete(partitions, tp.Partition)
+		}
+		changed[tp.Topic] = struct{}{}
+	}
+	for topic := range changed {
+		m.assignedVec.WithLabelValues(topic).Set(float64(len(m.assigned[topic])))
+	}
+}
+
+// ObserveLag sets the consumer lag gauge from a lag monitor check. Partitions
+// that are no longer assigned are removed. Use it with kafkalight.OnLag:
+//
+//	kafkalight.WithLagMonitor(30*time.Second, kafkalight.OnLag(m.ObserveLag))
+func (m *Metrics) ObserveLag(lags []kafkalight.PartitionLag) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lag.Reset()
+	for _, lag := range lags {
+		m.lag.WithLabelValues(lag.Topic, strconv.Itoa(int(lag.Partition))).Set(float64(lag.Lag))
+	}
+}
+
+func status(err error) string {
+	switch {
+	case err == nil:
+		return StatusSuccess
+	case kafkalight.IsPermanent(err):
+		return StatusPermanentError
+	default:
+		return StatusError
+	}
+}
@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/overtonx/kafkalight"
+	"github.com/overtonx/kafkalight/kafkalighttest"
+)
+
+func TestMetrics(t *testing.T) {
+	m := New(WithConstLabels(prometheus.Labels{"group": "billing"}))
+	registry := prometheus.NewPedanticRegistry()
+	require.NoError(t, registry.Register(m))
+
+	broker := kafkalighttest.NewBroker()
+	broker.CreateTopic("orders", 2)
+	broker.MustProduce(t,
+		kafkalighttest.NewMessage("orders", "a", "ok"),
+		kafkalighttest.NewMessage("orders", "b", "ok"),
+		kafkalighttest.NewMessage("orders", "c", "retry"),
+		kafkalighttest.NewMessage("orders", "d", "reject"),
+	)
+
+	group := broker.ConsumerGroup("billing")
+	router := kafkalighttest.NewRouter(t, group, kafkalight.WithHooks(m.Hooks()))
+	router.Use(m.Middleware())
+	router.RegisterRoute("orders", func(ctx context.Context, msg *kafkalight.Message) error {
+		switch string(msg.Value) {
+		case "retry":
+			return errors.New("downstream unavailable")
+		case "reject":
+			return kafkalight.Permanent(errors.New("invalid order"))
+		}
+		return nil
+	})
+	kafkalighttest.Start(t, router)
+	group.WaitProcessed(t, 4)
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.processed.WithLabelValues("orders", StatusSuccess)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.processed.WithLabelValues("orders", StatusError)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.processed.WithLabelValues("orders", StatusPermanentError)))
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.inFlight.WithLabelValues("orders")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.commits.WithLabelValues(CommitSuccess)), "failed messages are not committed")
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.rebalances.WithLabelValues("assigned")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.assignedVec.WithLabelValues("orders")))
+
+	err := testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP kafkalight_assigned_partitions Partitions currently assigned to the router, by topic.
+# TYPE kafkalight_assigned_partitions gauge
+kafkalight_assigned_partitions{group="billing",topic="orders"} 2
+`), "kafkalight_assigned_partitions")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, testutil.CollectAndCount(m, "kafkalight_handler_duration_seconds"))
+}
+
+func TestMetricsHooks(t *testing.T) {
+	m := New(WithNamespace("app"))
+	hooks := m.Hooks()
+
+	hooks.OnPollError(errors.New("broker down"))
+	hooks.OnCommit(nil, errors.New("commit failed"))
+	hooks.OnRebalance(kafkalight.RebalanceEvent{
+		Type: kafkalight.PartitionsAssigned,
+		Partitions: []kafkalight.TopicPartition{
+			{Topic: "orders", Partition: 0}, {Topic: "orders", Partition: 1}, {Topic: "refunds", Partition: 0},
+		},
+	})
+	hooks.OnRebalance(kafkalight.RebalanceEvent{
+		Type:       kafkalight.PartitionsRevoked,
+		Partitions: []kafkalight.TopicPartition{{Topic: "orders", Partition: 1}, {Topic: "refunds", Partition: 0}},
+	})
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.pollErrors))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.commits.WithLabelValues(CommitFailure)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.rebalances.WithLabelValues("revoked")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.assignedVec.WithLabelValues("orders")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.assignedVec.WithLabelValues("refunds")))
+	assert.Equal(t, 1, testutil.CollectAndCount(m, "app_poll_errors_total"))
+}
+
+func TestMetricsObserveLag(t *testing.T) {
+	m := New()
+
+	m.ObserveLag([]kafkalight.PartitionLag{{Topic: "orders", Partition: 0, Lag: 5}, {Topic: "orders", Partition: 1, Lag: 0}})
+	assert.Equal(t, 5.0, testutil.ToFloat64(m.lag.WithLabelValues("orders", "0")))
+	assert.Equal(t, 2, testutil.CollectAndCount(m, "kafkalight_consumer_lag"))
+
+	m.ObserveLag([]kafkalight.PartitionLag{{Topic: "orders", Partition: 1, Lag: 3}})
+	assert.Equal(t, 1, testutil.CollectAndCount(m, "kafkalight_consumer_lag"))
+	assert.Equal(t, 3.0, testutil.ToFloat64(m.lag.WithLabelValues("orders", "1")))
+}
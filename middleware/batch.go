@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/overtonx/kafkalight"
+)
+
+// BatchHandler processes a batch of messages at once.
+//
+// The router delivers messages one at a time. BatchHandler is for
+// application code that accumulates messages itself, and BatchMiddleware
+// lets such code share instrumentation like BatchTracing.
+type BatchHandler func(ctx context.Context, msgs []*kafkalight.Message) error
+
+// BatchMiddleware decorates a BatchHandler.
+type BatchMiddleware func(BatchHandler) BatchHandler
+
+// WrapBatch applies middlewares to h. As with KafkaRouter.Use, the first
+// middleware is the outermost one.
+func WrapBatch(h BatchHandler, middlewares ...BatchMiddleware) BatchHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
@@ -0,0 +1,173 @@
+package middleware
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/overtonx/kafkalight"
+)
+
+type batchTracingConfig struct {
+	provider   trace.TracerProvider
+	propagator propagation.TextMapPropagator
+	group      string
+}
+
+// BatchTracingOption configures BatchTracing.
+type BatchTracingOption func(*batchTracingConfig)
+
+// WithBatchTracerProvider sets the tracer provider. The default is the global one.
+func WithBatchTracerProvider(provider trace.TracerProvider) BatchTracingOption {
+	return func(c *batchTracingConfig) {
+		c.provider = provider
+	}
+}
+
+// WithBatchPropagator sets the propagator used to extract the trace context
+// of each message from its headers. The default is the global one.
+func WithBatchPropagator(propagator propagation.TextMapPropagator) BatchTracingOption {
+	return func(c *batchTracingConfig) {
+		c.propagator = propagator
+	}
+}
+
+// WithBatchConsumerGroup sets the messaging.consumer.group.name attribute.
+func WithBatchConsumerGroup(group string) BatchTracingOption {
+	return func(c *batchTracingConfig) {
+		c.group = group
+	}
+}
+
+// BatchTracing is a batch middleware that wraps a batch in a single consumer
+// "process" span. Messages of a batch usually come from different producer
+// traces, so instead of a parent the span gets a link to the trace context
+// extracted from each message, which carries the partition and offset of the
+// message as attributes. The span carries the batch size as
+// messaging.batch.message_count and the offset range of each partition as
+// messaging.kafka.batch.offset_ranges, e.g. "orders[0]:10-25". It uses the
+// global tracer provider and propagator unless set with
+// WithBatchTracerProvider and WithBatchPropagator.
+func BatchTracing(opts ...BatchTracingOption) BatchMiddleware {
+	cfg := &batchTracingConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	provider := cfg.provider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	tracer := provider.Tracer(
+		instrumentationName,
+		trace.WithInstrumentationVersion(instrumentationVersion),
+	)
+
+	return func(next BatchHandler) BatchHandler {
+		return func(ctx context.Context, msgs []*kafkalight.Message) error {
+			if len(msgs) == 0 {
+				return next(ctx, msgs)
+			}
+
+			propagator := cfg.propagator
+			if propagator == nil {
+				propagator = otel.GetTextMapPropagator()
+			}
+			var links []trace.Link
+			for _, msg := range msgs {
+				extracted := propagator.Extract(context.Background(), kafkalight.NewMessageCarrier(msg))
+				spanContext := trace.SpanContextFromContext(extracted)
+				if !spanContext.IsValid() {
+					continue
+				}
+				links = append(links, trace.Link{
+					SpanContext: spanContext,
+					Attributes: []attribute.KeyValue{
+						attribute.String("messaging.destination.name", msg.TopicPartition.Topic),
+						attribute.Int("messaging.kafka.destination.partition", int(msg.TopicPartition.Partition)),
+						attribute.Int64("messaging.kafka.message.offset", msg.TopicPartition.Offset),
+					},
+				})
+			}
+
+			attrs := []attribute.KeyValue{
+				attribute.String("messaging.system", "kafka"),
+				attribute.String("messaging.operation.type", "process"),
+				attribute.Int("messaging.batch.message_count", len(msgs)),
+				attribute.StringSlice("messaging.kafka.batch.offset_ranges", offsetRanges(msgs)),
+			}
+			name := "process"
+			if topic, ok := singleTopic(msgs); ok {
+				name += " " + topic
+				attrs = append(attrs, attribute.String("messaging.destination.name", topic))
+			}
+			if cfg.group != "" {
+				attrs = append(attrs, attribute.String("messaging.consumer.group.name", cfg.group))
+			}
+
+			ctx, span := tracer.Start(ctx, name,
+				trace.WithSpanKind(trace.SpanKindConsumer),
+				trace.WithAttributes(attrs...),
+				trace.WithLinks(links...),
+			)
+			defer span.End()
+
+			err := next(ctx, msgs)
+			if err != nil {
+				span.RecordError(err)
+				span.SetAttributes(attribute.String("error.type", errorType(err)))
+				span.SetStatus(codes.Error, err.Error())
+			}
+			return err
+		}
+	}
+}
+
+// singleTopic returns the topic of msgs if they all share one.
+func singleTopic(msgs []*kafkalight.Message) (string, bool) {
+	topic := msgs[0].TopicPartition.Topic
+	for _, msg := range msgs[1:] {
+		if msg.TopicPartition.Topic != topic {
+			return "", false
+		}
+	}
+	return topic, true
+}
+
+// offsetRanges returns the lowest and highest offset of msgs per partition,
+// formatted as "topic[partition]:first-last" and ordered by topic and partition.
+func offsetRanges(msgs []*kafkalight.Message) []string {
+	type offsetRange struct {
+		topic       string
+		partition   int32
+		first, last int64
+	}
+	var ranges []offsetRange
+	for _, msg := range msgs {
+		tp := msg.TopicPartition
+		i := slices.IndexFunc(ranges, func(r offsetRange) bool {
+			return r.topic == tp.Topic && r.partition == tp.Partition
+		})
+		if i < 0 {
+			ranges = append(ranges, offsetRange{topic: tp.Topic, partition: tp.Partition, first: tp.Offset, last: tp.Offset})
+			continue
+		}
+		ranges[i].first = min(ranges[i].first, tp.Offset)
+		ranges[i].last = max(ranges[i].last, tp.Offset)
+	}
+	slices.SortFunc(ranges, func(a, b offsetRange) int {
+		return cmp.Or(cmp.Compare(a.topic, b.topic), cmp.Compare(a.partition, b.partition))
+	})
+
+	formatted := make([]string, len(ranges))
+	for i, r := range ranges {
+		formatted[i] = fmt.Sprintf("%s[%d]:%d-%d", r.topic, r.partition, r.first, r.last)
+	}
+	return formatted
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/overtonx/kafkalight"
+)
+
+func TestBatchTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	propagator := propagation.TraceContext{}
+
+	tracer := provider.Tracer("producer")
+	var producers []trace.SpanContext
+	var msgs []*kafkalight.Message
+	for i, offset := range []int64{12, 10, 4} {
+		ctx, span := tracer.Start(context.Background(), "send")
+		span.End()
+		producers = append(producers, span.SpanContext())
+
+		msg := &kafkalight.Message{TopicPartition: kafkalight.TopicPartition{Topic: "orders", Partition: int32(i / 2), Offset: offset}}
+		propagator.Inject(ctx, kafkalight.NewMessageCarrier(msg))
+		msgs = append(msgs, msg)
+	}
+	msgs = append(msgs, &kafkalight.Message{TopicPartition: kafkalight.TopicPartition{Topic: "orders", Partition: 1, Offset: 5}})
+	recorder.Reset()
+
+	handler := WrapBatch(func(context.Context, []*kafkalight.Message) error {
+		return errors.New("boom")
+	}, BatchTracing(
+		WithBatchTracerProvider(provider),
+		WithBatchPropagator(propagator),
+		WithBatchConsumerGroup("billing"),
+	))
+	require.Error(t, handler(context.Background(), msgs))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	batch := spans[0]
+	assert.Equal(t, "process orders", batch.Name())
+	assert.Equal(t, trace.SpanKindConsumer, batch.SpanKind())
+	assert.Equal(t, codes.Error, batch.Status().Code)
+
+	attrs := make(map[string]any)
+	for _, kv := range batch.Attributes() {
+		attrs[string(kv.Key)] = kv.Value.AsInterface()
+	}
+	assert.Equal(t, int64(4), attrs["messaging.batch.message_count"])
+	assert.Equal(t, []string{"orders[0]:10-12", "orders[1]:4-5"}, attrs["messaging.kafka.batch.offset_ranges"])
+	assert.Equal(t, "billing", attrs["messaging.consumer.group.name"])
+
+	require.Len(t, batch.Links(), 3, "messages without trace context are not linked")
+	for i, link := range batch.Links() {
+		assert.Equal(t, producers[i], link.SpanContext.WithRemote(false))
+		linkAttrs := make(map[string]any)
+		for _, kv := range link.Attributes {
+			linkAttrs[string(kv.Key)] = kv.Value.AsInterface()
+		}
+		assert.Equal(t, msgs[i].TopicPartition.Offset, linkAttrs["messaging.kafka.message.offset"])
+		assert.Equal(t, int64(msgs[i].TopicPartition.Partition), linkAttrs["messaging.kafka.destination.partition"])
+	}
+}
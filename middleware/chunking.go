@@ -0,0 +1,293 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/overtonx/kafkalight"
+)
+
+// Headers written by Chunk and read by Reassemble.
+const (
+	HeaderChunkID    = "chunk-id"
+	HeaderChunkIndex = "chunk-index"
+	HeaderChunkCount = "chunk-count"
+)
+
+// Reassembly defaults.
+const (
+	DefaultChunkMemoryLimit = 64 << 20
+	DefaultChunkTimeout     = time.Minute
+	DefaultMaxChunks        = 10000
+)
+
+// ErrChunkMemoryLimit is returned by Reassemble when buffering a chunk would
+// exceed the memory limit. The incomplete message is dropped; the error is permanent.
+var ErrChunkMemoryLimit = errors.New("chunk memory limit exceeded")
+
+// ErrTooManyChunks is returned by Reassemble for chunks whose chunk-count
+// header exceeds the maximum number of chunks. The error is permanent.
+var ErrTooManyChunks = errors.New("too many chunks")
+
+// Chunk returns a producer middleware that splits values larger than size
+// bytes into chunks of at most size bytes. Chunks are sent in order with the
+// key and headers of the original message plus chunk-id, chunk-index and
+// chunk-count headers. All chunks go to the partition the first chunk was
+// delivered to. The partition and offset of the last chunk are written back
+// to the caller's message.
+func Chunk(size int) kafkalight.ProducerMiddleware {
+	return func(next kafkalight.Producer) kafkalight.Producer {
+		return kafkalight.ProducerFunc(func(ctx context.Context, msg *kafkalight.Message) error {
+			if size <= 0 || len(msg.Value) <= size {
+				return next.Produce(ctx, msg)
+			}
+
+			id := newChunkID()
+			count := (len(msg.Value) + size - 1) / size
+			tp := msg.TopicPartition
+
+			for i := 0; i < count; i++ {
+				end := min((i+1)*size, len(msg.Value))
+
+				out := *msg
+				out.TopicPartition = tp
+				out.Value = msg.Value[i*size : end]
+				out.Headers = append([]kafkalight.Header(nil), msg.Headers...)
+				out.SetHeader(HeaderChunkID, []byte(id))
+				out.SetHeader(HeaderChunkIndex, []byte(strconv.Itoa(i)))
+				out.SetHeader(HeaderChunkCount, []byte(strconv.Itoa(count)))
+
+				if err := next.Produce(ctx, &out); err != nil {
+					return fmt.Errorf("produce chunk %d/%d of %s: %w", i+1, count, id, err)
+				}
+				tp.Partition = out.TopicPartition.Partition
+				msg.TopicPartition = out.TopicPartition
+			}
+			return nil
+		})
+	}
+}
+
+type chunkingConfig struct {
+	memoryLimit int
+	maxChunks   int
+	timeout     time.Duration
+	logger      *zap.Logger
+}
+
+// ChunkingOption configures Reassemble.
+type ChunkingOption func(*chunkingConfig)
+
+// WithChunkMemoryLimit limits the total size of buffered chunks in bytes.
+// The default is DefaultChunkMemoryLimit.
+func WithChunkMemoryLimit(n int) ChunkingOption {
+	return func(c *chunkingConfig) {
+		c.memoryLimit = n
+	}
+}
+
+// WithMaxChunks limits the number of chunks of a message to n. The chunk-count
+// header is read before any chunk is buffered, so the limit bounds the memory
+// taken by a set regardless of the size of its chunks. The default is
+// DefaultMaxChunks.
+func WithMaxChunks(n int) ChunkingOption {
+	return func(c *chunkingConfig) {
+		c.maxChunks = n
+	}
+}
+
+// WithChunkTimeout sets how long an incomplete set of chunks is kept after its
+// first chunk arrived. The default is DefaultChunkTimeout.
+func WithChunkTimeout(d time.Duration) ChunkingOption {
+	return func(c *chunkingConfig) {
+		c.timeout = d
+	}
+}
+
+// WithChunkLogger sets the logger that reports dropped incomplete sets. By
+// default the logger of the first chunk's context is used, see
+// kafkalight.LoggerFromContext.
+func WithChunkLogger(logger *zap.Logger) ChunkingOption {
+	return func(c *chunkingConfig) {
+		c.logger = logger
+	}
+}
+
+type chunkSet struct {
+	parts    [][]byte
+	received int
+	size     int
+	releases []func()
+	timer    *time.Timer
+	logger   *zap.Logger
+}
+
+type reassembler struct {
+	cfg  *chunkingConfig
+	mu   sync.Mutex
+	sets map[string]*chunkSet
+	size int
+}
+
+// Reassemble returns a middleware that buffers chunks produced by Chunk and
+// calls the handler once with the reassembled message, which carries the
+// coordinates of the last chunk and the headers without the chunk headers.
+// Messages without chunk headers pass through untouched.
+//
+// With enable.auto.commit disabled, buffered chunks hold back the commits of
+// their partition through kafkalight.DeferCommit, so the offset of the last
+// chunk, and of everything after the first chunk, is only committed once the
+// reassembled message has been processed; after a restart the chunks are
+// read again. Incomplete sets are dropped after the timeout.
+func Reassemble(opts ...ChunkingOption) kafkalight.Middleware {
+	cfg := &chunkingConfig{memoryLimit: DefaultChunkMemoryLimit, maxChunks: DefaultMaxChunks, timeout: DefaultChunkTimeout}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	r := &reassembler{cfg: cfg, sets: make(map[string]*chunkSet)}
+
+	return func(next kafkalight.MessageHandler) kafkalight.MessageHandler {
+		return func(ctx context.Context, msg *kafkalight.Message) error {
+			id, ok := msg.Header(HeaderChunkID)
+			if !ok {
+				return next(ctx, msg)
+			}
+
+			index, count, err := chunkPosition(msg, cfg.maxChunks)
+			if err != nil {
+				return kafkalight.Permanent(fmt.Errorf("%s[%d]@%d: %w",
+					msg.TopicPartition.Topic, msg.TopicPartition.Partition, msg.TopicPartition.Offset, err))
+			}
+
+			logger := cfg.logger
+			if logger == nil {
+				logger = kafkalight.LoggerFromContext(ctx)
+			}
+			release, _ := kafkalight.DeferCommit(ctx)
+			value, releases, err := r.add(string(id), index, count, msg.Value, release, logger)
+			if err != nil {
+				return kafkalight.Permanent(fmt.Errorf("%s[%d]@%d: %w",
+					msg.TopicPartition.Topic, msg.TopicPartition.Partition, msg.TopicPartition.Offset, err))
+			}
+			if value == nil {
+				return nil
+			}
+			defer func() {
+				for _, release := range releases {
+					release()
+				}
+			}()
+
+			msg.Value = value
+			msg.DelHeader(HeaderChunkID, HeaderChunkIndex, HeaderChunkCount)
+			return next(ctx, msg)
+		}
+	}
+}
+
+// add buffers a chunk. It returns the reassembled value and the commit holds
+// of all chunks once the set is complete. logger reports the set if it expires.
+func (r *reassembler) add(id string, index, count int, part []byte, release func(), logger *zap.Logger) ([]byte, []func(), error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	set, ok := r.sets[id]
+	if !ok {
+		set = &chunkSet{parts: make([][]byte, count), logger: logger}
+		set.timer = time.AfterFunc(r.cfg.timeout, func() { r.expire(id) })
+		r.sets[id] = set
+	}
+	if len(set.parts) != count {
+		release()
+		r.dropLocked(id, set)
+		return nil, nil, fmt.Errorf("chunk %s: count changed from %d to %d", id, len(set.parts), count)
+	}
+
+	set.releases = append(set.releases, release)
+	if set.parts[index] != nil {
+		// A chunk read again, e.g. after a rebalance.
+		return nil, nil, nil
+	}
+
+	if r.size+len(part) > r.cfg.memoryLimit {
+		r.dropLocked(id, set)
+		return nil, nil, fmt.Errorf("chunk %s: %w", id, ErrChunkMemoryLimit)
+	}
+	set.parts[index] = bytes.Clone(part)
+	set.received++
+	set.size += len(part)
+	r.size += len(part)
+
+	if set.received < count {
+		return nil, nil, nil
+	}
+
+	releases := set.releases
+	set.releases = nil
+	r.dropLocked(id, set)
+	return bytes.Join(set.parts, nil), releases, nil
+}
+
+func (r *reassembler) expire(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	set, ok := r.sets[id]
+	if !ok {
+		return
+	}
+	set.logger.Warn("dropping incomplete chunked message",
+		zap.String("chunk_id", id),
+		zap.Duration("timeout", r.cfg.timeout),
+		zap.Int("received", set.received),
+		zap.Int("count", len(set.parts)),
+	)
+	r.dropLocked(id, set)
+}
+
+// dropLocked forgets a set and releases the commit holds it still has.
+func (r *reassembler) dropLocked(id string, set *chunkSet) {
+	set.timer.Stop()
+	for _, release := range set.releases {
+		release()
+	}
+	set.releases = nil
+	r.size -= set.size
+	delete(r.sets, id)
+}
+
+// chunkPosition parses the chunk headers of msg. The count comes from the
+// producer, so it is checked against maxChunks before it sizes anything.
+func chunkPosition(msg *kafkalight.Message, maxChunks int) (index, count int, err error) {
+	rawIndex, _ := msg.Header(HeaderChunkIndex)
+	rawCount, _ := msg.Header(HeaderChunkCount)
+
+	if index, err = strconv.Atoi(string(rawIndex)); err != nil {
+		return 0, 0, fmt.Errorf("invalid %s header: %w", HeaderChunkIndex, err)
+	}
+	if count, err = strconv.Atoi(string(rawCount)); err != nil {
+		return 0, 0, fmt.Errorf("invalid %s header: %w", HeaderChunkCount, err)
+	}
+	if count > maxChunks {
+		return 0, 0, fmt.Errorf("%w: %d of at most %d", ErrTooManyChunks, count, maxChunks)
+	}
+	if count <= 0 || index < 0 || index >= count {
+		return 0, 0, fmt.Errorf("invalid chunk %d of %d", index, count)
+	}
+	return index, count, nil
+}
+
+func newChunkID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
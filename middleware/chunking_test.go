@@ -0,0 +1,215 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/overtonx/kafkalight"
+	"github.com/overtonx/kafkalight/kafkalighttest"
+)
+
+func chunkForTest(t *testing.T, size int, msg *kafkalight.Message) []*kafkalight.Message {
+	t.Helper()
+
+	var sent []*kafkalight.Message
+	producer := Chunk(size)(kafkalight.ProducerFunc(func(ctx context.Context, msg *kafkalight.Message) error {
+		requested := *msg
+		sent = append(sent, &requested)
+		msg.TopicPartition.Partition = 3
+		msg.TopicPartition.Offset = int64(len(sent) - 1)
+		return nil
+	}))
+	require.NoError(t, producer.Produce(context.Background(), msg))
+	return sent
+}
+
+func chunkMessage(id string, index, count int, value string) *kafkalight.Message {
+	return &kafkalight.Message{
+		Value: []byte(value),
+		Headers: []kafkalight.Header{
+			{Key: HeaderChunkID, Value: []byte(id)},
+			{Key: HeaderChunkIndex, Value: []byte(strconv.Itoa(index))},
+			{Key: HeaderChunkCount, Value: []byte(strconv.Itoa(count))},
+		},
+	}
+}
+
+func TestChunk(t *testing.T) {
+	key, _ := kafkalight.NewKey("order-1")
+	original := &kafkalight.Message{
+		TopicPartition: kafkalight.TopicPartition{Topic: "docs", Partition: kafkalight.PartitionAny},
+		Key:            *key,
+		Value:          []byte("0123456789"),
+		Headers:        []kafkalight.Header{{Key: "event-type", Value: []byte("doc.created")}},
+	}
+	sent := chunkForTest(t, 4, original)
+
+	require.Len(t, sent, 3)
+	id, _ := sent[0].Header(HeaderChunkID)
+	for i, chunk := range sent {
+		assert.Equal(t, []byte("order-1"), chunk.Key.Bytes())
+		chunkID, _ := chunk.Header(HeaderChunkID)
+		assert.Equal(t, id, chunkID)
+		index, _ := chunk.Header(HeaderChunkIndex)
+		assert.Equal(t, strconv.Itoa(i), string(index))
+		count, _ := chunk.Header(HeaderChunkCount)
+		assert.Equal(t, "3", string(count))
+		eventType, _ := chunk.Header("event-type")
+		assert.Equal(t, "doc.created", string(eventType))
+	}
+	assert.Equal(t, kafkalight.PartitionAny, sent[0].TopicPartition.Partition)
+	assert.Equal(t, int32(3), sent[1].TopicPartition.Partition, "later chunks follow the first one")
+	assert.Equal(t, []byte("0123"), sent[0].Value)
+	assert.Equal(t, []byte("89"), sent[2].Value)
+
+	assert.Equal(t, []byte("0123456789"), original.Value)
+	assert.Len(t, original.Headers, 1)
+	assert.Equal(t, int64(2), int64(original.TopicPartition.Offset), "coordinates of the last chunk")
+
+	small := chunkForTest(t, 4, &kafkalight.Message{Value: []byte("abc")})
+	require.Len(t, small, 1)
+	assert.Empty(t, small[0].Headers)
+}
+
+func TestReassemble(t *testing.T) {
+	var received []*kafkalight.Message
+	handler := Reassemble()(func(ctx context.Context, msg *kafkalight.Message) error {
+		received = append(received, msg)
+		return nil
+	})
+	ctx := context.Background()
+
+	first := chunkForTest(t, 3, &kafkalight.Message{
+		Value:   []byte("first message"),
+		Headers: []kafkalight.Header{{Key: "event-type", Value: []byte("a")}},
+	})
+	second := chunkForTest(t, 5, &kafkalight.Message{Value: []byte("second message")})
+
+	// Chunks of different messages interleave and may arrive twice.
+	stream := []*kafkalight.Message{first[0], second[0], first[1], first[1], second[1], second[2]}
+	stream = append(stream, first[2:]...)
+	for _, msg := range stream {
+		require.NoError(t, handler(ctx, msg))
+	}
+	require.NoError(t, handler(ctx, &kafkalight.Message{Value: []byte("plain")}))
+
+	require.Len(t, received, 3)
+	assert.Equal(t, "second message", string(received[0].Value))
+	assert.Empty(t, received[0].Headers)
+	assert.Equal(t, "first message", string(received[1].Value))
+	assert.Equal(t, []kafkalight.Header{{Key: "event-type", Value: []byte("a")}}, received[1].Headers)
+	assert.Equal(t, "plain", string(received[2].Value))
+}
+
+func TestReassembleLimits(t *testing.T) {
+	var handlerCalls int
+	newHandler := func(opts ...ChunkingOption) kafkalight.MessageHandler {
+		return Reassemble(opts...)(func(ctx context.Context, msg *kafkalight.Message) error {
+			handlerCalls++
+			return nil
+		})
+	}
+	ctx := context.Background()
+
+	t.Run("memory limit", func(t *testing.T) {
+		handler := newHandler(WithChunkMemoryLimit(8))
+		require.NoError(t, handler(ctx, chunkMessage("a", 0, 2, "12345")))
+
+		err := handler(ctx, chunkMessage("b", 0, 2, "12345"))
+		assert.ErrorIs(t, err, ErrChunkMemoryLimit)
+		assert.True(t, kafkalight.IsPermanent(err))
+
+		require.NoError(t, handler(ctx, chunkMessage("a", 1, 2, "6")))
+		assert.Equal(t, 1, handlerCalls)
+	})
+
+	t.Run("timeout drops incomplete sets", func(t *testing.T) {
+		handlerCalls = 0
+		handler := newHandler(WithChunkTimeout(20 * time.Millisecond))
+		require.NoError(t, handler(ctx, chunkMessage("a", 0, 2, "1")))
+		time.Sleep(60 * time.Millisecond)
+
+		require.NoError(t, handler(ctx, chunkMessage("a", 1, 2, "2")))
+		assert.Equal(t, 0, handlerCalls)
+	})
+
+	t.Run("chunk count limit", func(t *testing.T) {
+		handlerCalls = 0
+		handler := newHandler(WithMaxChunks(2))
+		err := handler(ctx, chunkMessage("a", 0, 3, "1"))
+		assert.ErrorIs(t, err, ErrTooManyChunks)
+		assert.True(t, kafkalight.IsPermanent(err))
+
+		err = newHandler()(ctx, chunkMessage("b", 0, 1<<40, "1"))
+		assert.ErrorIs(t, err, ErrTooManyChunks)
+
+		require.NoError(t, handler(ctx, chunkMessage("c", 0, 2, "1")))
+		require.NoError(t, handler(ctx, chunkMessage("c", 1, 2, "2")))
+		assert.Equal(t, 1, handlerCalls)
+	})
+
+	t.Run("invalid headers", func(t *testing.T) {
+		handler := newHandler()
+		for _, msg := range []*kafkalight.Message{
+			chunkMessage("a", 2, 2, "x"),
+			chunkMessage("a", 0, 0, "x"),
+			{Headers: []kafkalight.Header{{Key: HeaderChunkID, Value: []byte("a")}}},
+		} {
+			err := handler(ctx, msg)
+			assert.Error(t, err)
+			assert.True(t, kafkalight.IsPermanent(err))
+		}
+	})
+}
+
+func TestReassembleDefersCommits(t *testing.T) {
+	broker := kafkalighttest.NewBroker()
+	broker.CreateTopic("docs", 1)
+	tp := kafkalight.TopicPartition{Topic: "docs", Partition: 0}
+
+	chunks := chunkForTest(t, 4, kafkalighttest.NewMessage("docs", "doc-1", "0123456789"))
+	for _, chunk := range chunks {
+		chunk.TopicPartition.Partition = kafkalight.PartitionAny
+	}
+	broker.MustProduce(t, chunks[0], chunks[1], kafkalighttest.NewMessage("docs", "other", "plain"))
+
+	var received []string
+	group := broker.ConsumerGroup("group")
+	router := kafkalighttest.NewRouter(t, group)
+	router.Use(Reassemble())
+	router.RegisterRoute("docs", func(ctx context.Context, msg *kafkalight.Message) error {
+		received = append(received, string(msg.Value))
+		return nil
+	})
+	kafkalighttest.Start(t, router)
+
+	group.WaitProcessed(t, 3)
+	group.AssertCommitted(t, tp, 0)
+
+	broker.MustProduce(t, chunks[2])
+	group.WaitProcessed(t, 4)
+	group.AssertCommitted(t, tp, 4)
+	assert.Equal(t, []string{"plain", "0123456789"}, received)
+}
+
+func TestChunkReassembleRoundTrip(t *testing.T) {
+	payload := bytes.Repeat([]byte("abcdefgh"), 1000)
+	chunks := chunkForTest(t, 1000, &kafkalight.Message{Value: payload})
+	require.Len(t, chunks, 8)
+
+	var got []byte
+	handler := Reassemble()(func(ctx context.Context, msg *kafkalight.Message) error {
+		got = msg.Value
+		return nil
+	})
+	for i := len(chunks) - 1; i >= 0; i-- {
+		require.NoError(t, handler(context.Background(), chunks[i]))
+	}
+	assert.Equal(t, payload, got)
+}
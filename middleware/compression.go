@@ -0,0 +1,212 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/overtonx/kafkalight"
+)
+
+// HeaderContentEncoding names the algorithm a message value is compressed with.
+const HeaderContentEncoding = "content-encoding"
+
+// Supported content encodings.
+const (
+	EncodingGzip   = "gzip"
+	EncodingZstd   = "zstd"
+	EncodingSnappy = "snappy" // snappy block format
+)
+
+// ErrUnsupportedEncoding is returned for content encodings other than gzip,
+// zstd and snappy.
+var ErrUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// ErrDecompressedTooLarge is returned when a decompressed value exceeds the
+// limit set with WithMaxDecompressedSize.
+var ErrDecompressedTooLarge = errors.New("decompressed value too large")
+
+// defaultMaxDecompressedSize is the default of WithMaxDecompressedSize.
+const defaultMaxDecompressedSize = 32 << 20
+
+type compressConfig struct {
+	minSize int
+}
+
+// CompressOption configures Compress.
+type CompressOption func(*compressConfig)
+
+// WithMinSize makes Compress send values shorter than n bytes uncompressed.
+func WithMinSize(n int) CompressOption {
+	return func(c *compressConfig) {
+		c.minSize = n
+	}
+}
+
+type decompressConfig struct {
+	maxSize int
+}
+
+// DecompressOption configures Decompress.
+type DecompressOption func(*decompressConfig)
+
+// WithMaxDecompressedSize makes Decompress reject values that decompress to
+// more than n bytes, 32 MiB by default, so that a small compressed message
+// cannot expand to an arbitrarily large payload. A limit of 0 or less removes
+// it.
+func WithMaxDecompressedSize(n int) DecompressOption {
+	return func(c *decompressConfig) {
+		c.maxSize = n
+	}
+}
+
+// Compress returns a producer middleware that compresses Message.Value with
+// encoding and sets the content-encoding header. The caller's message is not
+// modified apart from the partition and offset written back on delivery.
+// Messages that already have a content-encoding header are sent as is.
+// With an unsupported encoding every Produce fails with ErrUnsupportedEncoding.
+func Compress(encoding string, opts ...CompressOption) kafkalight.ProducerMiddleware {
+	cfg := &compressConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	compress, compressorErr := compressor(encoding)
+
+	return func(next kafkalight.Producer) kafkalight.Producer {
+		return kafkalight.ProducerFunc(func(ctx context.Context, msg *kafkalight.Message) error {
+			if compressorErr != nil {
+				return compressorErr
+			}
+			if _, ok := msg.Header(HeaderContentEncoding); ok || len(msg.Value) < cfg.minSize {
+				return next.Produce(ctx, msg)
+			}
+
+			value, err := compress(msg.Value)
+			if err != nil {
+				return fmt.Errorf("compress %s: %w", encoding, err)
+			}
+
+			out := *msg
+			out.Headers = append([]kafkalight.Header(nil), msg.Headers...)
+			out.Value = value
+			out.SetHeader(HeaderContentEncoding, []byte(encoding))
+
+			err = next.Produce(ctx, &out)
+			msg.TopicPartition = out.TopicPartition
+			return err
+		})
+	}
+}
+
+// Decompress returns a middleware that decompresses Message.Value according
+// to the content-encoding header and removes the header. Messages without the
+// header pass through untouched. Unsupported encodings and corrupt values are
+// permanent errors, as are values larger than the limit set with
+// WithMaxDecompressedSize.
+func Decompress(opts ...DecompressOption) kafkalight.Middleware {
+	cfg := &decompressConfig{maxSize: defaultMaxDecompressedSize}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return func(next kafkalight.MessageHandler) kafkalight.MessageHandler {
+		return func(ctx context.Context, msg *kafkalight.Message) error {
+			encoding, ok := msg.Header(HeaderContentEncoding)
+			if !ok {
+				return next(ctx, msg)
+			}
+
+			value, err := decompress(string(encoding), msg.Value, cfg.maxSize)
+			if err != nil {
+				return kafkalight.Permanent(fmt.Errorf("decompress %s[%d]@%d: %w",
+					msg.TopicPartition.Topic, msg.TopicPartition.Partition, msg.TopicPartition.Offset, err))
+			}
+
+			msg.Value = value
+			msg.DelHeader(HeaderContentEncoding)
+			return next(ctx, msg)
+		}
+	}
+}
+
+func compressor(encoding string) (func([]byte) ([]byte, error), error) {
+	switch encoding {
+	case EncodingGzip:
+		return func(data []byte) ([]byte, error) {
+			var buf bytes.Buffer
+			w := gzip.NewWriter(&buf)
+			if _, err := w.Write(data); err != nil {
+				return nil, err
+			}
+			if err := w.Close(); err != nil {
+				return nil, err
+			}
+			return buf.Bytes(), nil
+		}, nil
+	case EncodingZstd:
+		enc, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, err
+		}
+		return func(data []byte) ([]byte, error) {
+			return enc.EncodeAll(data, nil), nil
+		}, nil
+	case EncodingSnappy:
+		return func(data []byte) ([]byte, error) {
+			return s2.EncodeSnappy(nil, data), nil
+		}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedEncoding, encoding)
+	}
+}
+
+func decompress(encoding string, data []byte, maxSize int) ([]byte, error) {
+	switch encoding {
+	case EncodingGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return readLimited(r, maxSize)
+	case EncodingZstd:
+		r, err := zstd.NewReader(bytes.NewReader(data), zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return readLimited(r, maxSize)
+	case EncodingSnappy:
+		n, err := s2.DecodedLen(data)
+		if err != nil {
+			return nil, err
+		}
+		if maxSize > 0 && n > maxSize {
+			return nil, ErrDecompressedTooLarge
+		}
+		return s2.Decode(nil, data)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedEncoding, encoding)
+	}
+}
+
+func readLimited(r io.Reader, maxSize int) ([]byte, error) {
+	if maxSize <= 0 {
+		return io.ReadAll(r)
+	}
+	data, err := io.ReadAll(io.LimitReader(r, int64(maxSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxSize {
+		return nil, ErrDecompressedTooLarge
+	}
+	return data, nil
+}
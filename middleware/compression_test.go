@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/overtonx/kafkalight"
+)
+
+func TestCompressDecompress(t *testing.T) {
+	payload := bytes.Repeat([]byte(`{"name":"order","items":[1,2,3]}`), 100)
+
+	for _, encoding := range []string{EncodingGzip, EncodingZstd, EncodingSnappy} {
+		t.Run(encoding, func(t *testing.T) {
+			var sent *kafkalight.Message
+			producer := kafkalight.WrapProducer(kafkalight.ProducerFunc(func(ctx context.Context, msg *kafkalight.Message) error {
+				sent = msg
+				msg.TopicPartition.Offset = 42
+				return nil
+			}), Compress(encoding))
+
+			original := &kafkalight.Message{
+				TopicPartition: kafkalight.TopicPartition{Topic: "docs"},
+				Value:          payload,
+				Headers:        []kafkalight.Header{{Key: "event-type", Value: []byte("doc.created")}},
+			}
+			require.NoError(t, producer.Produce(context.Background(), original))
+
+			assert.Less(t, len(sent.Value), len(payload)/5)
+			value, ok := sent.Header(HeaderContentEncoding)
+			require.True(t, ok)
+			assert.Equal(t, encoding, string(value))
+
+			assert.Equal(t, payload, original.Value, "caller's message is not modified")
+			assert.Len(t, original.Headers, 1)
+			assert.Equal(t, int64(42), int64(original.TopicPartition.Offset))
+
+			var received *kafkalight.Message
+			handler := Decompress()(func(ctx context.Context, msg *kafkalight.Message) error {
+				received = msg
+				return nil
+			})
+			require.NoError(t, handler(context.Background(), sent))
+
+			assert.Equal(t, payload, received.Value)
+			_, ok = received.Header(HeaderContentEncoding)
+			assert.False(t, ok)
+			assert.Equal(t, []kafkalight.Header{{Key: "event-type", Value: []byte("doc.created")}}, received.Headers)
+		})
+	}
+}
+
+func TestCompressOptions(t *testing.T) {
+	var sent *kafkalight.Message
+	base := kafkalight.ProducerFunc(func(ctx context.Context, msg *kafkalight.Message) error {
+		sent = msg
+		return nil
+	})
+
+	t.Run("small values are sent uncompressed", func(t *testing.T) {
+		producer := Compress(EncodingGzip, WithMinSize(1024))(base)
+		require.NoError(t, producer.Produce(context.Background(), &kafkalight.Message{Value: []byte("tiny")}))
+
+		assert.Equal(t, []byte("tiny"), sent.Value)
+		assert.Empty(t, sent.Headers)
+	})
+
+	t.Run("unsupported encoding", func(t *testing.T) {
+		producer := Compress("brotli")(base)
+		err := producer.Produce(context.Background(), &kafkalight.Message{Value: []byte("x")})
+
+		assert.ErrorIs(t, err, ErrUnsupportedEncoding)
+	})
+}
+
+func TestDecompress(t *testing.T) {
+	var handlerCalled bool
+	newHandler := func(opts ...DecompressOption) kafkalight.MessageHandler {
+		return Decompress(opts...)(func(ctx context.Context, msg *kafkalight.Message) error {
+			handlerCalled = true
+			return nil
+		})
+	}
+	encoded := func(encoding string, value []byte) *kafkalight.Message {
+		return &kafkalight.Message{
+			Value:   value,
+			Headers: []kafkalight.Header{{Key: HeaderContentEncoding, Value: []byte(encoding)}},
+		}
+	}
+
+	t.Run("messages without header pass through", func(t *testing.T) {
+		handlerCalled = false
+		msg := &kafkalight.Message{Value: []byte("plain")}
+
+		require.NoError(t, newHandler()(context.Background(), msg))
+		assert.True(t, handlerCalled)
+		assert.Equal(t, []byte("plain"), msg.Value)
+	})
+
+	t.Run("corrupt value is permanent", func(t *testing.T) {
+		handlerCalled = false
+		err := newHandler()(context.Background(), encoded(EncodingGzip, []byte("not gzip")))
+
+		assert.Error(t, err)
+		assert.True(t, kafkalight.IsPermanent(err))
+		assert.False(t, handlerCalled)
+	})
+
+	t.Run("unsupported encoding is permanent", func(t *testing.T) {
+		err := newHandler()(context.Background(), encoded("br", []byte("x")))
+
+		assert.ErrorIs(t, err, ErrUnsupportedEncoding)
+		assert.True(t, kafkalight.IsPermanent(err))
+	})
+
+	for _, encoding := range []string{EncodingGzip, EncodingZstd, EncodingSnappy} {
+		t.Run("size limit "+encoding, func(t *testing.T) {
+			compress, err := compressor(encoding)
+			require.NoError(t, err)
+			value, err := compress(bytes.Repeat([]byte("a"), 4096))
+			require.NoError(t, err)
+
+			err = newHandler(WithMaxDecompressedSize(1024))(context.Background(), encoded(encoding, value))
+			assert.ErrorIs(t, err, ErrDecompressedTooLarge)
+
+			err = newHandler(WithMaxDecompressedSize(4096))(context.Background(), encoded(encoding, value))
+			assert.NoError(t, err)
+		})
+	}
+
+	t.Run("size is limited by default", func(t *testing.T) {
+		compress, err := compressor(EncodingZstd)
+		require.NoError(t, err)
+		value, err := compress(make([]byte, defaultMaxDecompressedSize+1))
+		require.NoError(t, err)
+
+		err = newHandler()(context.Background(), encoded(EncodingZstd, value))
+		assert.ErrorIs(t, err, ErrDecompressedTooLarge)
+		assert.True(t, kafkalight.IsPermanent(err))
+	})
+}
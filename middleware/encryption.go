@@ -0,0 +1,371 @@
+package middleware
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/overtonx/kafkalight"
+)
+
+// Headers written by Encrypt and read by Decrypt.
+const (
+	// HeaderEncryptionKeyID identifies the key encryption key (KEK).
+	HeaderEncryptionKeyID = "encryption-key-id"
+	// HeaderEncryptionDEK carries the per-message data key wrapped with the KEK.
+	HeaderEncryptionDEK = "encryption-dek"
+	// HeaderEncryptedHeaders lists the headers whose values are encrypted.
+	HeaderEncryptedHeaders = "encryption-headers"
+)
+
+const dataKeySize = 32
+
+var (
+	// ErrKeyNotFound is returned by a KeyProvider for unknown key IDs.
+	ErrKeyNotFound = errors.New("encryption key not found")
+	// ErrNotEncrypted is returned by Decrypt with RequireEncryption for
+	// messages without encryption headers. It is permanent.
+	ErrNotEncrypted = errors.New("message is not encrypted")
+)
+
+// Key is a key encryption key. Material must be 16, 24 or 32 bytes long,
+// selecting AES-128, AES-192 or AES-256.
+type Key struct {
+	ID       string
+	Material []byte
+}
+
+// KeyProvider resolves key encryption keys. PrimaryKey is used to encrypt new
+// messages; Key must resolve every key that may still be found in a topic, so
+// keys can be rotated by changing the primary key while keeping older ones.
+type KeyProvider interface {
+	PrimaryKey(ctx context.Context) (Key, error)
+	Key(ctx context.Context, id string) (Key, error)
+}
+
+// StaticKeyProvider is a KeyProvider over a fixed set of keys.
+type StaticKeyProvider struct {
+	mu      sync.RWMutex
+	primary string
+	keys    map[string]Key
+}
+
+// NewStaticKeyProvider creates a StaticKeyProvider. primary must be one of keys.
+func NewStaticKeyProvider(primary string, keys map[string][]byte) (*StaticKeyProvider, error) {
+	p := &StaticKeyProvider{}
+	if err := p.set(primary, keys); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// PrimaryKey returns the key used for encryption.
+func (p *StaticKeyProvider) PrimaryKey(ctx context.Context) (Key, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.keys[p.primary], nil
+}
+
+// Key returns the key with the given ID or ErrKeyNotFound.
+func (p *StaticKeyProvider) Key(ctx context.Context, id string) (Key, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	key, ok := p.keys[id]
+	if !ok {
+		return Key{}, fmt.Errorf("%w: %q", ErrKeyNotFound, id)
+	}
+	return key, nil
+}
+
+func (p *StaticKeyProvider) set(primary string, material map[string][]byte) error {
+	keys := make(map[string]Key, len(material))
+	for id, m := range material {
+		if _, err := aes.NewCipher(m); err != nil {
+			return fmt.Errorf("key %q: %w", id, err)
+		}
+		keys[id] = Key{ID: id, Material: m}
+	}
+	if _, ok := keys[primary]; !ok {
+		return fmt.Errorf("%w: primary key %q", ErrKeyNotFound, primary)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.primary = primary
+	p.keys = keys
+	return nil
+}
+
+// FileKeyProvider is a KeyProvider that loads keys from a JSON file:
+//
+//	{"primary": "2026-10", "keys": {"2026-09": "<base64>", "2026-10": "<base64>"}}
+//
+// Call Reload after the file changes to rotate keys without a restart.
+type FileKeyProvider struct {
+	StaticKeyProvider
+	path string
+}
+
+// NewFileKeyProvider loads keys from the file at path.
+func NewFileKeyProvider(path string) (*FileKeyProvider, error) {
+	p := &FileKeyProvider{path: path}
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Reload reads the key file again. On error the previous keys are kept.
+func (p *FileKeyProvider) Reload() error {
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return fmt.Errorf("read key file: %w", err)
+	}
+
+	var file struct {
+		Primary string            `json:"primary"`
+		Keys    map[string]string `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("parse key file %s: %w", p.path, err)
+	}
+
+	material := make(map[string][]byte, len(file.Keys))
+	for id, encoded := range file.Keys {
+		m, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return fmt.Errorf("key %q in %s: %w", id, p.path, err)
+		}
+		material[id] = m
+	}
+	return p.set(file.Primary, material)
+}
+
+type encryptionConfig struct {
+	headers []string
+	require bool
+}
+
+// EncryptionOption configures Encrypt and Decrypt.
+type EncryptionOption func(*encryptionConfig)
+
+// WithEncryptedHeaders makes Encrypt also encrypt the values of the named
+// headers. Decrypt reads the list from the message and needs no option.
+func WithEncryptedHeaders(names ...string) EncryptionOption {
+	return func(c *encryptionConfig) {
+		c.headers = append(c.headers, names...)
+	}
+}
+
+// RequireEncryption makes Decrypt reject messages that are not encrypted.
+func RequireEncryption() EncryptionOption {
+	return func(c *encryptionConfig) {
+		c.require = true
+	}
+}
+
+// Encrypt returns a producer middleware that encrypts Message.Value with
+// AES-GCM envelope encryption: every message gets a random data key, which is
+// wrapped with the primary key of provider and sent in the encryption-dek
+// header together with the key ID. The caller's message is not modified apart
+// from the partition and offset written back on delivery.
+func Encrypt(provider KeyProvider, opts ...EncryptionOption) kafkalight.ProducerMiddleware {
+	cfg := &encryptionConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return func(next kafkalight.Producer) kafkalight.Producer {
+		return kafkalight.ProducerFunc(func(ctx context.Context, msg *kafkalight.Message) error {
+			kek, err := provider.PrimaryKey(ctx)
+			if err != nil {
+				return fmt.Errorf("resolve primary key: %w", err)
+			}
+
+			out := *msg
+			out.Headers = append([]kafkalight.Header(nil), msg.Headers...)
+			if err := encryptMessage(&out, kek, cfg.headers); err != nil {
+				return fmt.Errorf("encrypt message: %w", err)
+			}
+
+			err = next.Produce(ctx, &out)
+			msg.TopicPartition = out.TopicPartition
+			return err
+		})
+	}
+}
+
+// Decrypt returns a middleware that decrypts messages encrypted by Encrypt,
+// resolving the key by the encryption-key-id header, and removes the
+// encryption headers. Messages without the headers pass through untouched
+// unless RequireEncryption is set. Tampered or undecryptable messages are
+// permanent errors. Key provider errors are returned as is, so the offset of
+// a message encrypted with a key that is not deployed yet is not committed by
+// itself, but the next message of the partition that succeeds commits past
+// it: unless the router stops first, such messages are effectively skipped.
+func Decrypt(provider KeyProvider, opts ...EncryptionOption) kafkalight.Middleware {
+	cfg := &encryptionConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return func(next kafkalight.MessageHandler) kafkalight.MessageHandler {
+		return func(ctx context.Context, msg *kafkalight.Message) error {
+			keyID, ok := msg.Header(HeaderEncryptionKeyID)
+			if !ok {
+				if cfg.require {
+					return kafkalight.Permanent(fmt.Errorf("%s[%d]@%d: %w",
+						msg.TopicPartition.Topic, msg.TopicPartition.Partition, msg.TopicPartition.Offset, ErrNotEncrypted))
+				}
+				return next(ctx, msg)
+			}
+
+			kek, err := provider.Key(ctx, string(keyID))
+			if err != nil {
+				return fmt.Errorf("resolve key %q: %w", keyID, err)
+			}
+			if err := decryptMessage(msg, kek); err != nil {
+				return kafkalight.Permanent(fmt.Errorf("decrypt %s[%d]@%d: %w",
+					msg.TopicPartition.Topic, msg.TopicPartition.Partition, msg.TopicPartition.Offset, err))
+			}
+			return next(ctx, msg)
+		}
+	}
+}
+
+func encryptMessage(msg *kafkalight.Message, kek Key, headers []string) error {
+	dek := make([]byte, dataKeySize)
+	if _, err := rand.Read(dek); err != nil {
+		return err
+	}
+
+	wrapped, err := seal(kek.Material, dek, []byte(kek.ID))
+	if err != nil {
+		return err
+	}
+
+	var encrypted []string
+	for i, h := range msg.Headers {
+		if !slices.Contains(headers, h.Key) {
+			continue
+		}
+		if msg.Headers[i].Value, err = seal(dek, h.Value, []byte(h.Key)); err != nil {
+			return err
+		}
+		if !slices.Contains(encrypted, h.Key) {
+			encrypted = append(encrypted, h.Key)
+		}
+	}
+	slices.Sort(encrypted)
+
+	// The list of encrypted headers is authenticated with the value, so that
+	// removing a name from it, which would pass the header through as is,
+	// fails decryption.
+	if msg.Value, err = seal(dek, msg.Value, encryptedHeadersAAD(encrypted)); err != nil {
+		return err
+	}
+
+	msg.SetHeader(HeaderEncryptionKeyID, []byte(kek.ID))
+	msg.SetHeader(HeaderEncryptionDEK, wrapped)
+	if len(encrypted) > 0 {
+		msg.SetHeader(HeaderEncryptedHeaders, encryptedHeadersAAD(encrypted))
+	}
+	return nil
+}
+
+func decryptMessage(msg *kafkalight.Message, kek Key) error {
+	wrapped, ok := msg.Header(HeaderEncryptionDEK)
+	if !ok {
+		return fmt.Errorf("missing %s header", HeaderEncryptionDEK)
+	}
+	dek, err := unseal(kek.Material, wrapped, []byte(kek.ID))
+	if err != nil {
+		return fmt.Errorf("unwrap data key: %w", err)
+	}
+
+	var encrypted []string
+	if list, ok := msg.Header(HeaderEncryptedHeaders); ok {
+		if err := json.Unmarshal(list, &encrypted); err != nil {
+			return fmt.Errorf("%s header: %w", HeaderEncryptedHeaders, err)
+		}
+	}
+	value, err := unseal(dek, msg.Value, encryptedHeadersAAD(encrypted))
+	if err != nil {
+		return fmt.Errorf("value: %w", err)
+	}
+	headers := slices.Clone(msg.Headers)
+	for i, h := range headers {
+		if h.Key == HeaderEncryptionKeyID || h.Key == HeaderEncryptionDEK || h.Key == HeaderEncryptedHeaders {
+			continue
+		}
+		if slices.Contains(encrypted, h.Key) {
+			if headers[i].Value, err = unseal(dek, h.Value, []byte(h.Key)); err != nil {
+				return fmt.Errorf("header %q: %w", h.Key, err)
+			}
+		}
+	}
+
+	msg.Value = value
+	msg.Headers = headers
+	msg.DelHeader(HeaderEncryptionKeyID, HeaderEncryptionDEK, HeaderEncryptedHeaders)
+	return nil
+}
+
+// encryptedHeadersAAD returns the sorted list of encrypted header names as a
+// JSON array, so that names containing any character round-trip. It is both
+// the value of the encryption-headers header and the additional data binding
+// the list to the value; it is empty if no header is encrypted.
+func encryptedHeadersAAD(names []string) []byte {
+	if len(names) == 0 {
+		return nil
+	}
+	sorted := slices.Clone(names)
+	slices.Sort(sorted)
+	data, _ := json.Marshal(slices.Compact(sorted))
+	return data
+}
+
+// seal encrypts plaintext with AES-GCM and returns nonce || ciphertext.
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// unseal decrypts the output of seal.
+func unseal(key, sealed, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,233 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/overtonx/kafkalight"
+)
+
+var (
+	keyV1 = bytes.Repeat([]byte{1}, 32)
+	keyV2 = bytes.Repeat([]byte{2}, 32)
+)
+
+func encryptForTest(t *testing.T, provider KeyProvider, msg *kafkalight.Message, opts ...EncryptionOption) *kafkalight.Message {
+	t.Helper()
+
+	var sent *kafkalight.Message
+	producer := Encrypt(provider, opts...)(kafkalight.ProducerFunc(func(ctx context.Context, msg *kafkalight.Message) error {
+		sent = msg
+		return nil
+	}))
+	require.NoError(t, producer.Produce(context.Background(), msg))
+	return sent
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	provider, err := NewStaticKeyProvider("v1", map[string][]byte{"v1": keyV1})
+	require.NoError(t, err)
+
+	original := &kafkalight.Message{
+		TopicPartition: kafkalight.TopicPartition{Topic: "patients"},
+		Value:          []byte(`{"ssn":"123-45-6789"}`),
+		Headers: []kafkalight.Header{
+			{Key: "event-type", Value: []byte("patient.admitted")},
+			{Key: "patient-name", Value: []byte("Jane Doe")},
+		},
+	}
+	sent := encryptForTest(t, provider, original, WithEncryptedHeaders("patient-name"))
+
+	assert.NotContains(t, string(sent.Value), "123-45-6789")
+	name, _ := sent.Header("patient-name")
+	assert.NotEqual(t, "Jane Doe", string(name))
+	eventType, _ := sent.Header("event-type")
+	assert.Equal(t, "patient.admitted", string(eventType))
+	keyID, _ := sent.Header(HeaderEncryptionKeyID)
+	assert.Equal(t, "v1", string(keyID))
+	list, _ := sent.Header(HeaderEncryptedHeaders)
+	assert.Equal(t, `["patient-name"]`, string(list))
+
+	assert.Equal(t, `{"ssn":"123-45-6789"}`, string(original.Value), "caller's message is not modified")
+	assert.Len(t, original.Headers, 2)
+
+	var received *kafkalight.Message
+	handler := Decrypt(provider)(func(ctx context.Context, msg *kafkalight.Message) error {
+		received = msg
+		return nil
+	})
+	require.NoError(t, handler(context.Background(), sent))
+
+	assert.Equal(t, original.Value, received.Value)
+	assert.Equal(t, original.Headers, received.Headers)
+}
+
+func TestEncryptDecrypt_HeaderNamesWithCommas(t *testing.T) {
+	provider, err := NewStaticKeyProvider("v1", map[string][]byte{"v1": keyV1})
+	require.NoError(t, err)
+
+	original := &kafkalight.Message{
+		Value: []byte("secret"),
+		Headers: []kafkalight.Header{
+			{Key: "a,b", Value: []byte("both")},
+			{Key: "a", Value: []byte("plain")},
+		},
+	}
+	sent := encryptForTest(t, provider, original, WithEncryptedHeaders("a,b"))
+	plain, _ := sent.Header("a")
+	assert.Equal(t, "plain", string(plain))
+
+	var received *kafkalight.Message
+	handler := Decrypt(provider)(func(ctx context.Context, msg *kafkalight.Message) error {
+		received = msg
+		return nil
+	})
+	require.NoError(t, handler(context.Background(), sent))
+	assert.Equal(t, original.Headers, received.Headers)
+}
+
+func TestEncryptKeyRotation(t *testing.T) {
+	old, err := NewStaticKeyProvider("v1", map[string][]byte{"v1": keyV1})
+	require.NoError(t, err)
+	rotated, err := NewStaticKeyProvider("v2", map[string][]byte{"v1": keyV1, "v2": keyV2})
+	require.NoError(t, err)
+
+	fromOld := encryptForTest(t, old, &kafkalight.Message{Value: []byte("old")})
+	fromNew := encryptForTest(t, rotated, &kafkalight.Message{Value: []byte("new")})
+	keyID, _ := fromNew.Header(HeaderEncryptionKeyID)
+	assert.Equal(t, "v2", string(keyID))
+
+	var values []string
+	handler := Decrypt(rotated)(func(ctx context.Context, msg *kafkalight.Message) error {
+		values = append(values, string(msg.Value))
+		return nil
+	})
+	require.NoError(t, handler(context.Background(), fromOld))
+	require.NoError(t, handler(context.Background(), fromNew))
+	assert.Equal(t, []string{"old", "new"}, values)
+
+	t.Run("unknown key is not permanent", func(t *testing.T) {
+		err := Decrypt(old)(handler)(context.Background(), encryptForTest(t, rotated, &kafkalight.Message{Value: []byte("x")}))
+
+		assert.ErrorIs(t, err, ErrKeyNotFound)
+		assert.False(t, kafkalight.IsPermanent(err))
+	})
+}
+
+func TestDecryptErrors(t *testing.T) {
+	provider, err := NewStaticKeyProvider("v1", map[string][]byte{"v1": keyV1})
+	require.NoError(t, err)
+
+	var handlerCalled bool
+	newHandler := func(opts ...EncryptionOption) kafkalight.MessageHandler {
+		return Decrypt(provider, opts...)(func(ctx context.Context, msg *kafkalight.Message) error {
+			handlerCalled = true
+			return nil
+		})
+	}
+
+	t.Run("plaintext passes through", func(t *testing.T) {
+		handlerCalled = false
+		require.NoError(t, newHandler()(context.Background(), &kafkalight.Message{Value: []byte("plain")}))
+		assert.True(t, handlerCalled)
+	})
+
+	t.Run("plaintext is rejected when encryption is required", func(t *testing.T) {
+		handlerCalled = false
+		err := newHandler(RequireEncryption())(context.Background(), &kafkalight.Message{Value: []byte("plain")})
+
+		assert.ErrorIs(t, err, ErrNotEncrypted)
+		assert.True(t, kafkalight.IsPermanent(err))
+		assert.False(t, handlerCalled)
+	})
+
+	t.Run("tampered value is permanent", func(t *testing.T) {
+		handlerCalled = false
+		msg := encryptForTest(t, provider, &kafkalight.Message{Value: []byte("secret")})
+		msg.Value[len(msg.Value)-1] ^= 0xff
+
+		err := newHandler()(context.Background(), msg)
+		assert.Error(t, err)
+		assert.True(t, kafkalight.IsPermanent(err))
+		assert.False(t, handlerCalled)
+	})
+
+	t.Run("tampered encrypted header list is permanent", func(t *testing.T) {
+		for name, list := range map[string]string{
+			"removed":   `["patient-id"]`,
+			"added":     `["event-type","patient-id","patient-name"]`,
+			"malformed": "patient-id,patient-name",
+			"cleared":   "",
+		} {
+			handlerCalled = false
+			msg := encryptForTest(t, provider, &kafkalight.Message{
+				Value: []byte("secret"),
+				Headers: []kafkalight.Header{
+					{Key: "patient-name", Value: []byte("Jane Doe")},
+					{Key: "patient-id", Value: []byte("42")},
+					{Key: "event-type", Value: []byte("patient.admitted")},
+				},
+			}, WithEncryptedHeaders("patient-name", "patient-id"))
+			if list == "" {
+				msg.DelHeader(HeaderEncryptedHeaders)
+			} else {
+				msg.SetHeader(HeaderEncryptedHeaders, []byte(list))
+			}
+
+			err := newHandler()(context.Background(), msg)
+			assert.Error(t, err, name)
+			assert.True(t, kafkalight.IsPermanent(err), name)
+			assert.False(t, handlerCalled, name)
+		}
+	})
+
+	t.Run("swapped key id is permanent", func(t *testing.T) {
+		rotated, err := NewStaticKeyProvider("v2", map[string][]byte{"v1": keyV2, "v2": keyV2})
+		require.NoError(t, err)
+		msg := encryptForTest(t, rotated, &kafkalight.Message{Value: []byte("secret")})
+		msg.SetHeader(HeaderEncryptionKeyID, []byte("v1"))
+
+		err = Decrypt(rotated)(func(ctx context.Context, msg *kafkalight.Message) error { return nil })(context.Background(), msg)
+		assert.True(t, kafkalight.IsPermanent(err))
+	})
+}
+
+func TestFileKeyProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	write := func(content string) {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+	b64 := base64.StdEncoding.EncodeToString
+
+	write(`{"primary": "v1", "keys": {"v1": "` + b64(keyV1) + `"}}`)
+	provider, err := NewFileKeyProvider(path)
+	require.NoError(t, err)
+
+	key, err := provider.PrimaryKey(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, Key{ID: "v1", Material: keyV1}, key)
+
+	write(`{"primary": "v2", "keys": {"v1": "` + b64(keyV1) + `", "v2": "` + b64(keyV2) + `"}}`)
+	require.NoError(t, provider.Reload())
+
+	key, err = provider.PrimaryKey(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "v2", key.ID)
+	_, err = provider.Key(context.Background(), "v1")
+	assert.NoError(t, err)
+
+	write(`{"primary": "v3", "keys": {"v3": "` + b64([]byte("short")) + `"}}`)
+	assert.Error(t, provider.Reload())
+	key, _ = provider.PrimaryKey(context.Background())
+	assert.Equal(t, "v2", key.ID, "previous keys are kept on reload errors")
+
+	_, err = NewFileKeyProvider(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
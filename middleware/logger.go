@@ -2,42 +2,185 @@ package middleware
 
 import (
 	"context"
+	"math/rand/v2"
+	"slices"
 	"time"
 
 	"go.uber.org/zap"
 
 	"github.com/overtonx/kafkalight"
+	"github.com/overtonx/kafkalight/redact"
 )
 
-func Logger(logger *zap.Logger) kafkalight.Middleware {
+// loggerConfig holds the configuration of the logger middleware.
+type loggerConfig struct {
+	headers       []string
+	allHeaders    bool
+	payloadMaxLen int
+	sampleRate    float64
+	slowThreshold time.Duration
+	shouldLog     func(msg *kafkalight.Message, duration time.Duration) bool
+	redaction     *redact.Policy
+	fields        []kafkalight.MessageField // nil logs all fields
+}
+
+// LoggerOption configures the logger middleware.
+type LoggerOption func(*loggerConfig)
+
+// WithLogFields logs only the given message fields, or none if no fields are
+// given, in the processed message line. Handlers logging through
+// kafkalight.LoggerFromContext still log all of them.
+func WithLogFields(fields ...kafkalight.MessageField) LoggerOption {
+	return func(c *loggerConfig) {
+		c.fields = append([]kafkalight.MessageField{}, fields...)
+	}
+}
+
+// WithLogHeaders logs the given message headers, or all headers if none are given.
+func WithLogHeaders(keys ...string) LoggerOption {
+	return func(c *loggerConfig) {
+		c.headers = keys
+		c.allHeaders = len(keys) == 0
+	}
+}
+
+// WithLogPayload logs up to maxLen bytes of the payload along with its size.
+// Payloads may contain personal data, so this is meant for debugging.
+func WithLogPayload(maxLen int) LoggerOption {
+	return func(c *loggerConfig) {
+		c.payloadMaxLen = maxLen
+	}
+}
+
+// WithLogSampleRate logs only the given fraction, between 0 and 1, of
+// successfully processed messages. Failed and slow messages are always logged.
+func WithLogSampleRate(rate float64) LoggerOption {
+	return func(c *loggerConfig) {
+		c.sampleRate = rate
+	}
+}
+
+// WithSlowThreshold logs messages whose processing took longer than d at
+// Warn level, regardless of the sample rate.
+func WithSlowThreshold(d time.Duration) LoggerOption {
+	return func(c *loggerConfig) {
+		c.slowThreshold = d
+	}
+}
+
+// WithShouldLog logs successfully processed messages only if fn returns
+// true, e.g. to skip heartbeat topics. Failed messages are always logged.
+func WithShouldLog(fn func(msg *kafkalight.Message, duration time.Duration) bool) LoggerOption {
+	return func(c *loggerConfig) {
+		c.shouldLog = fn
+	}
+}
+
+// WithLogRedaction redacts the logged key, headers and payload according to
+// policy, and puts policy into the handler context for the middlewares and
+// handlers after Logger. By default the policy of the context is used, see
+// kafkalight.WithRedaction.
+func WithLogRedaction(policy *redact.Policy) LoggerOption {
+	return func(c *loggerConfig) {
+		c.redaction = policy
+	}
+}
+
+// Logger is a middleware that logs every processed message with its duration
+// and status. It puts logger, with the fields of the message, into the
+// handler context, so that handlers log through the same logger with
+// kafkalight.LoggerFromContext. A nil logger uses the logger the router put
+// into the context. Trace IDs are logged for spans started before Logger, so
+// use it after middleware.Tracing.
+//
+// Failed messages are logged at Error level, slow ones at Warn and the
+// others at Info, subject to WithShouldLog and WithLogSampleRate.
+func Logger(logger *zap.Logger, opts ...LoggerOption) kafkalight.Middleware {
+	cfg := &loggerConfig{
+		sampleRate: 1,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
 	return func(fn kafkalight.MessageHandler) kafkalight.MessageHandler {
 		return func(ctx context.Context, msg *kafkalight.Message) error {
+			policy := cfg.redaction
+			if policy != nil {
+				ctx = kafkalight.ContextWithRedaction(ctx, policy)
+			} else {
+				policy = kafkalight.RedactionFromContext(ctx)
+			}
+			if logger != nil {
+				ctx = kafkalight.ContextWithMessage(kafkalight.ContextWithLogger(ctx, logger), msg)
+			}
 			start := time.Now()
 
 			err := fn(ctx, msg)
 
 			duration := time.Since(start)
+			slow := cfg.slowThreshold > 0 && duration > cfg.slowThreshold
+			if err == nil && !cfg.shouldLogSuccess(msg, duration, slow) {
+				return nil
+			}
 
 			fields := []zap.Field{
-				zap.String("topic", msg.TopicPartition.Topic),
-				zap.Int32("partition", msg.TopicPartition.Partition),
 				zap.Time("timestamp", start),
 				zap.Duration("duration", duration),
 			}
+			fields = append(fields, cfg.messageFields(msg, policy)...)
 
-			if msg.Key.Exists() {
-				fields = append(fields, zap.String("key", msg.Key.String()))
+			logCtx := ctx
+			if cfg.fields != nil {
+				logCtx = kafkalight.ContextWithMessageFields(ctx, cfg.fields...)
 			}
-
-			if err != nil {
+			log := kafkalight.LoggerFromContext(logCtx)
+			switch {
+			case err != nil:
 				fields = append(fields, zap.String("status", "error"), zap.Error(err))
-				logger.Error("processed message", fields...)
-			} else {
+				log.Error("processed message", fields...)
+			case slow:
+				fields = append(fields, zap.String("status", "success"), zap.Bool("slow", true))
+				log.Warn("processed message", fields...)
+			default:
 				fields = append(fields, zap.String("status", "success"))
-				logger.Info("processed message", fields...)
+				log.Info("processed message", fields...)
 			}
 
 			return err
 		}
 	}
 }
+
+func (c *loggerConfig) shouldLogSuccess(msg *kafkalight.Message, duration time.Duration, slow bool) bool {
+	if c.shouldLog != nil && !c.shouldLog(msg, duration) {
+		return false
+	}
+	return slow || c.sampleRate >= 1 || rand.Float64() < c.sampleRate
+}
+
+// messageFields returns the headers and payload fields selected by the
+// options, redacted by policy.
+func (c *loggerConfig) messageFields(msg *kafkalight.Message, policy *redact.Policy) []zap.Field {
+	var fields []zap.Field
+	if c.allHeaders || len(c.headers) > 0 {
+		headers := make(map[string]string)
+		for _, h := range msg.Headers {
+			if !c.allHeaders && !slices.Contains(c.headers, h.Key) {
+				continue
+			}
+			if value, ok := policy.Header(h.Key, h.Value); ok {
+				headers[h.Key] = string(value)
+			}
+		}
+		fields = append(fields, zap.Any("headers", headers))
+	}
+	if c.payloadMaxLen > 0 {
+		preview := policy.JSON(msg.Value)
+		if len(preview) > c.payloadMaxLen {
+			preview = preview[:c.payloadMaxLen]
+		}
+		fields = append(fields, zap.ByteString("payload", preview), zap.Int("payload_size", len(msg.Value)))
+	}
+	return fields
+}
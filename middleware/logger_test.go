@@ -4,8 +4,10 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zaptest/observer"
 
@@ -68,4 +70,101 @@ func TestLogger(t *testing.T) {
 		assert.Equal(t, "error", ctx["status"])
 		assert.Equal(t, "handler error", ctx["error"])
 	})
+
+	t.Run("shares logger with handler", func(t *testing.T) {
+		handler := kafkalight.MessageHandler(func(ctx context.Context, msg *kafkalight.Message) error {
+			kafkalight.LoggerFromContext(ctx).Info("handling")
+			return nil
+		})
+
+		tracing := TracingWithOptions(WithTracerProvider(sdktrace.NewTracerProvider()))
+		err := tracing(Logger(logger)(handler))(context.Background(), msg)
+		assert.NoError(t, err)
+
+		logs := recorded.TakeAll()
+		assert.Len(t, logs, 2)
+		handlerFields, middlewareFields := logs[0].ContextMap(), logs[1].ContextMap()
+		assert.Equal(t, "test-key", handlerFields["key"])
+		assert.NotEmpty(t, handlerFields["trace_id"])
+		assert.Equal(t, handlerFields["trace_id"], middlewareFields["trace_id"])
+	})
+}
+
+func TestLogger_Options(t *testing.T) {
+	core, recorded := observer.New(zap.InfoLevel)
+	logger := zap.New(core)
+
+	msg := &kafkalight.Message{
+		TopicPartition: kafkalight.TopicPartition{Topic: "orders", Offset: 7},
+		Value:          []byte(`{"id":1,"note":"long"}`),
+		Headers: []kafkalight.Header{
+			{Key: "tenant", Value: []byte("acme")},
+			{Key: "authorization", Value: []byte("secret")},
+		},
+	}
+	ok := kafkalight.MessageHandler(func(context.Context, *kafkalight.Message) error { return nil })
+	slow := kafkalight.MessageHandler(func(context.Context, *kafkalight.Message) error {
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	})
+	failing := kafkalight.MessageHandler(func(context.Context, *kafkalight.Message) error { return errors.New("boom") })
+
+	t.Run("fields", func(t *testing.T) {
+		mw := Logger(logger, WithLogHeaders("tenant"), WithLogPayload(8))
+		assert.NoError(t, mw(ok)(context.Background(), msg))
+
+		logs := recorded.TakeAll()
+		assert.Len(t, logs, 1)
+		fields := logs[0].ContextMap()
+		assert.Equal(t, int64(7), fields["offset"])
+		assert.Equal(t, map[string]string{"tenant": "acme"}, fields["headers"])
+		assert.Equal(t, `{"id":1,`, fields["payload"])
+		assert.Equal(t, int64(len(msg.Value)), fields["payload_size"])
+	})
+
+	t.Run("field selection", func(t *testing.T) {
+		mw := Logger(logger, WithLogFields(kafkalight.FieldTopic, kafkalight.FieldPartition))
+		assert.NoError(t, mw(func(ctx context.Context, _ *kafkalight.Message) error {
+			kafkalight.LoggerFromContext(ctx).Info("handling")
+			return nil
+		})(context.Background(), msg))
+		assert.NoError(t, Logger(logger, WithLogFields())(ok)(context.Background(), msg))
+
+		logs := recorded.TakeAll()
+		assert.Len(t, logs, 3)
+		assert.Equal(t, int64(7), logs[0].ContextMap()["offset"], "the handler logger keeps all fields")
+		fields := logs[1].ContextMap()
+		assert.Equal(t, "orders", fields["topic"])
+		assert.Contains(t, fields, "partition")
+		assert.NotContains(t, fields, "offset")
+		fields = logs[2].ContextMap()
+		assert.NotContains(t, fields, "topic")
+		assert.NotContains(t, fields, "offset")
+		assert.Equal(t, "success", fields["status"])
+	})
+
+	t.Run("sampling keeps errors and slow messages", func(t *testing.T) {
+		mw := Logger(logger, WithLogSampleRate(0), WithSlowThreshold(time.Millisecond))
+		assert.NoError(t, mw(ok)(context.Background(), msg))
+		assert.NoError(t, mw(slow)(context.Background(), msg))
+		assert.Error(t, mw(failing)(context.Background(), msg))
+
+		logs := recorded.TakeAll()
+		assert.Len(t, logs, 2)
+		assert.Equal(t, zap.WarnLevel, logs[0].Level)
+		assert.Equal(t, true, logs[0].ContextMap()["slow"])
+		assert.Equal(t, zap.ErrorLevel, logs[1].Level)
+	})
+
+	t.Run("should log", func(t *testing.T) {
+		mw := Logger(logger, WithShouldLog(func(msg *kafkalight.Message, _ time.Duration) bool {
+			return msg.TopicPartition.Topic != "orders"
+		}))
+		assert.NoError(t, mw(ok)(context.Background(), msg))
+		assert.Error(t, mw(failing)(context.Background(), msg))
+
+		logs := recorded.TakeAll()
+		assert.Len(t, logs, 1)
+		assert.Equal(t, "error", logs[0].ContextMap()["status"])
+	})
 }
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/overtonx/kafkalight"
+)
+
+// processDurationBuckets are the bucket boundaries recommended by the
+// messaging semantic conventions for messaging.process.duration.
+var processDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.25, 0.5, 0.75, 1, 2.5, 5, 7.5, 10}
+
+// OTelMetrics is a middleware that records OpenTelemetry metrics following the
+// messaging semantic conventions:
+//
+//   - messaging.process.duration: handler duration in seconds
+//   - messaging.client.consumed.messages: number of messages handled
+//
+// Both carry the attributes of the spans created by Tracing (system,
+// operation type, destination name, partition and consumer group) plus
+// error.type for failed messages. A nil provider uses the global one.
+func OTelMetrics(provider metric.MeterProvider, consumerGroup ...string) kafkalight.Middleware {
+	group := ""
+	if len(consumerGroup) > 0 {
+		group = consumerGroup[0]
+	}
+	if provider == nil {
+		provider = otel.GetMeterProvider()
+	}
+	meter := provider.Meter(
+		instrumentationName,
+		metric.WithInstrumentationVersion(instrumentationVersion),
+	)
+
+	duration, err := meter.Float64Histogram(
+		"messaging.process.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("Duration of processing operation."),
+		metric.WithExplicitBucketBoundaries(processDurationBuckets...),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+	consumed, err := meter.Int64Counter(
+		"messaging.client.consumed.messages",
+		metric.WithUnit("{message}"),
+		metric.WithDescription("Number of messages that were delivered to the application."),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	return func(next kafkalight.MessageHandler) kafkalight.MessageHandler {
+		return func(ctx context.Context, msg *kafkalight.Message) error {
+			start := time.Now()
+			err := next(ctx, msg)
+
+			attrs := messagingAttributes(msg, "process", group)
+			if err != nil {
+				attrs = append(attrs, attribute.String("error.type", errorType(err)))
+			}
+			set := metric.WithAttributeSet(attribute.NewSet(attrs...))
+			duration.Record(ctx, time.Since(start).Seconds(), set)
+			consumed.Add(ctx, 1, set)
+			return err
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/overtonx/kafkalight"
+)
+
+func TestOTelMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	handler := OTelMetrics(provider, "billing")(func(ctx context.Context, msg *kafkalight.Message) error {
+		if string(msg.Value) == "bad" {
+			return fmt.Errorf("handle: %w", &kafkalight.DecodeError{Err: errors.New("boom")})
+		}
+		return nil
+	})
+
+	newMsg := func(value string) *kafkalight.Message {
+		return &kafkalight.Message{
+			TopicPartition: kafkalight.TopicPartition{Topic: "orders", Partition: 2, Offset: 7},
+			Value:          []byte(value),
+		}
+	}
+	require.NoError(t, handler(context.Background(), newMsg("ok")))
+	require.NoError(t, handler(context.Background(), newMsg("ok")))
+	require.Error(t, handler(context.Background(), newMsg("bad")))
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+	assert.Equal(t, instrumentationName, rm.ScopeMetrics[0].Scope.Name)
+
+	metrics := make(map[string]metricdata.Metrics)
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		metrics[m.Name] = m
+	}
+
+	base := attribute.NewSet(
+		attribute.String("messaging.system", "kafka"),
+		attribute.String("messaging.operation.type", "process"),
+		attribute.String("messaging.destination.name", "orders"),
+		attribute.Int("messaging.kafka.destination.partition", 2),
+		attribute.String("messaging.consumer.group.name", "billing"),
+	)
+	failed := attribute.NewSet(append(base.ToSlice(), attribute.String("error.type", "*kafkalight.DecodeError"))...)
+
+	consumed, ok := metrics["messaging.client.consumed.messages"].Data.(metricdata.Sum[int64])
+	require.True(t, ok)
+	counts := make(map[attribute.Distinct]int64)
+	for _, dp := range consumed.DataPoints {
+		counts[dp.Attributes.Equivalent()] = dp.Value
+	}
+	assert.Equal(t, int64(2), counts[base.Equivalent()])
+	assert.Equal(t, int64(1), counts[failed.Equivalent()])
+
+	duration, ok := metrics["messaging.process.duration"].Data.(metricdata.Histogram[float64])
+	require.True(t, ok)
+	assert.Equal(t, "s", metrics["messaging.process.duration"].Unit)
+	require.Len(t, duration.DataPoints, 2)
+	for _, dp := range duration.DataPoints {
+		assert.Equal(t, processDurationBuckets, dp.Bounds)
+		if dp.Attributes.Equivalent() == base.Equivalent() {
+			assert.Equal(t, uint64(2), dp.Count)
+		} else {
+			assert.Equal(t, uint64(1), dp.Count)
+		}
+	}
+}
+
+func TestErrorType(t *testing.T) {
+	assert.Equal(t, "*errors.errorString", errorType(errors.New("x")))
+	assert.Equal(t, "*kafkalight.PermanentError", errorType(fmt.Errorf("a: %w", fmt.Errorf("b: %w", kafkalight.Permanent(errors.New("x"))))))
+}
@@ -4,22 +4,178 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"runtime/debug"
+
+	"go.uber.org/zap"
 
 	"github.com/overtonx/kafkalight"
+	"github.com/overtonx/kafkalight/redact"
 )
 
-// Recovery is a middleware that recovers from panics, logs the panic, and returns an error.
-func Recovery() kafkalight.Middleware {
+// PanicError is returned by Recovery for messages whose handler panicked.
+type PanicError struct {
+	TopicPartition kafkalight.TopicPartition
+	// Value is the value passed to panic.
+	Value any
+	// Stack is the stack trace of the panicking goroutine, captured with WithStack.
+	Stack []byte
+
+	permanent bool
+	redacted  bool
+}
+
+// Error returns the panic value, or only its type if a redaction policy was
+// in effect, since the value may be derived from the payload.
+func (e *PanicError) Error() string {
+	if e.redacted {
+		return fmt.Sprintf("panic: value of type %T", e.Value)
+	}
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Unwrap returns the panic value if it is an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// Permanent implements the permanent error class of kafkalight. Panics are
+// retryable unless Recovery is configured with WithPermanentPanics.
+func (e *PanicError) Permanent() bool {
+	return e.permanent
+}
+
+// recoveryConfig holds the configuration of the recovery middleware.
+type recoveryConfig struct {
+	logger    *zap.Logger
+	useZap    bool
+	stack     bool
+	onPanic   func(ctx context.Context, msg *kafkalight.Message, value any, stack []byte)
+	permanent bool
+	redaction *redact.Policy
+}
+
+// RecoveryOption configures the recovery middleware.
+type RecoveryOption func(*recoveryConfig)
+
+// WithRecoveryLogger logs recovered panics to logger instead of the standard
+// log package. A nil logger uses kafkalight.LoggerFromContext.
+func WithRecoveryLogger(logger *zap.Logger) RecoveryOption {
+	return func(c *recoveryConfig) {
+		c.logger = logger
+		c.useZap = true
+	}
+}
+
+// WithStack captures the stack trace of panics with debug.Stack. It is logged,
+// passed to OnPanic and stored in PanicError.Stack.
+func WithStack() RecoveryOption {
+	return func(c *recoveryConfig) {
+		c.stack = true
+	}
+}
+
+// OnPanic calls fn for every recovered panic, e.g. for alerting. stack is nil
+// unless WithStack is used.
+func OnPanic(fn func(ctx context.Context, msg *kafkalight.Message, value any, stack []byte)) RecoveryOption {
+	return func(c *recoveryConfig) {
+		c.onPanic = fn
+	}
+}
+
+// WithPermanentPanics makes panics permanent failures, so that a router
+// configured with kafkalight.WithCommitOnPermanentError commits the offset of
+// the message instead of delivering it again after a restart.
+func WithPermanentPanics() RecoveryOption {
+	return func(c *recoveryConfig) {
+		c.permanent = true
+	}
+}
+
+// WithRecoveryRedaction redacts the logged message key according to policy.
+// By default the policy of the context is used, see kafkalight.WithRedaction.
+// While a policy is in effect, only the type of the panic value is logged and
+// returned in the PanicError message, as the value may contain message data.
+func WithRecoveryRedaction(policy *redact.Policy) RecoveryOption {
+	return func(c *recoveryConfig) {
+		c.redaction = policy
+	}
+}
+
+// Recovery is a middleware that recovers from panics in the handler, logs
+// them and returns a *PanicError.
+func Recovery(opts ...RecoveryOption) kafkalight.Middleware {
+	cfg := &recoveryConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
 	return func(next kafkalight.MessageHandler) kafkalight.MessageHandler {
 		return func(ctx context.Context, msg *kafkalight.Message) (err error) {
 			defer func() {
-				if r := recover(); r != nil {
-					err = fmt.Errorf("panic: %v", r)
-					log.Printf("recovered from panic: %v", r)
+				r := recover()
+				if r == nil {
+					return
+				}
+				// A panic raised again by kafkalight.TimeoutHandler carries
+				// the stack of the goroutine that panicked.
+				var stack []byte
+				if p, ok := r.(*kafkalight.HandlerPanic); ok {
+					r, stack = p.Value, p.Stack
+				}
+
+				policy := cfg.redaction
+				if policy == nil {
+					policy = kafkalight.RedactionFromContext(ctx)
+				}
+				panicErr := &PanicError{
+					TopicPartition: msg.TopicPartition,
+					Value:          r,
+					permanent:      cfg.permanent,
+					redacted:       policy != nil,
+				}
+				if cfg.stack {
+					if stack == nil {
+						stack = debug.Stack()
+					}
+					panicErr.Stack = stack
 				}
+				cfg.log(ctx, msg, panicErr, policy)
+				if cfg.onPanic != nil {
+					cfg.onPanic(ctx, msg, r, panicErr.Stack)
+				}
+				err = panicErr
 			}()
 
 			return next(ctx, msg)
 		}
 	}
 }
+
+func (c *recoveryConfig) log(ctx context.Context, msg *kafkalight.Message, e *PanicError, policy *redact.Policy) {
+	if !c.useZap {
+		if e.Stack != nil {
+			log.Printf("recovered from %v\n%s", e, e.Stack)
+		} else {
+			log.Printf("recovered from %v", e)
+		}
+		return
+	}
+
+	if policy != nil {
+		ctx = kafkalight.ContextWithRedaction(ctx, policy)
+	}
+	if c.logger != nil {
+		ctx = kafkalight.ContextWithMessage(kafkalight.ContextWithLogger(ctx, c.logger), msg)
+	}
+	logger := kafkalight.LoggerFromContext(ctx)
+
+	fields := []zap.Field{zap.Any("panic", e.Value)}
+	if e.redacted {
+		fields = []zap.Field{zap.String("panic_type", fmt.Sprintf("%T", e.Value))}
+	}
+	if e.Stack != nil {
+		fields = append(fields, zap.ByteString("stack", e.Stack))
+	}
+	logger.Error("recovered from panic", fields...)
+}
@@ -6,8 +6,13 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 
 	"github.com/overtonx/kafkalight"
+	"github.com/overtonx/kafkalight/redact"
 )
 
 func TestRecovery(t *testing.T) {
@@ -56,3 +61,75 @@ func TestRecovery(t *testing.T) {
 		assert.Equal(t, expectedErr, err)
 	})
 }
+
+func TestRecovery_Options(t *testing.T) {
+	msg := &kafkalight.Message{TopicPartition: kafkalight.TopicPartition{Topic: "orders", Partition: 2, Offset: 7}}
+	cause := errors.New("boom")
+	panicking := func(context.Context, *kafkalight.Message) error {
+		panic(cause)
+	}
+
+	t.Run("logs with zap and calls OnPanic", func(t *testing.T) {
+		core, recorded := observer.New(zapcore.InfoLevel)
+		var (
+			gotValue any
+			gotStack []byte
+		)
+		handler := Recovery(
+			WithRecoveryLogger(zap.New(core)),
+			WithStack(),
+			OnPanic(func(_ context.Context, _ *kafkalight.Message, value any, stack []byte) {
+				gotValue, gotStack = value, stack
+			}),
+		)(panicking)
+
+		err := handler(context.Background(), msg)
+
+		var panicErr *PanicError
+		require.ErrorAs(t, err, &panicErr)
+		assert.Equal(t, msg.TopicPartition, panicErr.TopicPartition)
+		assert.Equal(t, cause, panicErr.Value)
+		assert.ErrorIs(t, err, cause)
+		assert.NotEmpty(t, panicErr.Stack)
+		assert.False(t, kafkalight.IsPermanent(err), "panics are retryable by default")
+		assert.Equal(t, cause, gotValue)
+		assert.Equal(t, panicErr.Stack, gotStack)
+
+		logs := recorded.TakeAll()
+		require.Len(t, logs, 1)
+		assert.Equal(t, zapcore.ErrorLevel, logs[0].Level)
+		fields := logs[0].ContextMap()
+		assert.Equal(t, "orders", fields["topic"])
+		assert.Contains(t, fields["stack"], "runtime/debug.Stack")
+	})
+
+	t.Run("redaction", func(t *testing.T) {
+		core, recorded := observer.New(zapcore.InfoLevel)
+		key, err := kafkalight.NewKey("customer-1")
+		require.NoError(t, err)
+		keyed := &kafkalight.Message{TopicPartition: msg.TopicPartition, Key: *key}
+		leaking := func(context.Context, *kafkalight.Message) error {
+			panic("card 4111111111111111")
+		}
+
+		ctx := kafkalight.ContextWithRedaction(context.Background(), redact.New(redact.MessageKey(redact.Mask)))
+		err = Recovery(WithRecoveryLogger(zap.New(core)))(leaking)(ctx, keyed)
+		assert.NotContains(t, err.Error(), "4111")
+
+		logs := recorded.TakeAll()
+		require.Len(t, logs, 1)
+		fields := logs[0].ContextMap()
+		assert.Equal(t, redact.DefaultMask, fields["key"], "the policy of the context is used")
+		assert.Equal(t, "string", fields["panic_type"])
+		assert.NotContains(t, fields, "panic")
+	})
+
+	t.Run("permanent panics", func(t *testing.T) {
+		err := Recovery(WithPermanentPanics(), WithRecoveryLogger(zap.NewNop()))(panicking)(context.Background(), msg)
+
+		var panicErr *PanicError
+		require.ErrorAs(t, err, &panicErr)
+		assert.Nil(t, panicErr.Stack, "the stack is captured only with WithStack")
+		assert.True(t, kafkalight.IsPermanent(err))
+	})
+}
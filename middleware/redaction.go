@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"context"
+	"slices"
+
+	"github.com/overtonx/kafkalight"
+	"github.com/overtonx/kafkalight/redact"
+)
+
+// RedactHeaders is a producer middleware that redacts the headers of outgoing
+// messages according to policy, e.g. on a producer that copies failed
+// messages with their headers to a dead letter topic. The headers of msg
+// itself are left untouched. A nil policy uses the policy of the context, so
+// a producer called from a handler follows kafkalight.WithRedaction.
+func RedactHeaders(policy *redact.Policy) kafkalight.ProducerMiddleware {
+	return func(next kafkalight.Producer) kafkalight.Producer {
+		return kafkalight.ProducerFunc(func(ctx context.Context, msg *kafkalight.Message) error {
+			policy := policy
+			if policy == nil {
+				policy = kafkalight.RedactionFromContext(ctx)
+			}
+
+			out := *msg
+			out.Headers = slices.Clone(msg.Headers)
+			var dropped []string
+			for i, h := range out.Headers {
+				value, ok := policy.Header(h.Key, h.Value)
+				if !ok {
+					dropped = append(dropped, h.Key)
+					continue
+				}
+				out.Headers[i].Value = value
+			}
+			out.DelHeader(dropped...)
+
+			err := next.Produce(ctx, &out)
+			msg.TopicPartition = out.TopicPartition
+			return err
+		})
+	}
+}
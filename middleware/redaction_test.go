@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/overtonx/kafkalight"
+	"github.com/overtonx/kafkalight/kafkalighttest"
+	"github.com/overtonx/kafkalight/redact"
+)
+
+var testPolicy = redact.New(
+	redact.Header("authorization", redact.Drop),
+	redact.Header("x-email", redact.Mask),
+	redact.MessageKey(redact.Mask),
+	redact.JSONPath("card", redact.Mask),
+)
+
+func sensitiveMessage(t *testing.T) *kafkalight.Message {
+	key, err := kafkalight.NewKey("customer-1")
+	require.NoError(t, err)
+	return &kafkalight.Message{
+		TopicPartition: kafkalight.TopicPartition{Topic: "payments"},
+		Key:            *key,
+		Value:          []byte(`{"card":"4111111111111111","amount":10}`),
+		Headers: []kafkalight.Header{
+			{Key: "authorization", Value: []byte("Bearer token")},
+			{Key: "x-email", Value: []byte("jane@example.com")},
+			{Key: "tenant", Value: []byte("acme")},
+		},
+	}
+}
+
+func TestLogger_Redaction(t *testing.T) {
+	core, recorded := observer.New(zap.InfoLevel)
+	mw := Logger(zap.New(core), WithLogHeaders(), WithLogPayload(100), WithLogRedaction(testPolicy))
+
+	require.NoError(t, mw(func(ctx context.Context, _ *kafkalight.Message) error {
+		kafkalight.LoggerFromContext(ctx).Info("handling")
+		return nil
+	})(context.Background(), sensitiveMessage(t)))
+
+	logs := recorded.TakeAll()
+	require.Len(t, logs, 2)
+	assert.Equal(t, redact.DefaultMask, logs[0].ContextMap()["key"], "the handler logger is redacted")
+	fields := logs[1].ContextMap()
+	assert.Equal(t, redact.DefaultMask, fields["key"])
+	assert.Equal(t, map[string]string{"x-email": redact.DefaultMask, "tenant": "acme"}, fields["headers"])
+	assert.Equal(t, `{"amount":10,"card":"[REDACTED]"}`, fields["payload"])
+}
+
+func TestTracing_Redaction(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	mw := TracingWithOptions(
+		WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))),
+		WithTracingHeaderAttribute("authorization", "app.authorization"),
+		WithTracingHeaderAttribute("x-email", "app.email"),
+		WithTracingMessageKey(),
+		WithTracingRedaction(testPolicy),
+	)
+	require.NoError(t, mw(func(context.Context, *kafkalight.Message) error { return nil })(context.Background(), sensitiveMessage(t)))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	attrs := make(map[string]any)
+	for _, kv := range spans[0].Attributes() {
+		attrs[string(kv.Key)] = kv.Value.AsInterface()
+	}
+	assert.NotContains(t, attrs, "app.authorization")
+	assert.Equal(t, redact.DefaultMask, attrs["app.email"])
+	assert.Equal(t, redact.DefaultMask, attrs["messaging.kafka.message.key"])
+}
+
+func TestRouterRedaction(t *testing.T) {
+	broker := kafkalighttest.NewBroker()
+	broker.CreateTopic("payments", 1)
+	msg := sensitiveMessage(t)
+	msg.TopicPartition.Partition = kafkalight.PartitionAny
+	broker.MustProduce(t, msg)
+
+	core, recorded := observer.New(zap.InfoLevel)
+	recorder := tracetest.NewSpanRecorder()
+	group := broker.ConsumerGroup("group")
+	router := kafkalighttest.NewRouter(t, group, kafkalight.WithLogger(zap.New(core)), kafkalight.WithRedaction(testPolicy))
+	router.Use(
+		Logger(nil, WithLogHeaders()),
+		TracingWithOptions(
+			WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))),
+			WithTracingHeaderAttribute("x-email", "app.email"),
+			WithTracingMessageKey(),
+		),
+	)
+	router.RegisterRoute("payments", func(context.Context, *kafkalight.Message) error { return nil })
+	kafkalighttest.Start(t, router)
+	group.WaitProcessed(t, 1)
+
+	// The middlewares have no policy of their own and use the router's.
+	logs := recorded.FilterMessage("processed message").All()
+	require.Len(t, logs, 1)
+	fields := logs[0].ContextMap()
+	assert.Equal(t, redact.DefaultMask, fields["key"])
+	assert.Equal(t, map[string]string{"x-email": redact.DefaultMask, "tenant": "acme"}, fields["headers"])
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	attrs := make(map[string]any)
+	for _, kv := range spans[0].Attributes() {
+		attrs[string(kv.Key)] = kv.Value.AsInterface()
+	}
+	assert.Equal(t, redact.DefaultMask, attrs["app.email"])
+	assert.Equal(t, redact.DefaultMask, attrs["messaging.kafka.message.key"])
+}
+
+func TestRedactHeaders(t *testing.T) {
+	var produced *kafkalight.Message
+	producer := kafkalight.WrapProducer(kafkalight.ProducerFunc(func(_ context.Context, msg *kafkalight.Message) error {
+		produced = msg
+		return nil
+	}), RedactHeaders(testPolicy))
+
+	msg := sensitiveMessage(t)
+	require.NoError(t, producer.Produce(context.Background(), msg))
+	assert.Equal(t, []kafkalight.Header{
+		{Key: "x-email", Value: []byte(redact.DefaultMask)},
+		{Key: "tenant", Value: []byte("acme")},
+	}, produced.Headers)
+	assert.Equal(t, "customer-1", produced.Key.String(), "keys are kept for partitioning")
+	assert.Len(t, msg.Headers, 3)
+}
@@ -0,0 +1,17 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/overtonx/kafkalight"
+)
+
+// Timeout is a middleware that limits the handler to d and returns an error
+// wrapping kafkalight.ErrHandlerTimeout when it does not finish in time.
+// Handlers that keep running after the deadline are logged.
+// See kafkalight.TimeoutHandler.
+func Timeout(d time.Duration) kafkalight.Middleware {
+	return func(next kafkalight.MessageHandler) kafkalight.MessageHandler {
+		return kafkalight.TimeoutHandler(next, d)
+	}
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/overtonx/kafkalight"
+	"github.com/overtonx/kafkalight/kafkalighttest"
+)
+
+func TestTimeout(t *testing.T) {
+	handler := Timeout(10 * time.Millisecond)(func(ctx context.Context, msg *kafkalight.Message) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	err := handler(context.Background(), &kafkalight.Message{TopicPartition: kafkalight.TopicPartition{Topic: "orders"}})
+	assert.ErrorIs(t, err, kafkalight.ErrHandlerTimeout)
+	assert.Contains(t, err.Error(), "orders[0]@0")
+}
+
+func TestRouter_HandlerTimeoutInsideMiddlewares(t *testing.T) {
+	core, recorded := observer.New(zap.InfoLevel)
+	router := kafkalighttest.NewRouter(t, kafkalighttest.NewBroker().ConsumerGroup("group"))
+	router.Use(Logger(zap.New(core)))
+	router.RegisterRoute("orders", func(ctx context.Context, _ *kafkalight.Message) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, kafkalight.WithHandlerTimeout(10*time.Millisecond))
+
+	err := router.Dispatch(context.Background(), kafkalighttest.NewMessage("orders", "", "a"))
+	assert.ErrorIs(t, err, kafkalight.ErrHandlerTimeout)
+
+	logs := recorded.FilterMessage("processed message").All()
+	require.Len(t, logs, 1, "Logger sees the timeout")
+	assert.Equal(t, zap.ErrorLevel, logs[0].Level)
+	assert.Contains(t, logs[0].ContextMap()["error"], kafkalight.ErrHandlerTimeout.Error())
+}
+
+func TestTimeout_RecoveryStack(t *testing.T) {
+	handler := Recovery(WithStack(), WithRecoveryLogger(zap.NewNop()))(Timeout(time.Second)(func(context.Context, *kafkalight.Message) error {
+		panicInHandler()
+		return nil
+	}))
+
+	err := handler(context.Background(), &kafkalight.Message{})
+	var panicErr *PanicError
+	require.ErrorAs(t, err, &panicErr)
+	assert.Equal(t, "boom", panicErr.Value)
+	assert.Contains(t, string(panicErr.Stack), "panicInHandler", "the stack of the panicking frame is recorded")
+}
+
+func panicInHandler() {
+	panic("boom")
+}
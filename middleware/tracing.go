@@ -2,15 +2,20 @@ package middleware
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"reflect"
 	"runtime"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/overtonx/kafkalight"
+	"github.com/overtonx/kafkalight/redact"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -19,32 +24,184 @@ const (
 	instrumentationVersion = "v1.0.9"
 )
 
+// Tracing is a middleware that extracts the trace context from the message
+// headers and wraps the handler in a consumer span named after the handler.
+// It uses the global tracer provider and propagator; see TracingWithOptions
+// to configure them.
 func Tracing(consumerGroup ...string) kafkalight.Middleware {
-	group := ""
+	var opts []TracingOption
 	if len(consumerGroup) > 0 {
-		group = consumerGroup[0]
+		opts = append(opts, WithTracingConsumerGroup(consumerGroup[0]))
 	}
-	tracer := otel.Tracer(
+	return TracingWithOptions(opts...)
+}
+
+// tracingConfig holds the configuration of the tracing middleware.
+type tracingConfig struct {
+	provider    trace.TracerProvider
+	propagator  propagation.TextMapPropagator
+	group       string
+	spanName    func(msg *kafkalight.Message) string
+	headerAttrs map[string]string
+	attributes  []func(msg *kafkalight.Message) []attribute.KeyValue
+	filter      func(msg *kafkalight.Message) bool
+	recordSize  bool
+	recordKey   bool
+	redaction   *redact.Policy
+}
+
+// TracingOption configures TracingWithOptions.
+type TracingOption func(*tracingConfig)
+
+// WithTracerProvider sets the tracer provider. The default is the global one.
+func WithTracerProvider(provider trace.TracerProvider) TracingOption {
+	return func(c *tracingConfig) {
+		c.provider = provider
+	}
+}
+
+// WithPropagator sets the propagator used to extract the trace context from
+// message headers. The default is the global one.
+func WithPropagator(propagator propagation.TextMapPropagator) TracingOption {
+	return func(c *tracingConfig) {
+		c.propagator = propagator
+	}
+}
+
+// WithTracingConsumerGroup sets the messaging.consumer.group.name attribute.
+func WithTracingConsumerGroup(group string) TracingOption {
+	return func(c *tracingConfig) {
+		c.group = group
+	}
+}
+
+// WithSpanName sets the function naming the span of each message, such as
+// SemconvSpanName. By default spans are named after the handler.
+func WithSpanName(fn func(msg *kafkalight.Message) string) TracingOption {
+	return func(c *tracingConfig) {
+		c.spanName = fn
+	}
+}
+
+// SemconvSpanName names spans "process <topic>" as recommended by the
+// messaging semantic conventions.
+func SemconvSpanName(msg *kafkalight.Message) string {
+	return "process " + msg.TopicPartition.Topic
+}
+
+// WithTracingHeaderAttribute records the value of header as the span attribute
+// attr for messages that carry it.
+func WithTracingHeaderAttribute(header, attr string) TracingOption {
+	return func(c *tracingConfig) {
+		if c.headerAttrs == nil {
+			c.headerAttrs = make(map[string]string)
+		}
+		c.headerAttrs[header] = attr
+	}
+}
+
+// WithTracingAttributes adds the attributes returned by fn to the span of each message.
+func WithTracingAttributes(fn func(msg *kafkalight.Message) []attribute.KeyValue) TracingOption {
+	return func(c *tracingConfig) {
+		c.attributes = append(c.attributes, fn)
+	}
+}
+
+// WithTracingFilter traces only messages for which fn returns true. Other messages
+// are passed to the handler without a span or extracted trace context.
+func WithTracingFilter(fn func(msg *kafkalight.Message) bool) TracingOption {
+	return func(c *tracingConfig) {
+		c.filter = fn
+	}
+}
+
+// WithTracingSkipTopics skips tracing for messages of topics. It replaces WithTracingFilter.
+func WithTracingSkipTopics(topics ...string) TracingOption {
+	return WithTracingFilter(func(msg *kafkalight.Message) bool {
+		return !slices.Contains(topics, msg.TopicPartition.Topic)
+	})
+}
+
+// WithTracingMessageSize records the payload size as messaging.message.body.size.
+func WithTracingMessageSize() TracingOption {
+	return func(c *tracingConfig) {
+		c.recordSize = true
+	}
+}
+
+// WithTracingMessageKey records the message key as messaging.kafka.message.key.
+// Keys may contain personal data, so this is off by default.
+func WithTracingMessageKey() TracingOption {
+	return func(c *tracingConfig) {
+		c.recordKey = true
+	}
+}
+
+// WithTracingRedaction redacts the header attributes and the message key
+// recorded on spans according to policy. By default the policy of the
+// context is used, see kafkalight.WithRedaction.
+func WithTracingRedaction(policy *redact.Policy) TracingOption {
+	return func(c *tracingConfig) {
+		c.redaction = policy
+	}
+}
+
+// TracingWithOptions is the configurable form of Tracing.
+func TracingWithOptions(opts ...TracingOption) kafkalight.Middleware {
+	cfg := &tracingConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	provider := cfg.provider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	tracer := provider.Tracer(
 		instrumentationName,
 		trace.WithInstrumentationVersion(instrumentationVersion),
 	)
 
 	return func(next kafkalight.MessageHandler) kafkalight.MessageHandler {
-		spanName := handlerSpanName(next)
+		handlerName := handlerSpanName(next)
 		return func(ctx context.Context, msg *kafkalight.Message) error {
-			propagator := otel.GetTextMapPropagator()
+			if cfg.filter != nil && !cfg.filter(msg) {
+				return next(ctx, msg)
+			}
+
+			propagator := cfg.propagator
+			if propagator == nil {
+				propagator = otel.GetTextMapPropagator()
+			}
 			ctx = propagator.Extract(ctx, kafkalight.NewMessageCarrier(msg))
 
+			spanName := handlerName
+			if cfg.spanName != nil {
+				spanName = cfg.spanName(msg)
+			}
 			ctx, span := tracer.Start(ctx, spanName, trace.WithSpanKind(trace.SpanKindConsumer))
-			span.SetAttributes(
-				attribute.String("messaging.system", "kafka"),
-				attribute.String("messaging.operation.type", "process"),
-				attribute.String("messaging.destination.name", msg.TopicPartition.Topic),
-				attribute.Int("messaging.kafka.destination.partition", int(msg.TopicPartition.Partition)),
-				attribute.Int64("messaging.kafka.message.offset", msg.TopicPartition.Offset),
-			)
-			if group != "" {
-				span.SetAttributes(attribute.String("messaging.consumer.group.name", group))
+			span.SetAttributes(messagingAttributes(msg, "process", cfg.group)...)
+			span.SetAttributes(attribute.Int64("messaging.kafka.message.offset", msg.TopicPartition.Offset))
+			if cfg.recordSize {
+				span.SetAttributes(attribute.Int("messaging.message.body.size", len(msg.Value)))
+			}
+			policy := cfg.redaction
+			if policy == nil {
+				policy = kafkalight.RedactionFromContext(ctx)
+			}
+			if cfg.recordKey && msg.Key.Exists() {
+				if key, ok := policy.Key(msg.Key.Bytes()); ok {
+					span.SetAttributes(attribute.String("messaging.kafka.message.key", string(key)))
+				}
+			}
+			for header, attr := range cfg.headerAttrs {
+				if value, ok := msg.Header(header); ok {
+					if value, ok = policy.Header(header, value); ok {
+						span.SetAttributes(attribute.String(attr, string(value)))
+					}
+				}
+			}
+			for _, fn := range cfg.attributes {
+				span.SetAttributes(fn(msg)...)
 			}
 			defer span.End()
 
@@ -53,6 +210,7 @@ func Tracing(consumerGroup ...string) kafkalight.Middleware {
 			span.SetAttributes(attribute.Float64("messaging.process.duration_ms", float64(time.Since(start).Microseconds())/1000))
 			if err != nil {
 				span.RecordError(err)
+				span.SetAttributes(attribute.String("error.type", errorType(err)))
 				span.SetStatus(codes.Error, err.Error())
 				return err
 			}
@@ -63,6 +221,99 @@ func Tracing(consumerGroup ...string) kafkalight.Middleware {
 	}
 }
 
+// ProducerTracing is a producer middleware that starts a producer span named
+// "send <topic>" for each outgoing message and injects its context into the
+// message headers, so that consumers using Tracing continue the trace. The
+// headers of msg itself are left untouched. Of the tracing options it honours
+// WithTracerProvider, WithPropagator, WithTracingAttributes and
+// WithTracingFilter; by default it uses the global provider and propagator.
+func ProducerTracing(opts ...TracingOption) kafkalight.ProducerMiddleware {
+	cfg := &tracingConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	provider := cfg.provider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	tracer := provider.Tracer(
+		instrumentationName,
+		trace.WithInstrumentationVersion(instrumentationVersion),
+	)
+
+	return func(next kafkalight.Producer) kafkalight.Producer {
+		return kafkalight.ProducerFunc(func(ctx context.Context, msg *kafkalight.Message) error {
+			if cfg.filter != nil && !cfg.filter(msg) {
+				return next.Produce(ctx, msg)
+			}
+
+			ctx, span := tracer.Start(ctx, "send "+msg.TopicPartition.Topic,
+				trace.WithSpanKind(trace.SpanKindProducer),
+				trace.WithAttributes(messagingAttributes(msg, "send", "")...),
+			)
+			defer span.End()
+			for _, fn := range cfg.attributes {
+				span.SetAttributes(fn(msg)...)
+			}
+
+			propagator := cfg.propagator
+			if propagator == nil {
+				propagator = otel.GetTextMapPropagator()
+			}
+			out := *msg
+			out.Headers = append([]kafkalight.Header(nil), msg.Headers...)
+			propagator.Inject(ctx, kafkalight.NewMessageCarrier(&out))
+
+			err := next.Produce(ctx, &out)
+			msg.TopicPartition = out.TopicPartition
+			if err != nil {
+				span.RecordError(err)
+				span.SetAttributes(attribute.String("error.type", errorType(err)))
+				span.SetStatus(codes.Error, err.Error())
+				return err
+			}
+
+			span.SetAttributes(
+				attribute.Int("messaging.kafka.destination.partition", int(out.TopicPartition.Partition)),
+				attribute.Int64("messaging.kafka.message.offset", out.TopicPartition.Offset),
+			)
+			return nil
+		})
+	}
+}
+
+// messagingAttributes returns the messaging semantic convention attributes
+// shared by spans and metrics. The offset is left out to keep metric
+// cardinality low, and so is the partition of messages not yet assigned one.
+func messagingAttributes(msg *kafkalight.Message, operation, group string) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String("messaging.system", "kafka"),
+		attribute.String("messaging.operation.type", operation),
+		attribute.String("messaging.destination.name", msg.TopicPartition.Topic),
+	}
+	if msg.TopicPartition.Partition >= 0 {
+		attrs = append(attrs, attribute.Int("messaging.kafka.destination.partition", int(msg.TopicPartition.Partition)))
+	}
+	if group != "" {
+		attrs = append(attrs, attribute.String("messaging.consumer.group.name", group))
+	}
+	return attrs
+}
+
+// errorType returns the error.type attribute value for err: the type of the
+// first error in its chain that is not a plain fmt.Errorf wrapper, e.g.
+// "*kafkalight.DecodeError".
+func errorType(err error) string {
+	for {
+		t := fmt.Sprintf("%T", err)
+		next := errors.Unwrap(err)
+		if t != "*fmt.wrapError" || next == nil {
+			return t
+		}
+		err = next
+	}
+}
+
 // handlerSpanName derives a "Struct.Method" span name from a MessageHandler
 // function using runtime reflection. For plain functions it returns the
 // function name; for method receivers it strips the package path and pointer
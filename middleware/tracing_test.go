@@ -5,9 +5,12 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/propagation"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	"go.opentelemetry.io/otel/trace"
 
 	"github.com/overtonx/kafkalight"
@@ -52,3 +55,132 @@ func TestTracing(t *testing.T) {
 	assert.Equal(t, parentSpan.SpanContext().TraceID(), spanFromHandlerCtx.SpanContext().TraceID())
 	assert.NotEqual(t, parentSpan.SpanContext().SpanID(), spanFromHandlerCtx.SpanContext().SpanID())
 }
+
+func TestProducerTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var produced *kafkalight.Message
+	producer := kafkalight.WrapProducer(kafkalight.ProducerFunc(func(_ context.Context, msg *kafkalight.Message) error {
+		produced = msg
+		msg.TopicPartition.Partition = 2
+		msg.TopicPartition.Offset = 7
+		return nil
+	}), ProducerTracing())
+
+	// A re-published message still carries the traceparent of the consumed one.
+	msg := &kafkalight.Message{
+		TopicPartition: kafkalight.TopicPartition{Topic: "orders", Partition: kafkalight.PartitionAny},
+		Headers:        []kafkalight.Header{{Key: "traceparent", Value: []byte("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")}},
+	}
+	require.NoError(t, producer.Produce(context.Background(), msg))
+	assert.Equal(t, int32(2), msg.TopicPartition.Partition)
+	assert.Len(t, msg.Headers, 1, "the caller's message is not modified")
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	span := spans[0]
+	assert.Equal(t, "send orders", span.Name())
+	assert.Equal(t, trace.SpanKindProducer, span.SpanKind())
+	attrs := make(map[string]any)
+	for _, kv := range span.Attributes() {
+		attrs[string(kv.Key)] = kv.Value.AsInterface()
+	}
+	assert.Equal(t, "send", attrs["messaging.operation.type"])
+	assert.Equal(t, "orders", attrs["messaging.destination.name"])
+	assert.Equal(t, int64(2), attrs["messaging.kafka.destination.partition"])
+	assert.Equal(t, int64(7), attrs["messaging.kafka.message.offset"])
+
+	require.Len(t, produced.Headers, 1, "traceparent is replaced, not duplicated")
+	var consumerSpan trace.SpanContext
+	handler := Tracing()(func(ctx context.Context, _ *kafkalight.Message) error {
+		consumerSpan = trace.SpanContextFromContext(ctx)
+		return nil
+	})
+	require.NoError(t, handler(context.Background(), produced))
+	assert.Equal(t, span.SpanContext().TraceID(), consumerSpan.TraceID())
+	assert.Equal(t, span.SpanContext().SpanID(), recorder.Ended()[1].Parent().SpanID())
+}
+
+func TestProducerTracing_Options(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var produced []*kafkalight.Message
+	producer := kafkalight.WrapProducer(kafkalight.ProducerFunc(func(_ context.Context, msg *kafkalight.Message) error {
+		produced = append(produced, msg)
+		return nil
+	}), ProducerTracing(
+		WithTracerProvider(provider),
+		WithPropagator(propagation.Baggage{}),
+		WithTracingSkipTopics("heartbeats"),
+		WithTracingAttributes(func(msg *kafkalight.Message) []attribute.KeyValue {
+			return []attribute.KeyValue{attribute.String("app.topic", msg.TopicPartition.Topic)}
+		}),
+	))
+
+	require.NoError(t, producer.Produce(context.Background(), &kafkalight.Message{TopicPartition: kafkalight.TopicPartition{Topic: "orders"}}))
+	require.NoError(t, producer.Produce(context.Background(), &kafkalight.Message{TopicPartition: kafkalight.TopicPartition{Topic: "heartbeats"}}))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1, "filtered messages are not traced")
+	assert.Contains(t, spans[0].Attributes(), attribute.String("app.topic", "orders"))
+	require.Len(t, produced, 2)
+	_, ok := produced[0].Header("traceparent")
+	assert.False(t, ok, "the configured propagator is used instead of the global one")
+}
+
+func TestTracingWithOptions(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	propagator := propagation.TraceContext{}
+
+	parentCtx, parent := provider.Tracer("producer").Start(context.Background(), "send")
+	parent.End()
+	key, err := kafkalight.NewKey("customer-1")
+	require.NoError(t, err)
+	msg := &kafkalight.Message{
+		TopicPartition: kafkalight.TopicPartition{Topic: "orders", Partition: 1, Offset: 3},
+		Key:            *key,
+		Value:          []byte("payload"),
+		Headers:        []kafkalight.Header{{Key: "tenant", Value: []byte("acme")}},
+	}
+	propagator.Inject(parentCtx, kafkalight.NewMessageCarrier(msg))
+	recorder.Reset()
+
+	mw := TracingWithOptions(
+		WithTracerProvider(provider),
+		WithPropagator(propagator),
+		WithTracingConsumerGroup("billing"),
+		WithSpanName(SemconvSpanName),
+		WithTracingHeaderAttribute("tenant", "app.tenant"),
+		WithTracingAttributes(func(msg *kafkalight.Message) []attribute.KeyValue {
+			return []attribute.KeyValue{attribute.Bool("app.keyed", msg.Key.Exists())}
+		}),
+		WithTracingSkipTopics("audit"),
+		WithTracingMessageSize(),
+		WithTracingMessageKey(),
+	)
+	handler := mw(func(context.Context, *kafkalight.Message) error { return nil })
+
+	require.NoError(t, handler(context.Background(), msg))
+	require.NoError(t, handler(context.Background(), &kafkalight.Message{TopicPartition: kafkalight.TopicPartition{Topic: "audit"}}))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1, "skipped topics are not traced")
+	span := spans[0]
+	assert.Equal(t, "process orders", span.Name())
+	assert.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID())
+
+	attrs := make(map[string]any)
+	for _, kv := range span.Attributes() {
+		attrs[string(kv.Key)] = kv.Value.AsInterface()
+	}
+	assert.Equal(t, "billing", attrs["messaging.consumer.group.name"])
+	assert.Equal(t, "acme", attrs["app.tenant"])
+	assert.Equal(t, true, attrs["app.keyed"])
+	assert.Equal(t, int64(7), attrs["messaging.message.body.size"])
+	assert.Equal(t, "customer-1", attrs["messaging.kafka.message.key"])
+}
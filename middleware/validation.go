@@ -0,0 +1,234 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	neturl "net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+
+	"github.com/overtonx/kafkalight"
+)
+
+// DefaultEventTypeHeader is the header used to select a schema by event type.
+const DefaultEventTypeHeader = "event-type"
+
+// Violation is a single JSON Schema violation.
+type Violation struct {
+	// Path is the JSON pointer of the offending value, "" for the document root.
+	Path    string
+	Message string
+}
+
+// ValidationError is returned for messages that fail JSON Schema validation.
+// It is a permanent error.
+type ValidationError struct {
+	TopicPartition kafkalight.TopicPartition
+	// Schema identifies the schema that was applied, e.g. "topic:orders" or "event-type:order.created".
+	Schema     string
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		path := v.Path
+		if path == "" {
+			path = "/"
+		}
+		parts = append(parts, path+": "+v.Message)
+	}
+	return fmt.Sprintf("message %s[%d]@%d does not match schema %s: %s",
+		e.TopicPartition.Topic, e.TopicPartition.Partition, e.TopicPartition.Offset, e.Schema, strings.Join(parts, "; "))
+}
+
+// Permanent implements the permanent error class of kafkalight.
+func (e *ValidationError) Permanent() bool {
+	return true
+}
+
+// ValidationStats counts validation outcomes.
+type ValidationStats struct {
+	Valid   uint64
+	Invalid uint64
+	// Unmatched counts messages for which no schema is registered; they are passed through.
+	Unmatched uint64
+}
+
+type namedSchema struct {
+	name   string
+	schema *jsonschema.Schema
+}
+
+// JSONSchemas holds compiled JSON schemas registered per topic or per event
+// type, and counts validation outcomes.
+type JSONSchemas struct {
+	mu          sync.RWMutex
+	byTopic     map[string]namedSchema
+	byEventType map[string]namedSchema
+
+	valid     atomic.Uint64
+	invalid   atomic.Uint64
+	unmatched atomic.Uint64
+}
+
+// NewJSONSchemas creates an empty schema set.
+func NewJSONSchemas() *JSONSchemas {
+	return &JSONSchemas{
+		byTopic:     make(map[string]namedSchema),
+		byEventType: make(map[string]namedSchema),
+	}
+}
+
+// AddTopic compiles schema and applies it to messages of topic.
+func (s *JSONSchemas) AddTopic(topic string, schema []byte) error {
+	compiled, err := compileJSONSchema("topic:"+topic, schema)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.byTopic[topic] = compiled
+	return nil
+}
+
+// AddEventType compiles schema and applies it to messages whose event-type
+// header equals eventType. Event type schemas take precedence over topic schemas.
+func (s *JSONSchemas) AddEventType(eventType string, schema []byte) error {
+	compiled, err := compileJSONSchema("event-type:"+eventType, schema)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.byEventType[eventType] = compiled
+	return nil
+}
+
+// Stats returns the validation outcomes counted so far.
+func (s *JSONSchemas) Stats() ValidationStats {
+	return ValidationStats{
+		Valid:     s.valid.Load(),
+		Invalid:   s.invalid.Load(),
+		Unmatched: s.unmatched.Load(),
+	}
+}
+
+func (s *JSONSchemas) lookup(msg *kafkalight.Message, eventTypeHeader string) (namedSchema, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if eventType, ok := msg.Header(eventTypeHeader); ok {
+		if compiled, ok := s.byEventType[string(eventType)]; ok {
+			return compiled, true
+		}
+	}
+	compiled, ok := s.byTopic[msg.TopicPartition.Topic]
+	return compiled, ok
+}
+
+func compileJSONSchema(name string, schema []byte) (namedSchema, error) {
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(schema))
+	if err != nil {
+		return namedSchema{}, fmt.Errorf("invalid JSON schema %s: %w", name, err)
+	}
+
+	url := "mem:///" + neturl.PathEscape(name) + ".json"
+	c := jsonschema.NewCompiler()
+	if err := c.AddResource(url, doc); err != nil {
+		return namedSchema{}, fmt.Errorf("invalid JSON schema %s: %w", name, err)
+	}
+	compiled, err := c.Compile(url)
+	if err != nil {
+		return namedSchema{}, fmt.Errorf("invalid JSON schema %s: %w", name, err)
+	}
+	return namedSchema{name: name, schema: compiled}, nil
+}
+
+// validationConfig holds the configuration of the validation middleware.
+type validationConfig struct {
+	eventTypeHeader string
+}
+
+// ValidationOption configures the validation middleware.
+type ValidationOption func(*validationConfig)
+
+// WithEventTypeHeader sets the header used to select a schema by event type.
+func WithEventTypeHeader(header string) ValidationOption {
+	return func(c *validationConfig) {
+		c.eventTypeHeader = header
+	}
+}
+
+// ValidateJSONSchema is a middleware that validates Message.Value against the
+// schema registered for the message event type or topic. Messages that fail
+// validation are rejected with a *ValidationError listing the violated paths
+// and never reach the handler. Messages without a matching schema pass through.
+func ValidateJSONSchema(schemas *JSONSchemas, opts ...ValidationOption) kafkalight.Middleware {
+	cfg := &validationConfig{
+		eventTypeHeader: DefaultEventTypeHeader,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	return func(next kafkalight.MessageHandler) kafkalight.MessageHandler {
+		return func(ctx context.Context, msg *kafkalight.Message) error {
+			compiled, ok := schemas.lookup(msg, cfg.eventTypeHeader)
+			if !ok {
+				schemas.unmatched.Add(1)
+				return next(ctx, msg)
+			}
+
+			if violations := validateJSON(compiled.schema, msg.Value); len(violations) > 0 {
+				schemas.invalid.Add(1)
+				return &ValidationError{
+					TopicPartition: msg.TopicPartition,
+					Schema:         compiled.name,
+					Violations:     violations,
+				}
+			}
+
+			schemas.valid.Add(1)
+			return next(ctx, msg)
+		}
+	}
+}
+
+func validateJSON(schema *jsonschema.Schema, value []byte) []Violation {
+	inst, err := jsonschema.UnmarshalJSON(bytes.NewReader(value))
+	if err != nil {
+		return []Violation{{Message: fmt.Sprintf("invalid JSON: %v", err)}}
+	}
+
+	err = schema.Validate(inst)
+	if err == nil {
+		return nil
+	}
+	validationErr, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return []Violation{{Message: err.Error()}}
+	}
+
+	var violations []Violation
+	for _, unit := range validationErr.BasicOutput().Errors {
+		if unit.Error == nil {
+			continue
+		}
+		violations = append(violations, Violation{Path: unit.InstanceLocation, Message: unit.Error.String()})
+	}
+	if len(violations) == 0 {
+		violations = append(violations, Violation{Message: validationErr.Error()})
+	}
+	sort.SliceStable(violations, func(i, j int) bool {
+		return violations[i].Path < violations[j].Path
+	})
+	return violations
+}
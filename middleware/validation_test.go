@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/overtonx/kafkalight"
+)
+
+const orderSchema = `{
+	"type": "object",
+	"required": ["id", "items"],
+	"properties": {
+		"id": {"type": "integer"},
+		"items": {
+			"type": "array",
+			"items": {"type": "object", "required": ["sku"], "properties": {"sku": {"type": "string"}}}
+		}
+	}
+}`
+
+const refundSchema = `{"type": "object", "required": ["amount"]}`
+
+func TestValidateJSONSchema(t *testing.T) {
+	schemas := NewJSONSchemas()
+	require.NoError(t, schemas.AddTopic("orders", []byte(orderSchema)))
+	require.NoError(t, schemas.AddEventType("refund.created", []byte(refundSchema)))
+
+	var handlerCalled bool
+	handler := ValidateJSONSchema(schemas)(func(ctx context.Context, msg *kafkalight.Message) error {
+		handlerCalled = true
+		return nil
+	})
+
+	newMsg := func(topic, value string, headers ...kafkalight.Header) *kafkalight.Message {
+		return &kafkalight.Message{
+			TopicPartition: kafkalight.TopicPartition{Topic: topic, Partition: 1, Offset: 10},
+			Value:          []byte(value),
+			Headers:        headers,
+		}
+	}
+
+	t.Run("valid message", func(t *testing.T) {
+		handlerCalled = false
+		err := handler(context.Background(), newMsg("orders", `{"id":1,"items":[{"sku":"a"}]}`))
+
+		assert.NoError(t, err)
+		assert.True(t, handlerCalled)
+	})
+
+	t.Run("invalid message lists violated paths", func(t *testing.T) {
+		handlerCalled = false
+		err := handler(context.Background(), newMsg("orders", `{"id":"x","items":[{"sku":1}]}`))
+
+		var validationErr *ValidationError
+		require.ErrorAs(t, err, &validationErr)
+		assert.False(t, handlerCalled)
+		assert.True(t, kafkalight.IsPermanent(err))
+		assert.Equal(t, "topic:orders", validationErr.Schema)
+
+		var paths []string
+		for _, v := range validationErr.Violations {
+			paths = append(paths, v.Path)
+			assert.NotEmpty(t, v.Message)
+		}
+		assert.Equal(t, []string{"/id", "/items/0/sku"}, paths)
+	})
+
+	t.Run("invalid JSON", func(t *testing.T) {
+		err := handler(context.Background(), newMsg("orders", `{"id":`))
+
+		var validationErr *ValidationError
+		require.ErrorAs(t, err, &validationErr)
+		assert.Contains(t, validationErr.Violations[0].Message, "invalid JSON")
+	})
+
+	t.Run("event type schema takes precedence", func(t *testing.T) {
+		eventType := kafkalight.Header{Key: DefaultEventTypeHeader, Value: []byte("refund.created")}
+
+		err := handler(context.Background(), newMsg("orders", `{"amount":5}`, eventType))
+		assert.NoError(t, err)
+
+		err = handler(context.Background(), newMsg("orders", `{}`, eventType))
+		var validationErr *ValidationError
+		require.ErrorAs(t, err, &validationErr)
+		assert.Equal(t, "event-type:refund.created", validationErr.Schema)
+	})
+
+	t.Run("unmatched message passes through", func(t *testing.T) {
+		handlerCalled = false
+		err := handler(context.Background(), newMsg("payments", `not json`))
+
+		assert.NoError(t, err)
+		assert.True(t, handlerCalled)
+	})
+
+	t.Run("outcomes are counted", func(t *testing.T) {
+		assert.Equal(t, ValidationStats{Valid: 2, Invalid: 3, Unmatched: 1}, schemas.Stats())
+	})
+
+	t.Run("custom event type header", func(t *testing.T) {
+		custom := ValidateJSONSchema(schemas, WithEventTypeHeader("type"))(func(context.Context, *kafkalight.Message) error {
+			return nil
+		})
+
+		err := custom(context.Background(), newMsg("payments", `{}`, kafkalight.Header{Key: "type", Value: []byte("refund.created")}))
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid schema", func(t *testing.T) {
+		assert.Error(t, schemas.AddTopic("broken", []byte(`{"type": 5}`)))
+		assert.Error(t, schemas.AddTopic("broken", []byte(`not json`)))
+	})
+}
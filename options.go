@@ -32,3 +32,22 @@ func WithLogger(logger *zap.Logger) Option {
 		r.logger = logger.With(zap.String("module", "kafka-light"))
 	}
 }
+
+// WithCommitOnPermanentError makes the router commit the offset of a message
+// whose handler returned a permanent error, see IsPermanent, in manual commit
+// mode. Such messages are skipped instead of being read again after a
+// restart. By default no failed message is committed by the router.
+func WithCommitOnPermanentError() Option {
+	return func(r *KafkaRouter) {
+		r.commitPermanent = true
+	}
+}
+
+// WithConsumer makes the router read from the given consumer instead of
+// creating a *kafka.Consumer from the consumer config. The consumer config is
+// still used to detect enable.auto.commit.
+func WithConsumer(c Consumer) Option {
+	return func(r *KafkaRouter) {
+		r.consumer = c
+	}
+}
@@ -0,0 +1,91 @@
+package kafkalight
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// PartitionAny lets the producer choose the partition of an outgoing message.
+const PartitionAny = int32(kafka.PartitionAny)
+
+// Producer publishes messages to Kafka.
+// Message.TopicPartition.Partition selects the target partition; use
+// PartitionAny to let the partitioner pick one from the key.
+type Producer interface {
+	Produce(ctx context.Context, msg *Message) error
+}
+
+// ProducerFunc adapts an ordinary function to the Producer interface.
+type ProducerFunc func(ctx context.Context, msg *Message) error
+
+// Produce calls f(ctx, msg).
+func (f ProducerFunc) Produce(ctx context.Context, msg *Message) error {
+	return f(ctx, msg)
+}
+
+// ProducerMiddleware decorates a Producer, e.g. to transform outgoing messages.
+type ProducerMiddleware func(Producer) Producer
+
+// WrapProducer applies middlewares to p. As with KafkaRouter.Use, the first
+// middleware is the outermost one and sees each message first.
+func WrapProducer(p Producer, middleware ...ProducerMiddleware) Producer {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		p = middleware[i](p)
+	}
+	return p
+}
+
+var _ Producer = &KafkaProducer{}
+
+// KafkaProducer is a Producer backed by *kafka.Producer.
+type KafkaProducer struct {
+	producer *kafka.Producer
+}
+
+// NewProducer creates a KafkaProducer from the given config.
+func NewProducer(cfg *kafka.ConfigMap) (*KafkaProducer, error) {
+	p, err := kafka.NewProducer(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create producer: %w", err)
+	}
+	return &KafkaProducer{producer: p}, nil
+}
+
+// Produce sends msg and waits for its delivery report. On success the
+// partition and offset assigned by the broker are written back to msg.
+func (p *KafkaProducer) Produce(ctx context.Context, msg *Message) error {
+	deliveryCh := make(chan kafka.Event, 1)
+	if err := p.producer.Produce(convertStructToKafkaMessage(msg), deliveryCh); err != nil {
+		return fmt.Errorf("failed to produce message: %w", err)
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case e := <-deliveryCh:
+		delivered, ok := e.(*kafka.Message)
+		if !ok {
+			return fmt.Errorf("unexpected delivery event: %v", e)
+		}
+		if delivered.TopicPartition.Error != nil {
+			return fmt.Errorf("failed to deliver message: %w", delivered.TopicPartition.Error)
+		}
+		msg.TopicPartition.Partition = delivered.TopicPartition.Partition
+		msg.TopicPartition.Offset = int64(delivered.TopicPartition.Offset)
+		return nil
+	}
+}
+
+// Close flushes outstanding messages until ctx is done and closes the producer.
+func (p *KafkaProducer) Close(ctx context.Context) error {
+	for p.producer.Len() > 0 {
+		if ctx.Err() != nil {
+			break
+		}
+		p.producer.Flush(100)
+	}
+	p.producer.Close()
+	return ctx.Err()
+}
@@ -0,0 +1,34 @@
+package kafkalight
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrapProducer(t *testing.T) {
+	var order []string
+	tag := func(name string) ProducerMiddleware {
+		return func(next Producer) Producer {
+			return ProducerFunc(func(ctx context.Context, msg *Message) error {
+				order = append(order, name)
+				msg.Headers = append(msg.Headers, Header{Key: name})
+				return next.Produce(ctx, msg)
+			})
+		}
+	}
+
+	var sent *Message
+	base := ProducerFunc(func(ctx context.Context, msg *Message) error {
+		sent = msg
+		return nil
+	})
+
+	p := WrapProducer(base, tag("first"), tag("second"))
+	require.NoError(t, p.Produce(context.Background(), &Message{}))
+
+	assert.Equal(t, []string{"first", "second"}, order)
+	assert.Equal(t, []Header{{Key: "first"}, {Key: "second"}}, sent.Headers)
+}
@@ -0,0 +1,224 @@
+// Package redact provides a redaction policy for sensitive message data:
+// headers, keys and JSON payload fields are masked, hashed or dropped before
+// they are logged, recorded on spans or published to dead letter topics.
+//
+// A nil *Policy redacts nothing, so components can hold an optional policy
+// without nil checks.
+package redact
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+// DefaultMask replaces masked values.
+const DefaultMask = "[REDACTED]"
+
+// Action is what a policy does with a matched value.
+type Action int
+
+// Redaction actions.
+const (
+	// Mask replaces the value with the policy mask.
+	Mask Action = iota + 1
+	// Hash replaces the value with "sha256:" and the first 16 hex digits of
+	// its SHA-256 hash, or of its HMAC-SHA256 with WithHashKey, so equal
+	// values can still be correlated.
+	Hash
+	// Drop removes the value.
+	Drop
+)
+
+type pathRule struct {
+	segments []string
+	action   Action
+}
+
+// Policy decides how sensitive values are redacted.
+type Policy struct {
+	headers map[string]Action
+	paths   []pathRule
+	key     Action
+	mask    string
+	hashKey []byte
+}
+
+// Option configures a Policy.
+type Option func(*Policy)
+
+// Header redacts the header with the given name, compared case-insensitively.
+func Header(name string, action Action) Option {
+	return func(p *Policy) {
+		p.headers[strings.ToLower(name)] = action
+	}
+}
+
+// JSONPath redacts the JSON payload field at path, written as dot separated
+// object keys and array indexes with an optional "$." prefix, e.g.
+// "$.customer.email" or "items.*.card". "*" matches any key or index.
+func JSONPath(path string, action Action) Option {
+	return func(p *Policy) {
+		path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+		p.paths = append(p.paths, pathRule{segments: strings.Split(path, "."), action: action})
+	}
+}
+
+// MessageKey redacts message keys.
+func MessageKey(action Action) Option {
+	return func(p *Policy) {
+		p.key = action
+	}
+}
+
+// WithMask sets the replacement of masked values. The default is DefaultMask.
+func WithMask(mask string) Option {
+	return func(p *Policy) {
+		p.mask = mask
+	}
+}
+
+// WithHashKey makes Hash use HMAC-SHA256 with key, so that hashes of
+// low-entropy values such as phone numbers cannot be reversed by brute force.
+func WithHashKey(key []byte) Option {
+	return func(p *Policy) {
+		p.hashKey = key
+	}
+}
+
+// New creates a redaction policy.
+func New(opts ...Option) *Policy {
+	p := &Policy{
+		headers: make(map[string]Action),
+		mask:    DefaultMask,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Header returns the redacted value of the header name and false if the
+// header must be dropped.
+func (p *Policy) Header(name string, value []byte) ([]byte, bool) {
+	if p == nil {
+		return value, true
+	}
+	return p.redact(p.headers[strings.ToLower(name)], value)
+}
+
+// Key returns the redacted message key and false if it must be dropped.
+func (p *Policy) Key(key []byte) ([]byte, bool) {
+	if p == nil {
+		return key, true
+	}
+	return p.redact(p.key, key)
+}
+
+// JSON returns payload with the fields matching the JSON paths of the policy
+// redacted. Without JSON paths the payload is returned unchanged. If JSON
+// paths are configured but the payload is not valid JSON, and therefore
+// cannot be inspected, the whole payload is masked.
+func (p *Policy) JSON(payload []byte) []byte {
+	if p == nil || len(p.paths) == 0 {
+		return payload
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil || dec.More() {
+		return []byte(p.mask)
+	}
+	for _, rule := range p.paths {
+		doc = p.apply(doc, rule.segments, rule.action)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(doc); err != nil {
+		return []byte(p.mask)
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+}
+
+func (p *Policy) redact(action Action, value []byte) ([]byte, bool) {
+	switch action {
+	case Mask:
+		return []byte(p.mask), true
+	case Hash:
+		return []byte(p.hash(value)), true
+	case Drop:
+		return nil, false
+	default:
+		return value, true
+	}
+}
+
+func (p *Policy) hash(value []byte) string {
+	var h hash.Hash
+	if p.hashKey != nil {
+		h = hmac.New(sha256.New, p.hashKey)
+	} else {
+		h = sha256.New()
+	}
+	h.Write(value)
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// apply redacts the values at path below node and returns the new node.
+func (p *Policy) apply(node any, path []string, action Action) any {
+	segment, rest := path[0], path[1:]
+	switch n := node.(type) {
+	case map[string]any:
+		for key, child := range n {
+			if segment != "*" && segment != key {
+				continue
+			}
+			switch {
+			case len(rest) > 0:
+				n[key] = p.apply(child, rest, action)
+			case action == Drop:
+				delete(n, key)
+			default:
+				n[key] = p.redactJSON(child, action)
+			}
+		}
+		return n
+	case []any:
+		kept := make([]any, 0, len(n))
+		for i, child := range n {
+			if segment != "*" && segment != strconv.Itoa(i) {
+				kept = append(kept, child)
+				continue
+			}
+			switch {
+			case len(rest) > 0:
+				kept = append(kept, p.apply(child, rest, action))
+			case action == Drop:
+			default:
+				kept = append(kept, p.redactJSON(child, action))
+			}
+		}
+		return kept
+	default:
+		return node
+	}
+}
+
+func (p *Policy) redactJSON(value any, action Action) any {
+	if action == Mask {
+		return p.mask
+	}
+	if s, ok := value.(string); ok {
+		return p.hash([]byte(s))
+	}
+	raw, _ := json.Marshal(value)
+	return p.hash(raw)
+}
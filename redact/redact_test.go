@@ -0,0 +1,68 @@
+package redact
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy_Header(t *testing.T) {
+	p := New(
+		Header("Authorization", Drop),
+		Header("x-email", Mask),
+		Header("x-user-id", Hash),
+	)
+
+	_, keep := p.Header("authorization", []byte("Bearer token"))
+	assert.False(t, keep)
+
+	value, keep := p.Header("X-Email", []byte("jane@example.com"))
+	assert.True(t, keep)
+	assert.Equal(t, DefaultMask, string(value))
+
+	first, _ := p.Header("x-user-id", []byte("42"))
+	second, _ := p.Header("x-user-id", []byte("42"))
+	assert.Equal(t, first, second, "hashes can be correlated")
+	assert.Regexp(t, `^sha256:[0-9a-f]{16}$`, string(first))
+
+	keyed, _ := New(Header("x-user-id", Hash), WithHashKey([]byte("secret"))).Header("x-user-id", []byte("42"))
+	assert.NotEqual(t, first, keyed)
+
+	value, keep = p.Header("tenant", []byte("acme"))
+	assert.True(t, keep)
+	assert.Equal(t, "acme", string(value))
+}
+
+func TestPolicy_Key(t *testing.T) {
+	key, keep := New(MessageKey(Mask), WithMask("***")).Key([]byte("customer-1"))
+	assert.True(t, keep)
+	assert.Equal(t, "***", string(key))
+
+	key, _ = New().Key([]byte("customer-1"))
+	assert.Equal(t, "customer-1", string(key))
+}
+
+func TestPolicy_JSON(t *testing.T) {
+	p := New(
+		JSONPath("$.customer.email", Mask),
+		JSONPath("customer.phone", Hash),
+		JSONPath("items.*.card", Drop),
+		JSONPath("notes.1", Drop),
+	)
+
+	got := p.JSON([]byte(`{"id":1,"customer":{"email":"jane@example.com","phone":"+100","name":"Jane"},` +
+		`"items":[{"sku":"a","card":"4111"},{"sku":"b"}],"notes":["x","secret","y"],"amount":12.50}`))
+	assert.JSONEq(t, `{"id":1,"customer":{"email":"[REDACTED]","phone":"`+p.hash([]byte("+100"))+`","name":"Jane"},`+
+		`"items":[{"sku":"a"},{"sku":"b"}],"notes":["x","y"],"amount":12.50}`, string(got))
+
+	assert.Equal(t, DefaultMask, string(p.JSON([]byte("not json"))), "payloads that cannot be inspected are masked")
+	assert.Equal(t, "not json", string(New(Header("x", Mask)).JSON([]byte("not json"))))
+}
+
+func TestPolicy_Nil(t *testing.T) {
+	var p *Policy
+	value, keep := p.Header("authorization", []byte("token"))
+	assert.True(t, keep)
+	assert.Equal(t, "token", string(value))
+	assert.Equal(t, "payload", string(p.JSON([]byte("payload"))))
+}
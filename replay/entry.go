@@ -0,0 +1,101 @@
+// Package replay records consumed messages to JSON Lines files and replays
+// them through a router, so that handler behaviour can be compared against
+// golden files between versions.
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/overtonx/kafkalight"
+)
+
+// Entry is a single recorded message, stored as one line of a JSON Lines file.
+// Key, header values and Value are base64-encoded by encoding/json.
+type Entry struct {
+	Topic     string    `json:"topic"`
+	Partition int32     `json:"partition"`
+	Offset    int64     `json:"offset"`
+	Key       []byte    `json:"key,omitempty"`
+	Headers   []Header  `json:"headers,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	Value     []byte    `json:"value"`
+}
+
+// Header is a recorded message header.
+type Header struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// NewEntry captures msg as an Entry.
+func NewEntry(msg *kafkalight.Message) Entry {
+	e := Entry{
+		Topic:     msg.TopicPartition.Topic,
+		Partition: msg.TopicPartition.Partition,
+		Offset:    msg.TopicPartition.Offset,
+		Timestamp: msg.Timestamp,
+		Value:     msg.Value,
+	}
+	if msg.Key.Exists() {
+		e.Key = msg.Key.Bytes()
+	}
+	for _, h := range msg.Headers {
+		e.Headers = append(e.Headers, Header{Key: h.Key, Value: h.Value})
+	}
+	return e
+}
+
+// Message converts the entry back to a message.
+func (e Entry) Message() *kafkalight.Message {
+	key, _ := kafkalight.NewKey(append([]byte(nil), e.Key...))
+	msg := &kafkalight.Message{
+		TopicPartition: kafkalight.TopicPartition{
+			Topic:     e.Topic,
+			Partition: e.Partition,
+			Offset:    e.Offset,
+		},
+		Key:       *key,
+		Timestamp: e.Timestamp,
+		Value:     append([]byte(nil), e.Value...),
+	}
+	for _, h := range e.Headers {
+		msg.Headers = append(msg.Headers, kafkalight.Header{Key: h.Key, Value: append([]byte(nil), h.Value...)})
+	}
+	return msg
+}
+
+// ReadEntries reads all entries from a JSON Lines stream.
+func ReadEntries(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	err := readLines(r, func(line int, data []byte) error {
+		var e Entry
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		entries = append(entries, e)
+		return nil
+	})
+	return entries, err
+}
+
+// readLines calls fn for every non-empty line of r.
+func readLines(r io.Reader, fn func(line int, data []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		if err := fn(line, scanner.Bytes()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
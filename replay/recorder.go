@@ -0,0 +1,58 @@
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/overtonx/kafkalight"
+)
+
+// RecorderOption configures Recorder.
+type RecorderOption func(*recorderConfig)
+
+type recorderConfig struct {
+	logger *zap.Logger
+}
+
+// WithLogger sets the logger that reports failed writes. By default the
+// logger of the handler context is used, see kafkalight.LoggerFromContext.
+func WithLogger(logger *zap.Logger) RecorderOption {
+	return func(c *recorderConfig) {
+		c.logger = logger
+	}
+}
+
+// Recorder is a middleware that writes every message it sees to w as a JSON
+// Lines entry before passing it on. Writes are serialised, so w may be shared
+// between routes. A failed write is logged and does not affect processing.
+func Recorder(w io.Writer, opts ...RecorderOption) kafkalight.Middleware {
+	cfg := &recorderConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+
+	return func(next kafkalight.MessageHandler) kafkalight.MessageHandler {
+		return func(ctx context.Context, msg *kafkalight.Message) error {
+			mu.Lock()
+			err := enc.Encode(NewEntry(msg))
+			mu.Unlock()
+			if err != nil {
+				logger := cfg.logger
+				if logger == nil {
+					logger = kafkalight.LoggerFromContext(ctx)
+				} else {
+					logger = logger.With(kafkalight.RedactedMessageFields(msg, kafkalight.RedactionFromContext(ctx))...)
+				}
+				logger.Warn("replay: failed to record message", zap.Error(err))
+			}
+
+			return next(ctx, msg)
+		}
+	}
+}
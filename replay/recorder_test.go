@@ -0,0 +1,73 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/overtonx/kafkalight"
+)
+
+func TestRecorder(t *testing.T) {
+	var buf bytes.Buffer
+	key, _ := kafkalight.NewKey("order-1")
+	msg := &kafkalight.Message{
+		TopicPartition: kafkalight.TopicPartition{Topic: "orders", Partition: 2, Offset: 42},
+		Key:            *key,
+		Value:          []byte(`{"id":1}`),
+		Headers:        []kafkalight.Header{{Key: "event-type", Value: []byte("created")}},
+		Timestamp:      time.Date(2026, 4, 11, 10, 0, 0, 0, time.UTC),
+	}
+
+	var called bool
+	handler := Recorder(&buf)(func(ctx context.Context, msg *kafkalight.Message) error {
+		called = true
+		return nil
+	})
+
+	require.NoError(t, handler(context.Background(), msg))
+	require.NoError(t, handler(context.Background(), &kafkalight.Message{TopicPartition: kafkalight.TopicPartition{Topic: "orders"}}))
+	assert.True(t, called)
+
+	entries, err := ReadEntries(&buf)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	replayed := entries[0].Message()
+	assert.Equal(t, msg.TopicPartition, replayed.TopicPartition)
+	assert.Equal(t, "order-1", replayed.Key.String())
+	assert.Equal(t, msg.Value, replayed.Value)
+	assert.Equal(t, msg.Headers, replayed.Headers)
+	assert.True(t, msg.Timestamp.Equal(replayed.Timestamp))
+
+	assert.False(t, entries[1].Message().Key.Exists())
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestRecorder_WriteError(t *testing.T) {
+	core, recorded := observer.New(zapcore.WarnLevel)
+	handler := Recorder(failingWriter{}, WithLogger(zap.New(core)))(func(context.Context, *kafkalight.Message) error {
+		return nil
+	})
+
+	msg := &kafkalight.Message{TopicPartition: kafkalight.TopicPartition{Topic: "orders", Offset: 3}}
+	require.NoError(t, handler(context.Background(), msg), "a failed write does not affect processing")
+
+	logs := recorded.TakeAll()
+	require.Len(t, logs, 1)
+	assert.Equal(t, "orders", logs[0].ContextMap()["topic"])
+	assert.Equal(t, "disk full", logs[0].ContextMap()["error"])
+}
@@ -0,0 +1,98 @@
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/overtonx/kafkalight"
+)
+
+// Dispatcher runs a message through registered routes.
+// *kafkalight.KafkaRouter implements it.
+type Dispatcher interface {
+	Dispatch(ctx context.Context, msg *kafkalight.Message) error
+}
+
+var _ Dispatcher = &kafkalight.KafkaRouter{}
+
+// Result is the outcome of replaying a single entry.
+type Result struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Offset    int64  `json:"offset"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Replay feeds every entry read from r through d and returns the handler
+// result for each of them, in file order. Handler errors are captured in the
+// results; only read failures and context cancellation are returned as error.
+func Replay(ctx context.Context, r io.Reader, d Dispatcher) ([]Result, error) {
+	var results []Result
+	err := readLines(r, func(line int, data []byte) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var e Entry
+		if err := json.Unmarshal(data, &e); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+
+		res := Result{Topic: e.Topic, Partition: e.Partition, Offset: e.Offset}
+		if err := d.Dispatch(ctx, e.Message()); err != nil {
+			res.Error = err.Error()
+		}
+		results = append(results, res)
+		return nil
+	})
+	return results, err
+}
+
+// WriteResults writes results to w as JSON Lines, e.g. to create a golden file.
+func WriteResults(w io.Writer, results []Result) error {
+	enc := json.NewEncoder(w)
+	for _, res := range results {
+		if err := enc.Encode(res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadResults reads results written by WriteResults.
+func ReadResults(r io.Reader) ([]Result, error) {
+	var results []Result
+	err := readLines(r, func(line int, data []byte) error {
+		var res Result
+		if err := json.Unmarshal(data, &res); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		results = append(results, res)
+		return nil
+	})
+	return results, err
+}
+
+// Diff compares golden results with actual ones and describes every
+// difference. An empty slice means the behaviour is unchanged.
+func Diff(golden, actual []Result) []string {
+	var diffs []string
+	for i := 0; i < len(golden) || i < len(actual); i++ {
+		switch {
+		case i >= len(actual):
+			diffs = append(diffs, fmt.Sprintf("#%d %s: missing from actual results", i, golden[i].position()))
+		case i >= len(golden):
+			diffs = append(diffs, fmt.Sprintf("#%d %s: not in golden results", i, actual[i].position()))
+		case golden[i] != actual[i]:
+			diffs = append(diffs, fmt.Sprintf("#%d %s: golden error %q, actual %s error %q",
+				i, golden[i].position(), golden[i].Error, actual[i].position(), actual[i].Error))
+		}
+	}
+	return diffs
+}
+
+func (r Result) position() string {
+	return fmt.Sprintf("%s[%d]@%d", r.Topic, r.Partition, r.Offset)
+}
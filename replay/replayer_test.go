@@ -0,0 +1,65 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/overtonx/kafkalight"
+	"github.com/overtonx/kafkalight/kafkalighttest"
+)
+
+func TestReplay(t *testing.T) {
+	var recording bytes.Buffer
+	record := Recorder(&recording)(func(context.Context, *kafkalight.Message) error { return nil })
+	for _, value := range []string{"ok", "fail", "ok"} {
+		require.NoError(t, record(context.Background(), kafkalighttest.NewMessage("orders", "", value)))
+	}
+	require.NoError(t, record(context.Background(), kafkalighttest.NewMessage("unknown", "", "ok")))
+
+	broker := kafkalighttest.NewBroker()
+	router := kafkalighttest.NewRouter(t, broker.ConsumerGroup("replay"))
+	router.RegisterRoute("orders", func(_ context.Context, msg *kafkalight.Message) error {
+		if string(msg.Value) == "fail" {
+			return errors.New("rejected")
+		}
+		return nil
+	})
+
+	results, err := Replay(context.Background(), bytes.NewReader(recording.Bytes()), router)
+	require.NoError(t, err)
+	require.Len(t, results, 4)
+	assert.Empty(t, results[0].Error)
+	assert.Equal(t, "rejected", results[1].Error)
+	assert.Empty(t, results[2].Error)
+	assert.Contains(t, results[3].Error, kafkalight.ErrRouteNotFound.Error())
+
+	t.Run("golden round trip", func(t *testing.T) {
+		var golden bytes.Buffer
+		require.NoError(t, WriteResults(&golden, results))
+
+		read, err := ReadResults(&golden)
+		require.NoError(t, err)
+		assert.Empty(t, Diff(read, results))
+	})
+
+	t.Run("diff detects behaviour changes", func(t *testing.T) {
+		changed := append([]Result(nil), results[:3]...)
+		changed[1].Error = ""
+
+		diffs := Diff(results, changed)
+		require.Len(t, diffs, 2)
+		assert.Contains(t, diffs[0], `golden error "rejected"`)
+		assert.Contains(t, diffs[1], "missing from actual results")
+	})
+
+	t.Run("invalid line", func(t *testing.T) {
+		_, err := Replay(context.Background(), strings.NewReader("{}\nnot json\n"), router)
+		assert.ErrorContains(t, err, "line 2")
+	})
+}
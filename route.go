@@ -0,0 +1,71 @@
+package kafkalight
+
+import (
+	"context"
+	"reflect"
+	"time"
+)
+
+// RouteOption configures a single route registered with RegisterRoute.
+type RouteOption func(*route)
+
+// RouteInfo describes a registered route.
+type RouteInfo struct {
+	Topic string
+	// PayloadType is the type the route decodes payloads into, or nil if
+	// the route handles raw messages.
+	PayloadType reflect.Type
+	// Middleware names the router middlewares wrapping the handler,
+	// outermost first, e.g. "middleware.Logger".
+	Middleware []string
+	// Timeout is the handler timeout set with WithHandlerTimeout, 0 if none.
+	Timeout time.Duration
+}
+
+type route struct {
+	topic       string
+	handler     MessageHandler
+	payloadType reflect.Type
+	codec       Codec
+	middleware  []string
+	timeout     time.Duration
+}
+
+// WithDefaultCodec sets the codec used by Message.Bind and Typed handlers
+// without an explicit codec for messages of the route that carry no
+// content-type header.
+func WithDefaultCodec(c Codec) RouteOption {
+	return func(rt *route) {
+		rt.codec = c
+	}
+}
+
+func withPayloadType(t reflect.Type) RouteOption {
+	return func(rt *route) {
+		rt.payloadType = t
+	}
+}
+
+// handle runs msg through the route handler.
+func (rt *route) handle(ctx context.Context, msg *Message) error {
+	msg.codec = rt.codec
+	return rt.handler(ctx, msg)
+}
+
+// Routes returns the registered routes in registration order.
+func (r *KafkaRouter) Routes() []RouteInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	routes := make([]RouteInfo, 0, len(r.topics))
+	for _, topic := range r.topics {
+		rt := r.routes[topic]
+		routes = append(routes, RouteInfo{
+			Topic:       rt.topic,
+			PayloadType: rt.payloadType,
+			Middleware:  rt.middleware,
+			Timeout:     rt.timeout,
+		})
+	}
+	return routes
+}
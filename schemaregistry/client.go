@@ -0,0 +1,271 @@
+// Package schemaregistry decodes and encodes payloads in the Confluent Schema
+// Registry wire format: a zero magic byte and a 4-byte big-endian schema ID
+// followed by Avro, Protobuf or JSON Schema data.
+package schemaregistry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHTTPTimeout = 10 * time.Second
+	defaultLatestTTL   = 5 * time.Minute
+)
+
+// Error codes of the registry for schemas and subjects that do not exist.
+const (
+	errorCodeSubjectNotFound = 40401
+	errorCodeSchemaNotFound  = 40403
+)
+
+// SchemaType is the schema format registered in the registry.
+type SchemaType string
+
+const (
+	SchemaTypeAvro     SchemaType = "AVRO"
+	SchemaTypeProtobuf SchemaType = "PROTOBUF"
+	SchemaTypeJSON     SchemaType = "JSON"
+)
+
+// Schema is a schema registered in the registry.
+// Subject and Version are only set for schemas looked up by subject.
+type Schema struct {
+	ID      int
+	Type    SchemaType
+	Schema  string
+	Subject string
+	Version int
+}
+
+// SubjectVersion is a subject version under which a schema is registered.
+type SubjectVersion struct {
+	Subject string `json:"subject"`
+	Version int    `json:"version"`
+}
+
+// RegistryError is returned when the registry cannot be reached or answers
+// with an error. It is permanent only if the registry reports that the
+// subject or schema does not exist; other errors, including a 404 without
+// such an error code, e.g. from a wrong base URL or a proxy, are transient.
+type RegistryError struct {
+	StatusCode int
+	Code       int
+	Message    string
+	Err        error
+}
+
+func (e *RegistryError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("schema registry: %v", e.Err)
+	}
+	return fmt.Sprintf("schema registry: status %d, code %d: %s", e.StatusCode, e.Code, e.Message)
+}
+
+func (e *RegistryError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent classifies the error for kafkalight.IsPermanent.
+func (e *RegistryError) Permanent() bool {
+	return e.StatusCode == http.StatusNotFound &&
+		(e.Code == errorCodeSubjectNotFound || e.Code == errorCodeSchemaNotFound)
+}
+
+// Client is a caching Schema Registry REST client. Schemas are immutable once
+// registered, so lookups by ID are cached forever; the latest schema of a
+// subject is cached for 5 minutes, see WithLatestTTL.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	username   string
+	password   string
+	latestTTL  time.Duration
+
+	mu       sync.Mutex
+	schemas  map[int]*Schema
+	versions map[int][]SubjectVersion
+	latest   map[string]latestSchema
+}
+
+// latestSchema is a cached latest schema of a subject.
+type latestSchema struct {
+	schema    *Schema
+	fetchedAt time.Time
+}
+
+// ClientOption configures a Client.
+type ClientOption func(*Client)
+
+// WithHTTPClient sets the HTTP client used to talk to the registry.
+func WithHTTPClient(c *http.Client) ClientOption {
+	return func(cl *Client) {
+		cl.httpClient = c
+	}
+}
+
+// WithBasicAuth sets credentials for registries that require basic authentication.
+func WithBasicAuth(username, password string) ClientOption {
+	return func(cl *Client) {
+		cl.username = username
+		cl.password = password
+	}
+}
+
+// WithLatestTTL sets how long the latest schema of a subject is cached before
+// LatestSchema asks the registry again, so that new schema versions are
+// picked up. A TTL of 0 or less caches it for the lifetime of the client.
+func WithLatestTTL(d time.Duration) ClientOption {
+	return func(cl *Client) {
+		cl.latestTTL = d
+	}
+}
+
+// NewClient creates a client for the registry at baseURL.
+func NewClient(baseURL string, opts ...ClientOption) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: defaultHTTPTimeout},
+		latestTTL:  defaultLatestTTL,
+		schemas:    make(map[int]*Schema),
+		versions:   make(map[int][]SubjectVersion),
+		latest:     make(map[string]latestSchema),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+type schemaResponse struct {
+	ID         int    `json:"id"`
+	Subject    string `json:"subject"`
+	Version    int    `json:"version"`
+	Schema     string `json:"schema"`
+	SchemaType string `json:"schemaType"`
+}
+
+func (r schemaResponse) toSchema(id int) *Schema {
+	// The registry omits schemaType for Avro schemas.
+	schemaType := SchemaTypeAvro
+	if r.SchemaType != "" {
+		schemaType = SchemaType(r.SchemaType)
+	}
+	return &Schema{
+		ID:      id,
+		Type:    schemaType,
+		Schema:  r.Schema,
+		Subject: r.Subject,
+		Version: r.Version,
+	}
+}
+
+// SchemaByID returns the schema registered with the given ID.
+func (c *Client) SchemaByID(ctx context.Context, id int) (*Schema, error) {
+	c.mu.Lock()
+	schema, ok := c.schemas[id]
+	c.mu.Unlock()
+	if ok {
+		return schema, nil
+	}
+
+	var resp schemaResponse
+	if err := c.get(ctx, fmt.Sprintf("/schemas/ids/%d", id), &resp); err != nil {
+		return nil, err
+	}
+	schema = resp.toSchema(id)
+
+	c.mu.Lock()
+	c.schemas[id] = schema
+	c.mu.Unlock()
+	return schema, nil
+}
+
+// Versions returns the subject versions under which the schema ID is registered.
+func (c *Client) Versions(ctx context.Context, id int) ([]SubjectVersion, error) {
+	c.mu.Lock()
+	versions, ok := c.versions[id]
+	c.mu.Unlock()
+	if ok {
+		return versions, nil
+	}
+
+	if err := c.get(ctx, fmt.Sprintf("/schemas/ids/%d/versions", id), &versions); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.versions[id] = versions
+	c.mu.Unlock()
+	return versions, nil
+}
+
+// LatestSchema returns the latest schema registered under subject. The result
+// is cached for the TTL set with WithLatestTTL.
+func (c *Client) LatestSchema(ctx context.Context, subject string) (*Schema, error) {
+	c.mu.Lock()
+	cached, ok := c.latest[subject]
+	c.mu.Unlock()
+	if ok && (c.latestTTL <= 0 || time.Since(cached.fetchedAt) < c.latestTTL) {
+		return cached.schema, nil
+	}
+
+	var resp schemaResponse
+	if err := c.get(ctx, "/subjects/"+url.PathEscape(subject)+"/versions/latest", &resp); err != nil {
+		return nil, err
+	}
+	schema := resp.toSchema(resp.ID)
+
+	c.mu.Lock()
+	c.latest[subject] = latestSchema{schema: schema, fetchedAt: time.Now()}
+	c.schemas[schema.ID] = &Schema{ID: schema.ID, Type: schema.Type, Schema: schema.Schema}
+	c.mu.Unlock()
+	return schema, nil
+}
+
+func (c *Client) get(ctx context.Context, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return &RegistryError{Err: err}
+	}
+	req.Header.Set("Accept", "application/vnd.schemaregistry.v1+json")
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return &RegistryError{Err: err}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return &RegistryError{StatusCode: resp.StatusCode, Err: err}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		regErr := &RegistryError{StatusCode: resp.StatusCode, Message: string(body)}
+		var apiErr struct {
+			Code    int    `json:"error_code"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Message != "" {
+			regErr.Code = apiErr.Code
+			regErr.Message = apiErr.Message
+		}
+		return regErr
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return &RegistryError{StatusCode: resp.StatusCode, Err: fmt.Errorf("invalid response: %w", err)}
+	}
+	return nil
+}
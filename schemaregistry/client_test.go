@@ -0,0 +1,128 @@
+package schemaregistry
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/overtonx/kafkalight"
+)
+
+func TestClient(t *testing.T) {
+	reg := newTestRegistry(t,
+		testSchema{id: 1, subject: "orders-value", version: 1, schemaType: SchemaTypeAvro, schema: `"string"`},
+		testSchema{id: 2, subject: "orders-value", version: 2, schemaType: SchemaTypeJSON, schema: `{"type":"object"}`},
+	)
+	client := reg.client()
+	ctx := context.Background()
+
+	t.Run("schema by id is cached", func(t *testing.T) {
+		schema, err := client.SchemaByID(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, SchemaTypeAvro, schema.Type)
+		assert.Equal(t, `"string"`, schema.Schema)
+
+		requests := reg.requests.Load()
+		_, err = client.SchemaByID(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, requests, reg.requests.Load())
+	})
+
+	t.Run("versions", func(t *testing.T) {
+		versions, err := client.Versions(ctx, 2)
+		require.NoError(t, err)
+		assert.Equal(t, []SubjectVersion{{Subject: "orders-value", Version: 2}}, versions)
+	})
+
+	t.Run("latest schema", func(t *testing.T) {
+		schema, err := client.LatestSchema(ctx, "orders-value")
+		require.NoError(t, err)
+		assert.Equal(t, 2, schema.ID)
+		assert.Equal(t, 2, schema.Version)
+		assert.Equal(t, SchemaTypeJSON, schema.Type)
+	})
+
+	t.Run("not found is permanent", func(t *testing.T) {
+		_, err := client.SchemaByID(ctx, 404)
+
+		var regErr *RegistryError
+		require.ErrorAs(t, err, &regErr)
+		assert.Equal(t, 40403, regErr.Code)
+		assert.True(t, kafkalight.IsPermanent(err))
+	})
+
+	t.Run("404 without a registry error code is not permanent", func(t *testing.T) {
+		misconfigured := NewClient(reg.server.URL + "/wrong-prefix")
+		_, err := misconfigured.SchemaByID(ctx, 1)
+
+		var regErr *RegistryError
+		require.ErrorAs(t, err, &regErr)
+		assert.Equal(t, http.StatusNotFound, regErr.StatusCode)
+		assert.False(t, kafkalight.IsPermanent(err))
+	})
+
+	t.Run("server errors are not permanent", func(t *testing.T) {
+		broken := NewClient(reg.server.URL + "/broken")
+		_, err := broken.SchemaByID(ctx, 1)
+
+		require.Error(t, err)
+		assert.False(t, kafkalight.IsPermanent(err))
+	})
+
+	t.Run("lookups honour the context", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		_, err := NewClient(reg.server.URL+"/hung").SchemaByID(ctx, 1)
+
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.False(t, kafkalight.IsPermanent(err))
+	})
+
+	t.Run("unreachable registry is not permanent", func(t *testing.T) {
+		_, err := NewClient("http://127.0.0.1:1").SchemaByID(ctx, 1)
+
+		require.Error(t, err)
+		assert.False(t, kafkalight.IsPermanent(&kafkalight.DecodeError{Err: err}))
+	})
+}
+
+func TestClient_LatestTTL(t *testing.T) {
+	reg := newTestRegistry(t, testSchema{id: 1, subject: "orders-value", version: 1, schemaType: SchemaTypeAvro, schema: `"string"`})
+	ctx := context.Background()
+
+	cached := reg.client()
+	_, err := cached.LatestSchema(ctx, "orders-value")
+	require.NoError(t, err)
+	requests := reg.requests.Load()
+	_, err = cached.LatestSchema(ctx, "orders-value")
+	require.NoError(t, err)
+	assert.Equal(t, requests, reg.requests.Load(), "the latest schema is cached")
+
+	expiring := NewClient(reg.server.URL, WithLatestTTL(time.Nanosecond))
+	_, err = expiring.LatestSchema(ctx, "orders-value")
+	require.NoError(t, err)
+	requests = reg.requests.Load()
+	time.Sleep(time.Millisecond)
+	_, err = expiring.LatestSchema(ctx, "orders-value")
+	require.NoError(t, err)
+	assert.Equal(t, requests+1, reg.requests.Load(), "an expired latest schema is fetched again")
+}
+
+func TestParseHeader(t *testing.T) {
+	data := append(AppendHeader(nil, 258), "payload"...)
+
+	id, payload, err := ParseHeader(data)
+	require.NoError(t, err)
+	assert.Equal(t, 258, id)
+	assert.Equal(t, "payload", string(payload))
+
+	_, _, err = ParseHeader([]byte(`{"id":1}`))
+	assert.ErrorIs(t, err, ErrNotWireFormat)
+
+	_, _, err = ParseHeader([]byte{0, 0, 1})
+	assert.ErrorIs(t, err, ErrNotWireFormat)
+}
@@ -0,0 +1,227 @@
+package schemaregistry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/hamba/avro/v2"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/overtonx/kafkalight"
+)
+
+// Content types reported by Codec.ContentType.
+const (
+	ContentTypeAvro     = "application/vnd.confluent.avro"
+	ContentTypeProtobuf = "application/vnd.confluent.protobuf"
+	ContentTypeJSON     = "application/vnd.confluent.json"
+)
+
+var _ kafkalight.ContextCodec = &Codec{}
+
+// Codec is a kafkalight.Codec for payloads written by Confluent serializers.
+//
+// Unmarshal accepts Avro payloads into values supported by
+// github.com/hamba/avro, Protobuf payloads into proto.Message values and
+// JSON Schema payloads into anything encoding/json accepts. Marshal encodes
+// with the latest schema of the subject set by WithSubject.
+//
+// Payloads usually carry no content-type header, so the codec is typically
+// set per route with kafkalight.WithDefaultCodec. The codec implements
+// kafkalight.ContextCodec, so registry lookups made while decoding for Typed
+// handlers or Message.BindContext are bound to the handler context.
+type Codec struct {
+	client     *Client
+	schemaType SchemaType
+	subject    string
+
+	mu          sync.Mutex
+	avroSchemas map[int]avro.Schema
+}
+
+// CodecOption configures a Codec.
+type CodecOption func(*Codec)
+
+// WithSubject sets the subject whose latest schema is used by Marshal,
+// e.g. "<topic>-value" for the default topic name strategy.
+func WithSubject(subject string) CodecOption {
+	return func(c *Codec) {
+		c.subject = subject
+	}
+}
+
+// NewCodec creates a codec for payloads of the given schema type.
+func NewCodec(client *Client, schemaType SchemaType, opts ...CodecOption) *Codec {
+	c := &Codec{
+		client:      client,
+		schemaType:  schemaType,
+		avroSchemas: make(map[int]avro.Schema),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *Codec) ContentType() string {
+	switch c.schemaType {
+	case SchemaTypeProtobuf:
+		return ContentTypeProtobuf
+	case SchemaTypeJSON:
+		return ContentTypeJSON
+	default:
+		return ContentTypeAvro
+	}
+}
+
+// Unmarshal is UnmarshalContext with a background context.
+func (c *Codec) Unmarshal(data []byte, v any) error {
+	return c.UnmarshalContext(context.Background(), data, v)
+}
+
+// UnmarshalContext strips the wire-format header, fetches the writer schema
+// within ctx and decodes the payload into v.
+func (c *Codec) UnmarshalContext(ctx context.Context, data []byte, v any) error {
+	id, payload, err := ParseHeader(data)
+	if err != nil {
+		return err
+	}
+
+	schema, err := c.client.SchemaByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if schema.Type != c.schemaType {
+		return fmt.Errorf("schema %d is %s, expected %s", id, schema.Type, c.schemaType)
+	}
+
+	switch c.schemaType {
+	case SchemaTypeAvro:
+		avroSchema, err := c.avroSchema(schema)
+		if err != nil {
+			return err
+		}
+		return avro.Unmarshal(avroSchema, payload, v)
+	case SchemaTypeProtobuf:
+		m, ok := v.(proto.Message)
+		if !ok {
+			return fmt.Errorf("schema registry codec: %T does not implement proto.Message", v)
+		}
+		_, payload, err = parseMessageIndexes(payload)
+		if err != nil {
+			return err
+		}
+		return proto.Unmarshal(payload, m)
+	case SchemaTypeJSON:
+		return json.Unmarshal(payload, v)
+	default:
+		return fmt.Errorf("unsupported schema type %q", c.schemaType)
+	}
+}
+
+// Marshal is MarshalContext with a background context.
+func (c *Codec) Marshal(v any) ([]byte, error) {
+	return c.MarshalContext(context.Background(), v)
+}
+
+// MarshalContext encodes v with the latest schema of the configured subject,
+// fetched within ctx, and prepends the wire-format header. Protobuf values
+// are encoded as the first message type of the schema.
+func (c *Codec) MarshalContext(ctx context.Context, v any) ([]byte, error) {
+	if c.subject == "" {
+		return nil, errors.New("schema registry codec: no subject configured for encoding")
+	}
+
+	schema, err := c.client.LatestSchema(ctx, c.subject)
+	if err != nil {
+		return nil, err
+	}
+	if schema.Type != c.schemaType {
+		return nil, fmt.Errorf("subject %s is %s, expected %s", c.subject, schema.Type, c.schemaType)
+	}
+
+	out := AppendHeader(nil, schema.ID)
+	switch c.schemaType {
+	case SchemaTypeAvro:
+		avroSchema, err := c.avroSchema(schema)
+		if err != nil {
+			return nil, err
+		}
+		data, err := avro.Marshal(avroSchema, v)
+		if err != nil {
+			return nil, err
+		}
+		return append(out, data...), nil
+	case SchemaTypeProtobuf:
+		m, ok := v.(proto.Message)
+		if !ok {
+			return nil, fmt.Errorf("schema registry codec: %T does not implement proto.Message", v)
+		}
+		data, err := proto.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+		return append(append(out, 0), data...), nil
+	case SchemaTypeJSON:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return append(out, data...), nil
+	default:
+		return nil, fmt.Errorf("unsupported schema type %q", c.schemaType)
+	}
+}
+
+// Info describes the schema a message was written with.
+type Info struct {
+	ID      int
+	Type    SchemaType
+	Subject string
+	Version int
+}
+
+// Info returns the schema ID of msg and the subject version it is registered under.
+// If the codec has a subject, its version is preferred.
+func (c *Codec) Info(ctx context.Context, msg *kafkalight.Message) (*Info, error) {
+	id, _, err := ParseHeader(msg.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	schema, err := c.client.SchemaByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := c.client.Versions(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &Info{ID: id, Type: schema.Type}
+	for _, sv := range versions {
+		if info.Subject == "" || sv.Subject == c.subject {
+			info.Subject = sv.Subject
+			info.Version = sv.Version
+		}
+	}
+	return info, nil
+}
+
+func (c *Codec) avroSchema(schema *Schema) (avro.Schema, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if parsed, ok := c.avroSchemas[schema.ID]; ok {
+		return parsed, nil
+	}
+	parsed, err := avro.Parse(schema.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("invalid avro schema %d: %w", schema.ID, err)
+	}
+	c.avroSchemas[schema.ID] = parsed
+	return parsed, nil
+}
@@ -0,0 +1,140 @@
+package schemaregistry
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/hamba/avro/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/overtonx/kafkalight"
+)
+
+const orderAvroSchema = `{
+	"type": "record",
+	"name": "Order",
+	"fields": [
+		{"name": "id", "type": "long"},
+		{"name": "status", "type": "string"}
+	]
+}`
+
+type order struct {
+	ID     int64  `avro:"id" json:"id"`
+	Status string `avro:"status" json:"status"`
+}
+
+func TestCodec_Avro(t *testing.T) {
+	reg := newTestRegistry(t, testSchema{id: 7, subject: "orders-value", version: 3, schemaType: SchemaTypeAvro, schema: orderAvroSchema})
+	codec := NewCodec(reg.client(), SchemaTypeAvro, WithSubject("orders-value"))
+
+	data, err := avro.Marshal(avro.MustParse(orderAvroSchema), order{ID: 42, Status: "created"})
+	require.NoError(t, err)
+	value := append(AppendHeader(nil, 7), data...)
+
+	var got order
+	require.NoError(t, codec.Unmarshal(value, &got))
+	assert.Equal(t, order{ID: 42, Status: "created"}, got)
+
+	encoded, err := codec.Marshal(got)
+	require.NoError(t, err)
+	assert.Equal(t, value, encoded)
+
+	t.Run("typed handler with route default codec", func(t *testing.T) {
+		msg := &kafkalight.Message{Value: value}
+		handler := kafkalight.Typed(func(_ context.Context, _ *kafkalight.Message, evt order) error {
+			assert.Equal(t, int64(42), evt.ID)
+			return nil
+		}, codec)
+		assert.NoError(t, handler(context.Background(), msg))
+	})
+
+	t.Run("typed handler decodes within the handler context", func(t *testing.T) {
+		hung := NewCodec(NewClient(reg.server.URL+"/hung"), SchemaTypeAvro)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		handler := kafkalight.Typed(func(context.Context, *kafkalight.Message, order) error {
+			return nil
+		}, hung)
+		err := handler(ctx, &kafkalight.Message{Value: value})
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("schema info", func(t *testing.T) {
+		info, err := codec.Info(context.Background(), &kafkalight.Message{Value: value})
+		require.NoError(t, err)
+		assert.Equal(t, &Info{ID: 7, Type: SchemaTypeAvro, Subject: "orders-value", Version: 3}, info)
+	})
+}
+
+func TestCodec_Protobuf(t *testing.T) {
+	reg := newTestRegistry(t, testSchema{id: 8, subject: "names-value", version: 1, schemaType: SchemaTypeProtobuf, schema: `syntax = "proto3"; message StringValue { string value = 1; }`})
+	codec := NewCodec(reg.client(), SchemaTypeProtobuf, WithSubject("names-value"))
+
+	data, err := proto.Marshal(wrapperspb.String("alice"))
+	require.NoError(t, err)
+
+	t.Run("first message shorthand", func(t *testing.T) {
+		value := append(append(AppendHeader(nil, 8), 0), data...)
+
+		got := &wrapperspb.StringValue{}
+		require.NoError(t, codec.Unmarshal(value, got))
+		assert.Equal(t, "alice", got.GetValue())
+
+		encoded, err := codec.Marshal(got)
+		require.NoError(t, err)
+		assert.Equal(t, value, encoded)
+	})
+
+	t.Run("explicit message indexes", func(t *testing.T) {
+		value := AppendHeader(nil, 8)
+		value = binary.AppendVarint(value, 2)
+		value = binary.AppendVarint(value, 1)
+		value = binary.AppendVarint(value, 0)
+		value = append(value, data...)
+
+		got := &wrapperspb.StringValue{}
+		require.NoError(t, codec.Unmarshal(value, got))
+		assert.Equal(t, "alice", got.GetValue())
+	})
+
+	t.Run("requires proto message", func(t *testing.T) {
+		value := append(append(AppendHeader(nil, 8), 0), data...)
+		assert.Error(t, codec.Unmarshal(value, &order{}))
+	})
+}
+
+func TestCodec_JSONSchema(t *testing.T) {
+	reg := newTestRegistry(t, testSchema{id: 9, subject: "orders-value", version: 1, schemaType: SchemaTypeJSON, schema: `{"type":"object"}`})
+	codec := NewCodec(reg.client(), SchemaTypeJSON)
+
+	value := append(AppendHeader(nil, 9), `{"id":1,"status":"paid"}`...)
+
+	var got order
+	require.NoError(t, codec.Unmarshal(value, &got))
+	assert.Equal(t, order{ID: 1, Status: "paid"}, got)
+
+	t.Run("marshal requires subject", func(t *testing.T) {
+		_, err := codec.Marshal(got)
+		assert.Error(t, err)
+	})
+
+	t.Run("schema type mismatch", func(t *testing.T) {
+		avroCodec := NewCodec(reg.client(), SchemaTypeAvro)
+		assert.Error(t, avroCodec.Unmarshal(value, &got))
+	})
+
+	t.Run("not wire format is a permanent decode error", func(t *testing.T) {
+		handler := kafkalight.Typed(func(context.Context, *kafkalight.Message, order) error { return nil }, codec)
+		err := handler(context.Background(), &kafkalight.Message{Value: []byte(`{"id":1}`)})
+
+		assert.ErrorIs(t, err, ErrNotWireFormat)
+		assert.True(t, kafkalight.IsPermanent(err))
+	})
+}
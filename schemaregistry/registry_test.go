@@ -0,0 +1,102 @@
+package schemaregistry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// testRegistry is an httptest stand-in for the Schema Registry REST API.
+type testRegistry struct {
+	server   *httptest.Server
+	requests atomic.Int32
+}
+
+type testSchema struct {
+	id         int
+	subject    string
+	version    int
+	schemaType SchemaType
+	schema     string
+}
+
+func newTestRegistry(t *testing.T, schemas ...testSchema) *testRegistry {
+	t.Helper()
+
+	reg := &testRegistry{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /schemas/ids/{id}", func(w http.ResponseWriter, r *http.Request) {
+		reg.requests.Add(1)
+		s, ok := findSchema(schemas, r.PathValue("id"))
+		if !ok {
+			notFound(w)
+			return
+		}
+		resp := map[string]any{"schema": s.schema}
+		if s.schemaType != SchemaTypeAvro {
+			resp["schemaType"] = s.schemaType
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+	mux.HandleFunc("GET /schemas/ids/{id}/versions", func(w http.ResponseWriter, r *http.Request) {
+		reg.requests.Add(1)
+		s, ok := findSchema(schemas, r.PathValue("id"))
+		if !ok {
+			notFound(w)
+			return
+		}
+		_ = json.NewEncoder(w).Encode([]SubjectVersion{{Subject: s.subject, Version: s.version}})
+	})
+	mux.HandleFunc("GET /subjects/{subject}/versions/latest", func(w http.ResponseWriter, r *http.Request) {
+		reg.requests.Add(1)
+		var latest *testSchema
+		for i, s := range schemas {
+			if s.subject == r.PathValue("subject") && (latest == nil || s.version > latest.version) {
+				latest = &schemas[i]
+			}
+		}
+		if latest == nil {
+			notFound(w)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"id":         latest.id,
+			"subject":    latest.subject,
+			"version":    latest.version,
+			"schema":     latest.schema,
+			"schemaType": latest.schemaType,
+		})
+	})
+	mux.HandleFunc("/broken/", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	})
+	mux.HandleFunc("/hung/", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+
+	reg.server = httptest.NewServer(mux)
+	t.Cleanup(reg.server.Close)
+	return reg
+}
+
+func (r *testRegistry) client() *Client {
+	return NewClient(r.server.URL)
+}
+
+func findSchema(schemas []testSchema, id string) (testSchema, bool) {
+	for _, s := range schemas {
+		if fmt.Sprint(s.id) == strings.TrimSpace(id) {
+			return s, true
+		}
+	}
+	return testSchema{}, false
+}
+
+func notFound(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusNotFound)
+	_, _ = w.Write([]byte(`{"error_code":40403,"message":"Schema not found"}`))
+}
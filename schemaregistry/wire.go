@@ -0,0 +1,56 @@
+package schemaregistry
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	magicByte  = 0
+	headerSize = 5
+)
+
+// ErrNotWireFormat is returned for payloads that do not start with the
+// Schema Registry wire-format header.
+var ErrNotWireFormat = errors.New("payload is not in schema registry wire format")
+
+// ParseHeader splits a wire-format payload into the schema ID and the
+// serialized data that follows the header.
+func ParseHeader(data []byte) (id int, payload []byte, err error) {
+	if len(data) < headerSize || data[0] != magicByte {
+		return 0, nil, ErrNotWireFormat
+	}
+	return int(binary.BigEndian.Uint32(data[1:headerSize])), data[headerSize:], nil
+}
+
+// AppendHeader appends the wire-format header for the schema ID to dst.
+func AppendHeader(dst []byte, id int) []byte {
+	dst = append(dst, magicByte)
+	return binary.BigEndian.AppendUint32(dst, uint32(id))
+}
+
+// parseMessageIndexes strips the Protobuf message-index array that follows
+// the header. The indexes locate the message type within the schema; a single
+// zero byte is the shorthand for the first message.
+func parseMessageIndexes(data []byte) (indexes []int, payload []byte, err error) {
+	count, n := binary.Varint(data)
+	if n <= 0 {
+		return nil, nil, fmt.Errorf("invalid protobuf message indexes")
+	}
+	data = data[n:]
+	if count == 0 {
+		return []int{0}, data, nil
+	}
+
+	indexes = make([]int, 0, count)
+	for i := int64(0); i < count; i++ {
+		idx, n := binary.Varint(data)
+		if n <= 0 {
+			return nil, nil, fmt.Errorf("invalid protobuf message indexes")
+		}
+		indexes = append(indexes, int(idx))
+		data = data[n:]
+	}
+	return indexes, data, nil
+}
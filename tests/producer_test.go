@@ -0,0 +1,76 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/overtonx/kafkalight"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestProducer_RoundTrip verifies that a message produced with KafkaProducer
+// reaches the router with its key, value and headers intact, and that the
+// delivery report is written back to the message.
+func TestProducer_RoundTrip(t *testing.T) {
+	cluster, err := kafka.NewMockCluster(1)
+	require.NoError(t, err)
+	defer cluster.Close()
+
+	const topic = "test-producer"
+	require.NoError(t, cluster.CreateTopic(topic, 1, 1))
+
+	producer, err := kafkalight.NewProducer(&kafka.ConfigMap{
+		"bootstrap.servers": cluster.BootstrapServers(),
+	})
+	require.NoError(t, err)
+
+	key, err := kafkalight.NewKey("order-1")
+	require.NoError(t, err)
+	msg := &kafkalight.Message{
+		TopicPartition: kafkalight.TopicPartition{Topic: topic, Partition: kafkalight.PartitionAny},
+		Key:            *key,
+		Value:          []byte("payload"),
+		Headers:        []kafkalight.Header{{Key: "event-type", Value: []byte("created")}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, producer.Produce(ctx, msg))
+	assert.Equal(t, int32(0), msg.TopicPartition.Partition)
+	assert.Equal(t, int64(0), msg.TopicPartition.Offset)
+	require.NoError(t, producer.Close(ctx))
+
+	router, err := kafkalight.NewRouter(
+		kafkalight.WithConsumerConfig(&kafka.ConfigMap{
+			"bootstrap.servers": cluster.BootstrapServers(),
+			"group.id":          "test-group-producer",
+			"auto.offset.reset": "earliest",
+		}),
+		kafkalight.WithReadTimeout(200*time.Millisecond),
+	)
+	require.NoError(t, err)
+
+	received := make(chan *kafkalight.Message, 1)
+	router.RegisterRoute(topic, func(_ context.Context, msg *kafkalight.Message) error {
+		received <- msg
+		return nil
+	})
+
+	go router.StartListening(context.Background()) //nolint:errcheck
+
+	select {
+	case got := <-received:
+		assert.Equal(t, "order-1", got.Key.String())
+		assert.Equal(t, "payload", string(got.Value))
+		assert.Equal(t, msg.Headers, got.Headers)
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout waiting for handler to process message")
+	}
+
+	closeCtx, closeCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer closeCancel()
+	require.NoError(t, router.Close(closeCtx))
+}
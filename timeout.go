@@ -0,0 +1,201 @@
+package kafkalight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ErrHandlerTimeout is returned by TimeoutHandler when the handler does not
+// finish before its deadline.
+var ErrHandlerTimeout = errors.New("handler timeout")
+
+// ErrTooManyAbandonedHandlers is returned by TimeoutHandler, without running
+// the handler, while the router has the maximum number of handlers running
+// past their deadline, see WithMaxAbandonedHandlers.
+var ErrTooManyAbandonedHandlers = errors.New("too many abandoned handlers")
+
+// cancellationGrace is how long a handler may keep running after its deadline
+// before it is reported as ignoring cancellation.
+const cancellationGrace = 100 * time.Millisecond
+
+// defaultMaxAbandonedHandlers is the default of WithMaxAbandonedHandlers.
+const defaultMaxAbandonedHandlers = 100
+
+// WithHandlerTimeout limits the handler of the route to d. The timeout is
+// applied inside the router middlewares, so they see ErrHandlerTimeout like
+// any other handler error. See TimeoutHandler.
+func WithHandlerTimeout(d time.Duration) RouteOption {
+	return func(rt *route) {
+		rt.timeout = d
+	}
+}
+
+// WithMaxAbandonedHandlers limits the number of handlers that keep running
+// after TimeoutHandler gave up on them to n, 100 by default. While the limit
+// is reached, TimeoutHandler fails messages with ErrTooManyAbandonedHandlers
+// instead of running their handler. A limit of 0 or less removes it.
+func WithMaxAbandonedHandlers(n int) Option {
+	return func(r *KafkaRouter) {
+		r.abandoned.max = int64(n)
+	}
+}
+
+// HandlerPanic is the value TimeoutHandler panics with when its handler
+// panics. The panic is recovered in the goroutine running the handler and
+// raised again in the caller, so Stack keeps the stack trace of the frame
+// that panicked. middleware.Recovery unwraps it.
+type HandlerPanic struct {
+	// Value is the value passed to panic.
+	Value any
+	// Stack is the stack trace of the panicking goroutine.
+	Stack []byte
+}
+
+func (p *HandlerPanic) Error() string {
+	return fmt.Sprintf("%v", p.Value)
+}
+
+// Unwrap returns the panic value if it is an error.
+func (p *HandlerPanic) Unwrap() error {
+	err, _ := p.Value.(error)
+	return err
+}
+
+// TimeoutHandler returns a handler that runs next with a deadline of d on its
+// context. If next does not return in time, TimeoutHandler returns an error
+// wrapping ErrHandlerTimeout without waiting for it. The error is not
+// permanent, so the router does not commit the offset of the message, but the
+// next message of the partition that succeeds commits past it.
+//
+// Handlers that ignore cancellation keep running in the background; they are
+// logged at Warn level through LoggerFromContext when still running shortly
+// after the deadline and again when they finally return. Under the router,
+// KafkaRouter.Close waits for them, DeferCommit is a no-op for them once the
+// deadline passed, and their number is limited, see WithMaxAbandonedHandlers.
+// Their side effects may still interleave with those of later messages.
+func TimeoutHandler(next MessageHandler, d time.Duration) MessageHandler {
+	return func(ctx context.Context, msg *Message) error {
+		abandoned, _ := ctx.Value(abandonedKey{}).(*abandonedHandlers)
+		if abandoned.full() {
+			tp := msg.TopicPartition
+			return fmt.Errorf("%w: %s[%d]@%d not handled, %d handlers still running", ErrTooManyAbandonedHandlers, tp.Topic, tp.Partition, tp.Offset, abandoned.running.Load())
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, d)
+
+		done := make(chan handlerResult, 1)
+		start := time.Now()
+		go func() {
+			var res handlerResult
+			defer func() {
+				if v := recover(); v != nil {
+					res.panic = &HandlerPanic{Value: v, Stack: debug.Stack()}
+				}
+				done <- res
+			}()
+			res.err = next(ctx, msg)
+		}()
+
+		select {
+		case res := <-done:
+			cancel()
+			if res.panic != nil {
+				panic(res.panic)
+			}
+			return res.err
+		case <-ctx.Done():
+		}
+
+		stopCommitScope(ctx)
+		abandoned.add(start)
+		go func() {
+			defer abandoned.done(start)
+			watchAbandoned(ctx, done, start, cancel)
+		}()
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			// The parent context was cancelled before the deadline.
+			return ctx.Err()
+		}
+		tp := msg.TopicPartition
+		return fmt.Errorf("%w: %s[%d]@%d after %s", ErrHandlerTimeout, tp.Topic, tp.Partition, tp.Offset, d)
+	}
+}
+
+// handlerResult is the outcome of a handler run by TimeoutHandler.
+type handlerResult struct {
+	err   error
+	panic *HandlerPanic
+}
+
+// watchAbandoned waits for a handler abandoned by TimeoutHandler and logs it
+// if it does not honour the cancellation of its context.
+func watchAbandoned(ctx context.Context, done <-chan handlerResult, start time.Time, cancel context.CancelFunc) {
+	defer cancel()
+
+	var res handlerResult
+	select {
+	case res = <-done:
+	case <-time.After(cancellationGrace):
+		logger := LoggerFromContext(ctx)
+		logger.Warn("handler ignores cancellation, still running", zap.Duration("elapsed", time.Since(start)))
+		res = <-done
+		logger.Warn("abandoned handler finished", zap.Duration("elapsed", time.Since(start)), zap.Error(res.err))
+	}
+	if res.panic != nil {
+		value := zap.Any("panic", res.panic.Value)
+		if RedactionFromContext(ctx) != nil {
+			value = zap.String("panic_type", fmt.Sprintf("%T", res.panic.Value))
+		}
+		LoggerFromContext(ctx).Error("abandoned handler panicked", value, zap.ByteString("stack", res.panic.Stack))
+	}
+}
+
+type abandonedKey struct{}
+
+// abandonedHandlers counts the handlers of a router that TimeoutHandler gave
+// up on and that are still running. They are added to the router wait group,
+// so Close waits for them, and reported by KafkaRouter.Health.
+type abandonedHandlers struct {
+	wg      *sync.WaitGroup
+	health  *healthState
+	max     int64
+	running atomic.Int64
+}
+
+func withAbandonedHandlers(ctx context.Context, a *abandonedHandlers) context.Context {
+	return context.WithValue(ctx, abandonedKey{}, a)
+}
+
+// full reports whether the limit of abandoned handlers is reached. A nil
+// *abandonedHandlers, as outside the router, is never full.
+func (a *abandonedHandlers) full() bool {
+	return a != nil && a.max > 0 && a.running.Load() >= a.max
+}
+
+// add counts a handler started at started that TimeoutHandler gave up on. It
+// is called while the message is still being handled, so the router wait
+// group is not zero.
+func (a *abandonedHandlers) add(started time.Time) {
+	if a == nil {
+		return
+	}
+	a.running.Add(1)
+	a.wg.Add(1)
+	a.health.abandoned(started, true)
+}
+
+func (a *abandonedHandlers) done(started time.Time) {
+	if a == nil {
+		return
+	}
+	a.health.abandoned(started, false)
+	a.running.Add(-1)
+	a.wg.Done()
+}
@@ -0,0 +1,149 @@
+package kafkalight_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/overtonx/kafkalight"
+	"github.com/overtonx/kafkalight/kafkalighttest"
+)
+
+func TestTimeoutHandler(t *testing.T) {
+	msg := kafkalighttest.NewMessage("orders", "", "a")
+
+	t.Run("returns the handler result in time", func(t *testing.T) {
+		want := errors.New("boom")
+		handler := kafkalight.TimeoutHandler(func(ctx context.Context, _ *kafkalight.Message) error {
+			_, ok := ctx.Deadline()
+			assert.True(t, ok)
+			return want
+		}, time.Second)
+
+		assert.Equal(t, want, handler(context.Background(), msg))
+	})
+
+	t.Run("times out", func(t *testing.T) {
+		handler := kafkalight.TimeoutHandler(func(ctx context.Context, _ *kafkalight.Message) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}, 10*time.Millisecond)
+
+		err := handler(context.Background(), msg)
+		assert.ErrorIs(t, err, kafkalight.ErrHandlerTimeout)
+		assert.False(t, kafkalight.IsPermanent(err))
+	})
+
+	t.Run("logs handlers that ignore cancellation", func(t *testing.T) {
+		core, recorded := observer.New(zapcore.WarnLevel)
+		ctx := kafkalight.ContextWithLogger(context.Background(), zap.New(core))
+		release := make(chan struct{})
+		handler := kafkalight.TimeoutHandler(func(context.Context, *kafkalight.Message) error {
+			<-release
+			return nil
+		}, 10*time.Millisecond)
+
+		assert.ErrorIs(t, handler(ctx, msg), kafkalight.ErrHandlerTimeout)
+		require.Eventually(t, func() bool {
+			return recorded.FilterMessage("handler ignores cancellation, still running").Len() == 1
+		}, time.Second, 5*time.Millisecond)
+
+		close(release)
+		require.Eventually(t, func() bool {
+			return recorded.FilterMessage("abandoned handler finished").Len() == 1
+		}, time.Second, 5*time.Millisecond)
+	})
+
+	t.Run("propagates panics with their stack", func(t *testing.T) {
+		handler := kafkalight.TimeoutHandler(func(context.Context, *kafkalight.Message) error {
+			panic("boom")
+		}, time.Second)
+
+		defer func() {
+			p, ok := recover().(*kafkalight.HandlerPanic)
+			require.True(t, ok)
+			assert.Equal(t, "boom", p.Value)
+			assert.Contains(t, string(p.Stack), "TestTimeoutHandler", "the stack of the panicking goroutine is kept")
+		}()
+		_ = handler(context.Background(), msg)
+	})
+}
+
+func TestRouter_AbandonedHandlers(t *testing.T) {
+	broker := kafkalighttest.NewBroker()
+	broker.CreateTopic("orders", 1)
+	broker.MustProduce(t,
+		kafkalighttest.NewMessage("orders", "", "hung"),
+		kafkalighttest.NewMessage("orders", "", "skipped"),
+	)
+
+	var (
+		release  = make(chan struct{})
+		deferred = make(chan bool, 1)
+		handled  = make(chan string, 2)
+	)
+	core, recorded := observer.New(zapcore.ErrorLevel)
+	group := broker.ConsumerGroup("group")
+	router := kafkalighttest.NewRouter(t, group,
+		kafkalight.WithMaxAbandonedHandlers(1),
+		kafkalight.WithLogger(zap.New(core)),
+	)
+	router.RegisterRoute("orders", func(ctx context.Context, msg *kafkalight.Message) error {
+		handled <- string(msg.Value)
+		<-release
+		_, ok := kafkalight.DeferCommit(ctx)
+		deferred <- ok
+		return nil
+	}, kafkalight.WithHandlerTimeout(10*time.Millisecond))
+
+	listening := make(chan struct{})
+	go func() {
+		defer close(listening)
+		_ = router.StartListening(context.Background())
+	}()
+	group.WaitProcessed(t, 2)
+	logs := recorded.FilterMessage("handler error").AllUntimed()
+	require.Len(t, logs, 2)
+	assert.Contains(t, logs[0].ContextMap()["error"], kafkalight.ErrHandlerTimeout.Error())
+	assert.Contains(t, logs[1].ContextMap()["error"], kafkalight.ErrTooManyAbandonedHandlers.Error())
+	require.Len(t, handled, 1, "no handler runs while the limit is reached")
+	assert.Equal(t, "hung", <-handled)
+	health := router.Health()
+	assert.Zero(t, health.LongestInFlight)
+	assert.Equal(t, 1, health.AbandonedHandlers)
+	assert.Greater(t, health.LongestAbandoned, 10*time.Millisecond, "measured from the handler start")
+
+	closed := make(chan error, 1)
+	go func() { closed <- router.Close(context.Background()) }()
+	select {
+	case <-closed:
+		t.Fatal("Close returned while an abandoned handler was running")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	require.NoError(t, <-closed)
+	<-listening
+	assert.False(t, <-deferred, "DeferCommit is a no-op after the timeout")
+	assert.Zero(t, router.Health().AbandonedHandlers)
+	assert.Zero(t, router.Health().LongestAbandoned)
+}
+
+func TestRouter_HandlerTimeout(t *testing.T) {
+	router := kafkalighttest.NewRouter(t, kafkalighttest.NewBroker().ConsumerGroup("group"))
+	router.RegisterRoute("orders", func(ctx context.Context, _ *kafkalight.Message) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, kafkalight.WithHandlerTimeout(10*time.Millisecond))
+
+	err := router.Dispatch(context.Background(), kafkalighttest.NewMessage("orders", "", "a"))
+	assert.ErrorIs(t, err, kafkalight.ErrHandlerTimeout)
+	assert.Equal(t, 10*time.Millisecond, router.Routes()[0].Timeout)
+}
@@ -0,0 +1,53 @@
+package kafkalight
+
+import (
+	"context"
+	"reflect"
+)
+
+// TypedHandlerFunc handles a message whose payload has been decoded into T.
+type TypedHandlerFunc[T any] func(ctx context.Context, msg *Message, payload T) error
+
+// Typed adapts fn to a MessageHandler that decodes the message value into T
+// with codec before calling fn. A nil codec picks the codec per message, as
+// Message.Bind does. If T is a pointer type, a new value is allocated for
+// every message.
+//
+// Decode failures are returned as *DecodeError without calling fn, so they can
+// be told apart from business errors with errors.As or IsPermanent.
+func Typed[T any](fn TypedHandlerFunc[T], codec Codec) MessageHandler {
+	payloadType := reflect.TypeFor[T]()
+
+	return func(ctx context.Context, msg *Message) error {
+		msgCodec := codec
+		if msgCodec == nil {
+			msgCodec = msg.Codec()
+		}
+
+		payload, err := decodePayload[T](ctx, msgCodec, payloadType, msg.Value)
+		if err != nil {
+			return &DecodeError{
+				TopicPartition: msg.TopicPartition,
+				Type:           payloadType,
+				Err:            err,
+			}
+		}
+		return fn(ctx, msg, payload)
+	}
+}
+
+// RegisterTyped registers Typed(fn, codec) for topic and records T as the
+// payload type of the route, so it is reported by KafkaRouter.Routes.
+func RegisterTyped[T any](r *KafkaRouter, topic string, fn TypedHandlerFunc[T], codec Codec, opts ...RouteOption) {
+	opts = append([]RouteOption{withPayloadType(reflect.TypeFor[T]())}, opts...)
+	r.RegisterRoute(topic, Typed(fn, codec), opts...)
+}
+
+func decodePayload[T any](ctx context.Context, codec Codec, payloadType reflect.Type, data []byte) (T, error) {
+	var payload T
+	if payloadType.Kind() == reflect.Pointer {
+		payload = reflect.New(payloadType.Elem()).Interface().(T)
+		return payload, unmarshalContext(ctx, codec, data, payload)
+	}
+	return payload, unmarshalContext(ctx, codec, data, &payload)
+}
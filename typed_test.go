@@ -0,0 +1,72 @@
+package kafkalight
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type orderCreated struct {
+	ID int `json:"id"`
+}
+
+func TestTyped(t *testing.T) {
+	t.Run("decodes value payload", func(t *testing.T) {
+		var got orderCreated
+		handler := Typed(func(_ context.Context, _ *Message, evt orderCreated) error {
+			got = evt
+			return nil
+		}, nil)
+
+		require.NoError(t, handler(context.Background(), &Message{Value: []byte(`{"id":7}`)}))
+		assert.Equal(t, 7, got.ID)
+	})
+
+	t.Run("decodes pointer payload", func(t *testing.T) {
+		var got *orderCreated
+		handler := Typed(func(_ context.Context, _ *Message, evt *orderCreated) error {
+			got = evt
+			return nil
+		}, JSONCodec{})
+
+		require.NoError(t, handler(context.Background(), &Message{Value: []byte(`{"id":8}`)}))
+		require.NotNil(t, got)
+		assert.Equal(t, 8, got.ID)
+	})
+
+	t.Run("decode failure is a permanent decode error", func(t *testing.T) {
+		var called bool
+		handler := Typed(func(context.Context, *Message, orderCreated) error {
+			called = true
+			return nil
+		}, nil)
+
+		msg := &Message{
+			TopicPartition: TopicPartition{Topic: "orders", Partition: 1, Offset: 3},
+			Value:          []byte(`{"id":`),
+		}
+		err := handler(context.Background(), msg)
+
+		var decodeErr *DecodeError
+		require.ErrorAs(t, err, &decodeErr)
+		assert.False(t, called)
+		assert.True(t, IsPermanent(err))
+		assert.Equal(t, msg.TopicPartition, decodeErr.TopicPartition)
+		assert.Equal(t, reflect.TypeOf(orderCreated{}), decodeErr.Type)
+	})
+
+	t.Run("handler errors are returned as is", func(t *testing.T) {
+		expectedErr := errors.New("business failure")
+		handler := Typed(func(context.Context, *Message, orderCreated) error {
+			return expectedErr
+		}, nil)
+
+		err := handler(context.Background(), &Message{Value: []byte(`{}`)})
+		assert.Equal(t, expectedErr, err)
+		assert.False(t, IsPermanent(err))
+	})
+}